@@ -1,11 +1,15 @@
 package api
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"runtime"
 	"strings"
 
+	"github.com/500k-agency/function/lib/connect"
+	"github.com/500k-agency/function/lib/sendgrid"
+	"github.com/go-chi/render"
 	"github.com/rs/zerolog/log"
 )
 
@@ -38,8 +42,17 @@ func (a *ApiError) Wrap(cause error) *ApiError {
 	return &ret
 }
 
+// Unwrap returns the underlying error
+func (e *ApiError) Unwrap() error {
+	return e.Err
+}
+
 // Render sends error message to the client
 func (e *ApiError) Render(w http.ResponseWriter, r *http.Request) error {
+	if e.StatusCode != 0 {
+		render.Status(r, e.StatusCode)
+	}
+
 	pc := make([]uintptr, 5) // maximum 5 levels to go
 	runtime.Callers(1, pc)
 	frames := runtime.CallersFrames(pc)
@@ -79,6 +92,26 @@ func ErrPermission(err error) *ApiError {
 	}
 }
 
+// ErrForbidden is error message for Forbidden
+func ErrForbidden(err error) *ApiError {
+	return &ApiError{
+		Err:        err,
+		StatusCode: http.StatusForbidden,
+		StatusText: "Forbidden",
+		ErrorText:  err.Error(),
+	}
+}
+
+// ErrGone is error message for resources that are no longer available
+func ErrGone(err error) *ApiError {
+	return &ApiError{
+		Err:        err,
+		StatusCode: http.StatusGone,
+		StatusText: "Gone",
+		ErrorText:  err.Error(),
+	}
+}
+
 // ErrInvalidRequest is error message for Unauthorized
 func ErrInvalidRequest(err error, data ...interface{}) *ApiError {
 	v := &ApiError{
@@ -115,6 +148,36 @@ func ErrInternalServerError(err error) *ApiError {
 	}
 }
 
+// ErrBadGateway is error message for failures of a downstream service
+func ErrBadGateway(err error) *ApiError {
+	return &ApiError{
+		Err:        err,
+		StatusCode: http.StatusBadGateway,
+		StatusText: "Bad Gateway.",
+		ErrorText:  err.Error(),
+	}
+}
+
+// ErrUnprocessableEntity is error message for requests that can not be processed
+func ErrUnprocessableEntity(err error) *ApiError {
+	return &ApiError{
+		Err:        err,
+		StatusCode: http.StatusUnprocessableEntity,
+		StatusText: "Unprocessable Entity",
+		ErrorText:  err.Error(),
+	}
+}
+
+// ErrConflict is error message for requests conflicting with one in flight
+func ErrConflict(err error) *ApiError {
+	return &ApiError{
+		Err:        err,
+		StatusCode: http.StatusConflict,
+		StatusText: "Conflict",
+		ErrorText:  err.Error(),
+	}
+}
+
 // ErrRequestEntityTooLarge is error message for Request Entity Too Large
 func ErrRequestEntityTooLarge(err error) *ApiError {
 	return &ApiError{
@@ -146,6 +209,56 @@ func ErrInvalidEmailSignup(cause error) *ApiError {
 	}
 }
 
+// ErrUpstream maps a failure of a downstream service to an api error. The
+// status tells webhook providers whether to retry: 503 for transient
+// failures, 502 for failures that need fixing on our side (ie. revoked api
+// keys) so the provider keeps retrying until they are, and 422 for requests
+// the service rejected that will never succeed.
+func ErrUpstream(err error) *ApiError {
+	if errors.Is(err, sendgrid.ErrInvalidMail) {
+		// rejected before it was sent
+		return ErrUnprocessableEntity(err)
+	}
+
+	var pErr *connect.ProviderError
+	if errors.As(err, &pErr) {
+		switch {
+		case pErr.Retryable():
+			return ErrServiceUnavailable(err)
+		case pErr.Rejected():
+			return ErrUnprocessableEntity(err)
+		}
+		return ErrBadGateway(err)
+	}
+
+	var sgErr *sendgrid.ErrorResponse
+	if !errors.As(err, &sgErr) {
+		return ErrBadGateway(err)
+	}
+
+	switch {
+	case sgErr.Retryable():
+		return ErrServiceUnavailable(err)
+	case errors.Is(sgErr, sendgrid.ErrUnauthorized), errors.Is(sgErr, sendgrid.ErrForbidden):
+		return ErrBadGateway(err)
+	case errors.Is(sgErr, sendgrid.ErrBadRequest),
+		errors.Is(sgErr, sendgrid.ErrNotFound),
+		errors.Is(sgErr, sendgrid.ErrPayloadTooLarge):
+		return ErrUnprocessableEntity(err)
+	}
+	return ErrBadGateway(err)
+}
+
+// AsApiError returns the *ApiError in err's chain, defaulting to an internal
+// server error for anything else
+func AsApiError(err error) *ApiError {
+	var apiErr *ApiError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	return ErrInternalServerError(err)
+}
+
 // IgnoreError ignores error
 func IgnoreError(v ...interface{}) {}
 
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/500k-agency/function/lib/connect"
+	"github.com/500k-agency/function/lib/sendgrid"
+)
+
+func sendgridError(code int) *sendgrid.ErrorResponse {
+	return &sendgrid.ErrorResponse{Response: &http.Response{StatusCode: code}}
+}
+
+func TestErrUpstream(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"invalid mail", fmt.Errorf("purchase: %w", sendgrid.ErrInvalidMail), http.StatusUnprocessableEntity},
+		{"sendgrid rate limited", &sendgrid.RateLimitError{ErrorResponse: sendgridError(429)}, http.StatusServiceUnavailable},
+		{"sendgrid down", fmt.Errorf("adding contact: %w", sendgridError(503)), http.StatusServiceUnavailable},
+		{"sendgrid revoked key", sendgridError(401), http.StatusBadGateway},
+		{"sendgrid forbidden", sendgridError(403), http.StatusBadGateway},
+		{"sendgrid bad request", sendgridError(400), http.StatusUnprocessableEntity},
+		{"sendgrid unknown list", sendgridError(404), http.StatusUnprocessableEntity},
+		{"sendgrid too large", sendgridError(413), http.StatusUnprocessableEntity},
+		{"sendgrid teapot", sendgridError(418), http.StatusBadGateway},
+		{"postmark down", &connect.ProviderError{Provider: connect.ProviderPostmark, StatusCode: 500}, http.StatusServiceUnavailable},
+		{"mailgun rejected", &connect.ProviderError{Provider: connect.ProviderMailgun, StatusCode: 400}, http.StatusUnprocessableEntity},
+		{"mailgun bad key", &connect.ProviderError{Provider: connect.ProviderMailgun, StatusCode: 401}, http.StatusBadGateway},
+		{"network", errors.New("dial tcp: connection refused"), http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ErrUpstream(tt.err)
+			if got.StatusCode != tt.want {
+				t.Errorf("status %d, want %d", got.StatusCode, tt.want)
+			}
+			if !errors.Is(got, tt.err) {
+				t.Errorf("%v does not wrap %v", got, tt.err)
+			}
+		})
+	}
+}
+
+func TestAsApiError(t *testing.T) {
+	notFound := ErrResourceNotFound(errors.New("no such code"))
+	if got := AsApiError(fmt.Errorf("handler: %w", notFound)); got != notFound {
+		t.Errorf("got %v, want the wrapped api error", got)
+	}
+	if got := AsApiError(errors.New("boom")); got.StatusCode != http.StatusInternalServerError {
+		t.Errorf("status %d, want 500", got.StatusCode)
+	}
+}
@@ -5,18 +5,20 @@ import (
 	"log"
 	"os"
 
-	// Blank-import the function package so the init() runs
-	_ "github.com/500k-agency/function"
+	// Import the function package so the init() registering the functions runs
+	function "github.com/500k-agency/function"
 	"github.com/500k-agency/function/config"
-	"github.com/500k-agency/function/lib/connect"
+	"github.com/500k-agency/function/preview"
 	"github.com/500k-agency/function/product"
-	"github.com/500k-agency/function/waitlist"
 	"github.com/GoogleCloudPlatform/functions-framework-go/funcframework"
+	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
 )
 
 var (
-	flags    = flag.NewFlagSet("main", flag.ExitOnError)
-	confFile = flags.String("config", "", "path to config file")
+	flags        = flag.NewFlagSet("main", flag.ExitOnError)
+	confFile     = flags.String("config", "", "path to config file")
+	templatesDir = flags.String("templates", "templates", "path to the handlebars templates")
+	fixturesDir  = flags.String("fixtures", "fixtures", "path to the fixture checkout sessions")
 )
 
 func main() {
@@ -40,9 +42,13 @@ func main() {
 		if err != nil {
 			log.Fatalf("main.NewFromConfig: %v\n", err)
 		}
-		connect.Configure(conf.Connect)
-		product.Setup(conf.Products)
-		waitlist.Setup(conf.Waitlist)
+		function.Configure(conf)
+		if err := product.CheckTemplates(*templatesDir); err != nil {
+			log.Fatalf("product.CheckTemplates: %v\n", err)
+		}
+
+		// render emails of fixture sessions at /PreviewHandler, never deployed
+		functions.HTTP("PreviewHandler", preview.Handler(*templatesDir, *fixturesDir))
 	}
 
 	log.Printf("server running on %s:%s", hostname, port)
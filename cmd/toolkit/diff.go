@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+const diffContext = 2
+
+// writeDiff writes a line diff of a and b with a few lines of context
+func writeDiff(w io.Writer, name, a, b string) {
+	x, y := strings.Split(a, "\n"), strings.Split(b, "\n")
+
+	// longest common subsequence table
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	type line struct {
+		op   byte
+		text string
+	}
+	var lines []line
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			lines = append(lines, line{' ', x[i]})
+			i++
+			j++
+		case i < len(x) && (j == len(y) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, line{'-', x[i]})
+			i++
+		default:
+			lines = append(lines, line{'+', y[j]})
+			j++
+		}
+	}
+
+	fmt.Fprintf(w, "--- %s\n+++ %s\n", name, name)
+	lastShown := -1
+	for k, l := range lines {
+		show := l.op != ' '
+		for c := max(0, k-diffContext); !show && c <= min(len(lines)-1, k+diffContext); c++ {
+			show = lines[c].op != ' '
+		}
+		if !show {
+			continue
+		}
+		if lastShown >= 0 && k > lastShown+1 {
+			fmt.Fprintln(w, "@@")
+		}
+		fmt.Fprintf(w, "%c %s\n", l.op, l.text)
+		lastShown = k
+	}
+}
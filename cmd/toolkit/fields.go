@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/500k-agency/function/lib/sendgrid"
+)
+
+// createFields creates the custom fields of [contact_fields] and the
+// waitlist referral codes missing from sendgrid. Contacts reference them by
+// name, so the config is left as is.
+func createFields(ctx context.Context, tk *toolkit) error {
+	defs := tk.conf.ContactFields.Definitions()
+	for _, w := range tk.conf.Waitlists {
+		if w.Referral.Enabled() {
+			defs = append(defs, sendgrid.FieldDefinition{Name: w.Referral.CodeField, FieldType: sendgrid.FieldTypeText})
+		}
+	}
+	if len(defs) == 0 {
+		return nil
+	}
+
+	existing, _, err := tk.client.CustomField.List(ctx)
+	if err != nil {
+		return fmt.Errorf("listing custom fields: %w", err)
+	}
+	types := make(map[string]string, len(existing.CustomFields))
+	for _, f := range existing.CustomFields {
+		types[f.Name] = f.FieldType
+	}
+
+	seen := map[string]bool{}
+	for _, d := range defs {
+		if seen[d.Name] {
+			continue
+		}
+		seen[d.Name] = true
+		if t, ok := types[d.Name]; ok {
+			if t != d.FieldType {
+				return fmt.Errorf("custom field %q is a %s field, expected %s", d.Name, t, d.FieldType)
+			}
+			fmt.Printf("found custom field %q\n", d.Name)
+			continue
+		}
+		if tk.dryRun {
+			fmt.Printf("would create %s custom field %q\n", d.FieldType, d.Name)
+			continue
+		}
+		field, _, err := tk.client.CustomField.Create(ctx, d.Name, d.FieldType)
+		if err != nil {
+			return fmt.Errorf("creating custom field %q: %w", d.Name, err)
+		}
+		fmt.Printf("created %s custom field %q: %s\n", field.FieldType, field.Name, field.ID)
+	}
+	return nil
+}
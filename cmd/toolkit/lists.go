@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// createLists creates a sendgrid list for every product and waitlist
+// without list_ids and writes the new ids into the config
+func createLists(ctx context.Context, tk *toolkit) error {
+	// reuse lists created by an earlier, interrupted run. listing is read
+	// only, so dry runs list too and show the ids a real run would write
+	lists, err := tk.client.List.ListAll(ctx)
+	if err != nil {
+		return fmt.Errorf("listing lists: %w", err)
+	}
+	tk.lists = make(map[string]string, len(lists))
+	for _, l := range lists {
+		tk.lists[l.Name] = l.ID
+	}
+
+	for i, p := range tk.conf.Products {
+		if p.StripeID == "" {
+			continue
+		}
+		if len(p.PurchaseThankyou.ListIDs) == 0 {
+			path := fmt.Sprintf("products[%d].purchase_thankyou", i)
+			if err := tk.createList(ctx, path, p.Name+" purchasers"); err != nil {
+				return err
+			}
+		}
+
+		// only recurring products declare a subscription table
+		path := fmt.Sprintf("products[%d].subscription", i)
+		if tk.doc.HasTable(path) && len(p.Subscription.ListIDs) == 0 {
+			if err := tk.createList(ctx, path, p.Name+" members"); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i, w := range tk.conf.Waitlists {
+		if w.FormID == "" || len(w.ListIDs) > 0 {
+			continue
+		}
+		path := tk.waitlistPath(i)
+		if err := tk.createList(ctx, path, w.Name+" waitlist"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tk *toolkit) createList(ctx context.Context, path, name string) error {
+	if id, ok := tk.lists[name]; ok {
+		fmt.Printf("found list %q: %s\n", name, id)
+		tk.doc.Set(path, "list_ids", tomlStrings([]string{id}))
+		return nil
+	}
+
+	if tk.dryRun {
+		fmt.Printf("would create list %q\n", name)
+		tk.doc.Set(path, "list_ids", tomlStrings([]string{"<new list " + name + ">"}))
+		return nil
+	}
+	list, _, err := tk.client.List.Create(ctx, name)
+	if err != nil {
+		return fmt.Errorf("creating list %q: %w", name, err)
+	}
+	fmt.Printf("created list %q: %s\n", name, list.ID)
+	tk.doc.Set(path, "list_ids", tomlStrings([]string{list.ID}))
+	return nil
+}
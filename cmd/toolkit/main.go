@@ -1,7 +1,147 @@
 package main
 
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/500k-agency/function/config"
+	"github.com/500k-agency/function/lib/sendgrid"
+	"github.com/500k-agency/function/product"
+)
+
+var (
+	flags        = flag.NewFlagSet("toolkit", flag.ExitOnError)
+	confFile     = flags.String("config", "", "path to config file")
+	templatesDir = flags.String("templates", "templates", "path to the handlebars templates")
+	dryRun       = flags.Bool("dry-run", false, "show the config changes without creating anything")
+	debug        = flags.Bool("debug", false, "log sendgrid requests")
+	sessionFile  = flags.String("session", "fixtures/checkout_session.json", "preview: fixture checkout session")
+	templateName = flags.String("template", "purchase_thankyou", "preview: template to render")
+	outDir       = flags.String("out", os.TempDir(), "preview: directory the rendered emails are written to")
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(ctx context.Context, tk *toolkit) error
+}
+
+var commands = []command{
+	{"lists", "create missing sendgrid lists for products and waitlists", createLists},
+	{"fields", "create missing sendgrid custom fields of contact_fields", createFields},
+	{"templates", "upload templates as sendgrid dynamic templates", uploadTemplates},
+	{"deploy", "publish changed templates as new live versions", deployTemplates},
+	{"preview", "render a template with the data of a fixture checkout session", previewTemplates},
+	{"setup", "run lists, fields and templates", setup},
+}
+
+// toolkit holds the state shared by the commands
+type toolkit struct {
+	conf   *config.Config
+	doc    *tomlDoc
+	client *sendgrid.Client
+	dryRun bool
+
+	// existing sendgrid list ids by name
+	lists map[string]string
+}
+
 func main() {
-	// setup a purchaser mailing list
-	// setup a purchaser thank you template
-	// setup a tally form for waitlist
+	flags.Usage = usage
+	if err := flags.Parse(os.Args[1:]); err != nil {
+		log.Fatalf("invalid flags: %v\n", err)
+	}
+
+	name := flags.Arg(0)
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == name {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		usage()
+		os.Exit(2)
+	}
+
+	file := *confFile
+	if file == "" {
+		file = os.Getenv("CONFIG")
+	}
+	conf, err := config.NewFromFile(file, "")
+	if err != nil {
+		log.Fatalf("config.NewFromFile: %v\n", err)
+	}
+	src, err := os.ReadFile(file)
+	if err != nil {
+		log.Fatalf("reading config: %v\n", err)
+	}
+	if err := product.CheckTemplates(*templatesDir); err != nil {
+		log.Fatalf("product.CheckTemplates: %v\n", err)
+	}
+
+	client, err := sendgrid.NewClient(
+		nil,
+		sendgrid.WithApp(conf.Connect.Sendgrid.AppID, conf.Connect.Sendgrid.AppSecret),
+		sendgrid.WithDebug(*debug),
+	)
+	if err != nil {
+		log.Fatalf("sendgrid.NewClient: %v\n", err)
+	}
+
+	tk := &toolkit{
+		conf:   conf,
+		doc:    newTomlDoc(string(src)),
+		client: client,
+		dryRun: *dryRun,
+	}
+	if err := cmd.run(context.Background(), tk); err != nil {
+		log.Fatalf("%s: %v\n", cmd.name, err)
+	}
+
+	updated := tk.doc.String()
+	if updated == string(src) {
+		fmt.Println("config is up to date")
+		return
+	}
+	writeDiff(os.Stdout, file, string(src), updated)
+	if tk.dryRun {
+		fmt.Println("dry run, config not written")
+		return
+	}
+	if err := os.WriteFile(file, []byte(updated), 0o600); err != nil {
+		log.Fatalf("writing config: %v\n", err)
+	}
+	fmt.Printf("wrote %s\n", file)
+}
+
+// waitlistPath returns the table path of the i-th waitlist, configs may
+// still declare a single [waitlist] table instead of [[waitlist]] tables
+func (tk *toolkit) waitlistPath(i int) string {
+	if tk.doc.HasTable("waitlist") {
+		return "waitlist"
+	}
+	return fmt.Sprintf("waitlist[%d]", i)
+}
+
+func setup(ctx context.Context, tk *toolkit) error {
+	if err := createLists(ctx, tk); err != nil {
+		return err
+	}
+	if err := createFields(ctx, tk); err != nil {
+		return err
+	}
+	return uploadTemplates(ctx, tk)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: toolkit [flags] <command>\n\ncommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", c.name, c.usage)
+	}
+	fmt.Fprintf(os.Stderr, "\nflags:\n")
+	flags.PrintDefaults()
 }
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/500k-agency/function/delivery"
+	"github.com/500k-agency/function/preview"
+	"github.com/500k-agency/function/product"
+)
+
+// previewTemplates renders the thank you email of every product in the
+// fixture session and writes them as html files
+func previewTemplates(ctx context.Context, tk *toolkit) error {
+	if err := product.Setup(tk.conf.Products, tk.conf.Sender, tk.conf.Brands); err != nil {
+		return err
+	}
+	if err := delivery.Setup(tk.conf.Delivery); err != nil {
+		return err
+	}
+
+	session, err := preview.ReadSession(*sessionFile)
+	if err != nil {
+		return err
+	}
+	emails, err := preview.PurchaseThankyou(*templatesDir, *templateName, session)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(*outDir, 0o755); err != nil {
+		return err
+	}
+	for i, e := range emails {
+		file := filepath.Join(*outDir, fmt.Sprintf("%s-%d.html", *templateName, i))
+		if err := os.WriteFile(file, []byte(e.HTML), 0o644); err != nil {
+			return err
+		}
+		fmt.Printf("rendered %q for %q: %s\n", *templateName, e.ProductName, file)
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/500k-agency/function/data"
+	"github.com/500k-agency/function/lib/sendgrid"
+	"github.com/500k-agency/function/product"
+)
+
+const templateExt = ".handlebars"
+
+// emailSlot is a template id in the config the toolkit can fill in
+type emailSlot struct {
+	path       string // table path, ie. products[0].purchase_thankyou
+	key        string
+	template   string // template file name without extension
+	templateID string
+}
+
+var titleRegexp = regexp.MustCompile(`(?is)<title>(.*?)</title>`)
+
+// emailSlots lists the template ids of the config, keyed to the template
+// file they are uploaded from
+func (tk *toolkit) emailSlots() []emailSlot {
+	var slots []emailSlot
+	for i, p := range tk.conf.Products {
+		if p.StripeID == "" {
+			continue
+		}
+		prefix := fmt.Sprintf("products[%d].", i)
+		slots = append(slots,
+			emailSlot{prefix + "purchase_thankyou", "template_id", product.TemplatePurchaseThankyou, p.PurchaseThankyou.TemplateID},
+			emailSlot{prefix + "refund", "template_id", product.TemplateRefund, p.Refund.TemplateID},
+			emailSlot{prefix + "subscription.welcome", "template_id", product.TemplateSubscriptionWelcome, p.Subscription.Welcome.TemplateID},
+			emailSlot{prefix + "subscription.dunning", "template_id", product.TemplateSubscriptionDunning, p.Subscription.Dunning.TemplateID},
+			emailSlot{prefix + "subscription.cancellation", "template_id", product.TemplateSubscriptionCancellation, p.Subscription.Cancellation.TemplateID},
+		)
+	}
+	for i, w := range tk.conf.Waitlists {
+		if w.DoubleOptIn {
+			slots = append(slots, emailSlot{tk.waitlistPath(i), "confirm_template_id", product.TemplateWaitlistConfirmation, w.ConfirmTemplateID})
+		}
+	}
+	if tk.conf.Operator.Email == "" {
+		return slots
+	}
+	slots = append(slots, emailSlot{"operator", "dispute_template_id", product.TemplateOperatorDispute, tk.conf.Operator.DisputeTemplateID})
+	return slots
+}
+
+// uploadTemplates uploads the template file of every declared email without
+// a template id as a dynamic template and writes the ids into the config.
+// A file used by several products is uploaded once.
+func uploadTemplates(ctx context.Context, tk *toolkit) error {
+	uploaded := map[string]string{}
+	for _, slot := range tk.emailSlots() {
+		if slot.templateID != "" || !tk.doc.HasTable(slot.path) {
+			continue
+		}
+
+		id, ok := uploaded[slot.template]
+		if !ok {
+			version, err := readTemplate(slot.template)
+			if errors.Is(err, os.ErrNotExist) {
+				fmt.Printf("skipping %s.%s: %v\n", slot.path, slot.key, err)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if id, err = tk.uploadTemplate(ctx, slot.template, version); err != nil {
+				return fmt.Errorf("uploading %s: %w", slot.template, err)
+			}
+			uploaded[slot.template] = id
+		}
+		tk.doc.Set(slot.path, slot.key, tomlString(id))
+	}
+	return nil
+}
+
+// deployTemplates publishes the template files of emails with a template id
+// as a new live version, when they differ from the live version
+func deployTemplates(ctx context.Context, tk *toolkit) error {
+	deployed := map[string]bool{}
+	for _, slot := range tk.emailSlots() {
+		if slot.templateID == "" || deployed[slot.templateID] {
+			continue
+		}
+		deployed[slot.templateID] = true
+
+		version, err := readTemplate(slot.template)
+		if errors.Is(err, os.ErrNotExist) {
+			fmt.Printf("skipping %s.%s: %v\n", slot.path, slot.key, err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		template, _, err := tk.client.Template.Get(ctx, slot.templateID)
+		if err != nil {
+			return fmt.Errorf("fetching %s: %w", slot.templateID, err)
+		}
+		if active := template.ActiveVersion(); active != nil &&
+			active.HTMLContent == version.HTMLContent &&
+			active.Subject == version.Subject &&
+			active.TestData == version.TestData {
+			fmt.Printf("template %q is up to date\n", slot.template)
+			continue
+		}
+
+		if tk.dryRun {
+			fmt.Printf("would deploy a new version of %q to %s\n", slot.template, slot.templateID)
+			continue
+		}
+		v, _, err := tk.client.Template.CreateVersion(ctx, slot.templateID, version)
+		if err != nil {
+			return fmt.Errorf("deploying %s: %w", slot.template, err)
+		}
+		fmt.Printf("deployed template %q: %s version %s\n", slot.template, slot.templateID, v.ID)
+	}
+	return nil
+}
+
+// readTemplate loads templates/<name>.handlebars as a live template version,
+// with the sample data of templates/<name>.json when present
+func readTemplate(name string) (*sendgrid.TemplateVersion, error) {
+	file := filepath.Join(*templatesDir, name+templateExt)
+	html, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	subject := data.ToSentenceCase(name)
+	if m := titleRegexp.FindStringSubmatch(string(html)); m != nil && strings.TrimSpace(m[1]) != "" {
+		subject = strings.TrimSpace(m[1])
+	}
+
+	testData, err := os.ReadFile(filepath.Join(*templatesDir, name+".json"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	return &sendgrid.TemplateVersion{
+		Active:               1,
+		Name:                 name,
+		Subject:              subject,
+		HTMLContent:          string(html),
+		GeneratePlainContent: true,
+		TestData:             string(testData),
+	}, nil
+}
+
+func (tk *toolkit) uploadTemplate(ctx context.Context, name string, version *sendgrid.TemplateVersion) (string, error) {
+	if tk.dryRun {
+		id := "<new template " + name + ">"
+		fmt.Printf("created template %q: %s\n", name, id)
+		return id, nil
+	}
+
+	template, _, err := tk.client.Template.Create(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	if _, _, err = tk.client.Template.CreateVersion(ctx, template.ID, version); err != nil {
+		return "", err
+	}
+	fmt.Printf("created template %q: %s\n", name, template.ID)
+	return template.ID, nil
+}
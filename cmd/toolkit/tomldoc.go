@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// tomlDoc edits values of a toml config in place, keeping its comments and
+// layout intact. Tables are addressed by path with array tables indexed,
+// ie. "products[1].purchase_thankyou".
+type tomlDoc struct {
+	lines []string
+}
+
+type tomlSection struct {
+	path   string
+	header int // line index of the table header, -1 for the root table
+	end    int // line index after the last line of the table
+}
+
+var (
+	tomlHeaderRegexp = regexp.MustCompile(`^\s*(\[\[?)\s*([A-Za-z0-9_.\-]+)\s*\]\]?\s*(#.*)?$`)
+	tomlKeyRegexp    = regexp.MustCompile(`^(\s*)([A-Za-z0-9_\-]+)(\s*=\s*)(.*)$`)
+)
+
+func newTomlDoc(src string) *tomlDoc {
+	return &tomlDoc{lines: strings.Split(src, "\n")}
+}
+
+func (d *tomlDoc) String() string {
+	return strings.Join(d.lines, "\n")
+}
+
+// sections resolves the path of every table in the document
+func (d *tomlDoc) sections() []tomlSection {
+	var (
+		sections = []tomlSection{{path: "", header: -1}}
+		arrays   = map[string]int{} // array table path -> element count
+	)
+
+	for i, line := range d.lines {
+		m := tomlHeaderRegexp.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		sections[len(sections)-1].end = i
+
+		// resolve each segment against the array tables seen so far
+		var path string
+		segments := strings.Split(m[2], ".")
+		for j, seg := range segments {
+			if path != "" {
+				path += "."
+			}
+			path += seg
+			if j == len(segments)-1 {
+				break
+			}
+			if n, ok := arrays[path]; ok {
+				path = fmt.Sprintf("%s[%d]", path, n-1)
+			}
+		}
+		if m[1] == "[[" {
+			arrays[path]++
+			path = fmt.Sprintf("%s[%d]", path, arrays[path]-1)
+		}
+		sections = append(sections, tomlSection{path: path, header: i})
+	}
+	sections[len(sections)-1].end = len(d.lines)
+	return sections
+}
+
+// HasTable reports whether the table at path is declared
+func (d *tomlDoc) HasTable(path string) bool {
+	for _, s := range d.sections() {
+		if s.path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// Set sets key to the toml encoded value in the table at path, declaring
+// the table if needed
+func (d *tomlDoc) Set(path, key, value string) {
+	sections := d.sections()
+	for _, s := range sections {
+		if s.path != path {
+			continue
+		}
+
+		last := s.header
+		for i := s.header + 1; i < s.end; i++ {
+			m := tomlKeyRegexp.FindStringSubmatch(d.lines[i])
+			if m == nil {
+				continue
+			}
+			end := tomlValueEnd(d.lines, i, len(m[1])+len(m[2])+len(m[3]))
+			if m[2] == key {
+				d.replaceValue(i, end, len(m[1])+len(m[2])+len(m[3]), value)
+				return
+			}
+			last = end
+		}
+		d.insert(last+1, fmt.Sprintf("%s = %s", key, value))
+		return
+	}
+
+	// declare the table after the last table of its parent
+	parent := path[:max(0, strings.LastIndex(path, "."))]
+	at := len(d.lines)
+	if parent != "" {
+		for _, s := range sections {
+			if s.path == parent || strings.HasPrefix(s.path, parent+".") {
+				at = s.end
+			}
+		}
+	}
+	for at > 0 && strings.TrimSpace(d.lines[at-1]) == "" {
+		at--
+	}
+	d.insert(at, "", fmt.Sprintf("[%s]", tomlIndexRegexp.ReplaceAllString(path, "")), fmt.Sprintf("%s = %s", key, value))
+}
+
+var tomlIndexRegexp = regexp.MustCompile(`\[\d+\]`)
+
+func (d *tomlDoc) insert(at int, lines ...string) {
+	d.lines = append(d.lines[:at], append(lines, d.lines[at:]...)...)
+}
+
+// replaceValue swaps the value starting at column col of line start and
+// ending on line end, keeping any trailing comment
+func (d *tomlDoc) replaceValue(start, end, col int, value string) {
+	last := d.lines[end]
+	comment := ""
+	if i := tomlCommentIndex(last); i >= 0 {
+		comment = last[i:]
+		// keep the spacing in front of the comment
+		pad := len(last[:i]) - len(strings.TrimRight(last[:i], " \t"))
+		comment = strings.Repeat(" ", max(pad, 1)) + comment
+	}
+	line := d.lines[start][:col] + value + comment
+	d.lines = append(d.lines[:start], append([]string{line}, d.lines[end+1:]...)...)
+}
+
+// tomlValueEnd returns the line a value starting at col of line i ends on,
+// following multiline arrays
+func tomlValueEnd(lines []string, i, col int) int {
+	depth := 0
+	for j := i; j < len(lines); j++ {
+		from := 0
+		if j == i {
+			from = col
+		}
+		depth += tomlBracketDepth(lines[j][from:])
+		if depth <= 0 {
+			return j
+		}
+	}
+	return len(lines) - 1
+}
+
+// tomlBracketDepth counts the unbalanced array brackets outside strings and
+// comments
+func tomlBracketDepth(s string) int {
+	depth := 0
+	var quote rune
+	for _, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#':
+			return depth
+		case r == '[':
+			depth++
+		case r == ']':
+			depth--
+		}
+	}
+	return depth
+}
+
+// tomlCommentIndex returns the index of the comment in s, or -1
+func tomlCommentIndex(s string) int {
+	var quote rune
+	for i, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#':
+			return i
+		}
+	}
+	return -1
+}
+
+func tomlString(s string) string {
+	return strconv.Quote(s)
+}
+
+func tomlStrings(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = tomlString(v)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const testConfig = `# function config
+env = "dev"
+
+[connect.sendgrid]
+app_id = "key" # sendgrid api key
+
+[[products]]
+id = "prod_1"
+list_ids = [
+  "a", # first
+  "b",
+] # lists
+[products.purchase_thankyou]
+template_id = ""
+
+[[products]]
+id = "prod_2"
+
+[[waitlist]]
+form_id = "f1"
+
+[[waitlist]]
+form_id = "f2"
+`
+
+func TestTomlDocSections(t *testing.T) {
+	var paths []string
+	for _, s := range newTomlDoc(testConfig).sections() {
+		paths = append(paths, s.path)
+	}
+	want := []string{"", "connect.sendgrid", "products[0]", "products[0].purchase_thankyou", "products[1]", "waitlist[0]", "waitlist[1]"}
+	if strings.Join(paths, " ") != strings.Join(want, " ") {
+		t.Errorf("got %v, want %v", paths, want)
+	}
+}
+
+func TestTomlDocSet(t *testing.T) {
+	tests := []struct {
+		name       string
+		path, key  string
+		value      string
+		wantLines  []string
+		wantAbsent string
+	}{
+		{
+			name: "replace keeps the comment",
+			path: "connect.sendgrid", key: "app_id", value: `"new"`,
+			wantLines: []string{`app_id = "new" # sendgrid api key`},
+		},
+		{
+			name: "root table",
+			path: "", key: "env", value: `"prod"`,
+			wantLines: []string{`env = "prod"`},
+		},
+		{
+			name: "replace multiline array",
+			path: "products[0]", key: "list_ids", value: `["c"]`,
+			wantLines:  []string{`list_ids = ["c"] # lists`, `[products.purchase_thankyou]`},
+			wantAbsent: `"a", # first`,
+		},
+		{
+			name: "nested array table",
+			path: "products[0].purchase_thankyou", key: "template_id", value: `"d-1"`,
+			wantLines: []string{`template_id = "d-1"`},
+		},
+		{
+			name: "new key after the last key",
+			path: "products[1]", key: "list_ids", value: `["x"]`,
+			wantLines: []string{`id = "prod_2"`, `list_ids = ["x"]`},
+		},
+		{
+			name: "new key after a multiline array",
+			path: "products[0]", key: "name", value: `"Guide"`,
+			wantLines: []string{`] # lists`, `name = "Guide"`, `[products.purchase_thankyou]`},
+		},
+		{
+			name: "new table in an array table",
+			path: "products[1].purchase_thankyou", key: "template_id", value: `"d-2"`,
+			wantLines: []string{`id = "prod_2"`, ``, `[products.purchase_thankyou]`, `template_id = "d-2"`, ``, `[[waitlist]]`},
+		},
+		{
+			name: "new table after its siblings",
+			path: "products[0].optin", key: "template_id", value: `"d-3"`,
+			wantLines: []string{`template_id = ""`, ``, `[products.optin]`, `template_id = "d-3"`, ``, `[[products]]`},
+		},
+		{
+			name: "new table next to its parent",
+			path: "connect.postmark", key: "server_token", value: `"t"`,
+			wantLines: []string{`app_id = "key" # sendgrid api key`, ``, `[connect.postmark]`, `server_token = "t"`, ``, `[[products]]`},
+		},
+		{
+			name: "new top level table",
+			path: "delivery", key: "secret", value: `"s"`,
+			wantLines: []string{`form_id = "f2"`, ``, `[delivery]`, `secret = "s"`},
+		},
+		{
+			name: "waitlist element",
+			path: "waitlist[1]", key: "list_id", value: `"l2"`,
+			wantLines: []string{`form_id = "f2"`, `list_id = "l2"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTomlDoc(testConfig)
+			d.Set(tt.path, tt.key, tt.value)
+			got := d.String()
+			if !strings.Contains(got, strings.Join(tt.wantLines, "\n")) {
+				t.Errorf("missing\n%s\nin\n%s", strings.Join(tt.wantLines, "\n"), got)
+			}
+			if tt.wantAbsent != "" && strings.Contains(got, tt.wantAbsent) {
+				t.Errorf("%q left behind in\n%s", tt.wantAbsent, got)
+			}
+
+			// setting the same value again changes nothing
+			again := newTomlDoc(got)
+			again.Set(tt.path, tt.key, tt.value)
+			if again.String() != got {
+				t.Errorf("second Set changed the document:\n%s", again.String())
+			}
+		})
+	}
+}
+
+func TestTomlDocUntouched(t *testing.T) {
+	if got := newTomlDoc(testConfig).String(); got != testConfig {
+		t.Errorf("round trip changed the document:\n%s", got)
+	}
+}
+
+func TestTomlValueEnd(t *testing.T) {
+	lines := []string{
+		`a = ["x]", # "[" ]`,
+		`  'y',`,
+		`]`,
+		`b = "[" # [`,
+	}
+	if got := tomlValueEnd(lines, 0, 4); got != 2 {
+		t.Errorf("multiline array ends on %d, want 2", got)
+	}
+	if got := tomlValueEnd(lines, 3, 4); got != 3 {
+		t.Errorf("string ends on %d, want 3", got)
+	}
+	if got := tomlCommentIndex(lines[3]); got != 8 {
+		t.Errorf("comment at %d, want 8", got)
+	}
+}
+
+func TestWaitlistPath(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"array tables", "[[waitlist]]\nform_id = \"f1\"\n\n[[waitlist]]\nform_id = \"f2\"\n", "waitlist[1]"},
+		{"legacy table", "[waitlist]\nform_id = \"f1\"\n", "waitlist"},
+		{"none yet", "env = \"dev\"\n", "waitlist[1]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tk := &toolkit{doc: newTomlDoc(tt.src)}
+			if got := tk.waitlistPath(1); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// the legacy table is updated in place, not turned into an array table
+	tk := &toolkit{doc: newTomlDoc("[waitlist]\nform_id = \"f1\"\n")}
+	tk.doc.Set(tk.waitlistPath(0), "list_id", `"l1"`)
+	if got, want := tk.doc.String(), "[waitlist]\nform_id = \"f1\"\nlist_id = \"l1\"\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestWriteDiff(t *testing.T) {
+	a := "one\ntwo\nthree\nfour\nfive\nsix\nseven\neight\nnine"
+	b := "one\ntwo\nthree\nFOUR\nfive\nsix\nseven\neight\nnine\nten"
+
+	var buf bytes.Buffer
+	writeDiff(&buf, "function.conf", a, b)
+	want := `--- function.conf
++++ function.conf
+  two
+  three
+- four
++ FOUR
+  five
+  six
+@@
+  eight
+  nine
++ ten
+`
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
@@ -4,7 +4,10 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/500k-agency/function/delivery"
+	"github.com/500k-agency/function/emailevents"
 	"github.com/500k-agency/function/lib/connect"
+	"github.com/500k-agency/function/lib/eventstore"
 	"github.com/500k-agency/function/product"
 	"github.com/500k-agency/function/waitlist"
 
@@ -18,11 +21,38 @@ type Config struct {
 	// [connect]
 	Connect connect.Configs `toml:"connect"`
 
+	// [eventstore]
+	EventStore eventstore.Config `toml:"eventstore"`
+
+	// [sender]
+	Sender product.SenderConfig `toml:"sender"`
+
+	// [[brands]]
+	Brands []product.BrandConfig `toml:"brands"`
+
 	// [products]
 	Products []product.Config `toml:"products"`
 
-	// [waitlist]
-	Waitlist waitlist.Config `toml:"waitlist"`
+	// [contact_fields]
+	ContactFields product.ContactFieldsConfig `toml:"contact_fields"`
+
+	// [operator]
+	Operator product.OperatorConfig `toml:"operator"`
+
+	// [delivery]
+	Delivery delivery.Config `toml:"delivery"`
+
+	// [emailevents]
+	EmailEvents emailevents.Config `toml:"emailevents"`
+
+	// [[waitlist]], one per tally form
+	Waitlists waitlist.Configs `toml:"waitlist"`
+
+	// [optin], double opt-in confirmation links
+	OptIn waitlist.OptInConfig `toml:"optin"`
+
+	// [referrals], referral codes and counts of the waitlists
+	Referrals waitlist.StoreConfig `toml:"referrals"`
 }
 
 // NewFromSecrets instantiates the config struct from secrets
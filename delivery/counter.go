@@ -0,0 +1,108 @@
+package delivery
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/500k-agency/function/lib/firestore"
+	"github.com/500k-agency/function/lib/jsonstore"
+)
+
+// StoreConfig holds the download counter store configuration. Only the
+// firestore driver enforces the limit across cold starts.
+type StoreConfig struct {
+	Driver     string `toml:"driver"`      // memory (default), file or firestore
+	Path       string `toml:"path"`        // file driver: path to the store file
+	ProjectID  string `toml:"project_id"`  // firestore driver: gcp project
+	DatabaseID string `toml:"database_id"` // firestore driver: defaults to (default)
+	Collection string `toml:"collection"`  // firestore driver: defaults to downloads
+}
+
+// Counter counts downloads per token
+type Counter interface {
+	// Increment bumps the download count of the token and returns the new
+	// count. expiresAt lets the store drop counts of expired tokens.
+	Increment(ctx context.Context, id string, expiresAt time.Time) (int, error)
+}
+
+// NewCounter instantiates a download counter for the configured driver
+func NewCounter(conf StoreConfig) (Counter, error) {
+	switch conf.Driver {
+	case "", "memory":
+		return &localCounter{counts: jsonstore.NewMemory[count]()}, nil
+	case "file":
+		counts, err := jsonstore.NewFile[count](conf.Path)
+		if err != nil {
+			return nil, fmt.Errorf("delivery: %w", err)
+		}
+		return &localCounter{counts: counts}, nil
+	case "firestore":
+		client, err := firestore.New(conf.ProjectID, conf.DatabaseID)
+		if err != nil {
+			return nil, fmt.Errorf("delivery: %w", err)
+		}
+		collection := conf.Collection
+		if collection == "" {
+			collection = "downloads"
+		}
+		return &firestoreCounter{client: client, collection: collection}, nil
+	}
+	return nil, fmt.Errorf("delivery: unknown store driver %q", conf.Driver)
+}
+
+type count struct {
+	N         int       `json:"n"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// increment bumps id in counts and drops expired entries
+func increment(counts map[string]count, id string, expiresAt time.Time) int {
+	now := time.Now()
+	for k, v := range counts {
+		if now.After(v.ExpiresAt) {
+			delete(counts, k)
+		}
+	}
+	c := counts[id]
+	c.N++
+	c.ExpiresAt = expiresAt
+	counts[id] = c
+	return c.N
+}
+
+// localCounter counts downloads in memory or in a json file
+type localCounter struct {
+	counts *jsonstore.Store[count]
+}
+
+func (s *localCounter) Increment(ctx context.Context, id string, expiresAt time.Time) (int, error) {
+	var n int
+	err := s.counts.Update(func(counts map[string]count) error {
+		n = increment(counts, id, expiresAt)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("delivery: %w", err)
+	}
+	return n, nil
+}
+
+// firestoreCounter counts downloads in a Firestore document per token,
+// incremented atomically so every instance shares the count. Set a TTL
+// policy on the expiresAt field to drop counts of expired tokens.
+type firestoreCounter struct {
+	client     *firestore.Client
+	collection string
+}
+
+func (s *firestoreCounter) Increment(ctx context.Context, id string, expiresAt time.Time) (int, error) {
+	doc := &firestore.Document{Fields: map[string]firestore.Value{
+		"expiresAt": firestore.Timestamp(expiresAt),
+	}}
+	n, err := s.client.Increment(ctx, s.collection, id, "n", 1, doc)
+	if err != nil {
+		return 0, fmt.Errorf("delivery: %w", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,199 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/500k-agency/function/lib/token"
+)
+
+const (
+	defaultTTL          = 72 * time.Hour
+	defaultMaxDownloads = 5
+)
+
+var (
+	ErrDisabled      = errors.New("signed delivery is not configured")
+	ErrDownloadLimit = errors.New("download limit reached")
+)
+
+// Config holds the signed download link configuration
+type Config struct {
+	// secret download tokens are sealed with, delivery is disabled when empty
+	Secret string `toml:"secret"`
+
+	// public url of the DownloadHandler function
+	BaseURL string `toml:"base_url"`
+
+	// how long a link stays valid, defaults to 72 hours
+	TTLHours int `toml:"ttl_hours"`
+
+	// downloads allowed per link, defaults to 5. -1 for unlimited
+	MaxDownloads int `toml:"max_downloads"`
+
+	// download count store
+	Store StoreConfig `toml:"store"`
+}
+
+// Claims are sealed into every download token, so the customer's email and
+// session cannot be read from the link
+type Claims struct {
+	SessionID    string `json:"sid"`
+	Email        string `json:"email"`
+	ProductID    string `json:"pid"`
+	MaxDownloads int    `json:"max,omitempty"`
+	Expiry       int64  `json:"exp"`
+}
+
+func (c *Claims) ExpiresAt() time.Time {
+	return time.Unix(c.Expiry, 0)
+}
+
+type delivery struct {
+	conf    Config
+	counter Counter
+}
+
+var (
+	mu         sync.Mutex
+	deliveries *delivery
+)
+
+// Setup configures signed delivery. Calling it again with the same config
+// keeps the existing download counters.
+func Setup(conf Config) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if deliveries != nil && deliveries.conf == conf {
+		return nil
+	}
+	if conf.Secret == "" {
+		deliveries = nil
+		return nil
+	}
+	if conf.BaseURL == "" {
+		return errors.New("delivery: base_url is required")
+	}
+	if _, err := url.Parse(conf.BaseURL); err != nil {
+		return fmt.Errorf("delivery: invalid base_url: %w", err)
+	}
+
+	counter, err := NewCounter(conf.Store)
+	if err != nil {
+		return err
+	}
+	deliveries = &delivery{conf: conf, counter: counter}
+	return nil
+}
+
+// Enabled reports whether signed download links are configured
+func Enabled() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return deliveries != nil
+}
+
+// IssueURL creates a sealed download link for the customer's purchase of
+// the product. maxDownloads overrides the configured limit when non-zero.
+func IssueURL(sessionID, email, productID string, maxDownloads int) (string, error) {
+	mu.Lock()
+	d := deliveries
+	mu.Unlock()
+	if d == nil {
+		return "", ErrDisabled
+	}
+
+	if maxDownloads == 0 {
+		maxDownloads = d.conf.maxDownloads()
+	}
+	claims := &Claims{
+		SessionID:    sessionID,
+		Email:        email,
+		ProductID:    productID,
+		MaxDownloads: maxDownloads,
+		Expiry:       time.Now().Add(d.conf.ttl()).Unix(),
+	}
+	tok, err := token.Seal(claims, d.conf.Secret)
+	if err != nil {
+		return "", err
+	}
+
+	u, _ := url.Parse(d.conf.BaseURL)
+	q := u.Query()
+	q.Set("token", tok)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// Verify opens the download token without counting a download
+func Verify(tok string) (*Claims, error) {
+	mu.Lock()
+	d := deliveries
+	mu.Unlock()
+	if d == nil {
+		return nil, ErrDisabled
+	}
+	return d.verify(tok)
+}
+
+// Redeem verifies the download token and counts the download against the
+// token's limit. Call it once the asset is ready to be sent, a download
+// that fails before is not counted.
+func Redeem(ctx context.Context, tok string) (*Claims, error) {
+	mu.Lock()
+	d := deliveries
+	mu.Unlock()
+	if d == nil {
+		return nil, ErrDisabled
+	}
+
+	claims, err := d.verify(tok)
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := d.counter.Increment(ctx, token.ID(tok), claims.ExpiresAt())
+	if err != nil {
+		return nil, err
+	}
+	if claims.MaxDownloads > 0 && count > claims.MaxDownloads {
+		return nil, ErrDownloadLimit
+	}
+	return claims, nil
+}
+
+func (d *delivery) verify(tok string) (*Claims, error) {
+	claims := &Claims{}
+	if strings.Contains(tok, ".") {
+		// signed links emailed before tokens were sealed, valid until they
+		// expire
+		if err := token.Verify(tok, d.conf.Secret, claims); err != nil {
+			return nil, err
+		}
+		return claims, nil
+	}
+	if err := token.Open(tok, d.conf.Secret, claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (c Config) ttl() time.Duration {
+	if c.TTLHours > 0 {
+		return time.Duration(c.TTLHours) * time.Hour
+	}
+	return defaultTTL
+}
+
+func (c Config) maxDownloads() int {
+	if c.MaxDownloads == 0 {
+		return defaultMaxDownloads
+	}
+	return c.MaxDownloads
+}
@@ -0,0 +1,223 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/500k-agency/function/lib/firestore/firestoretest"
+	"github.com/500k-agency/function/lib/token"
+)
+
+func setup(t *testing.T, conf Config) {
+	t.Helper()
+	if err := Setup(conf); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { Setup(Config{}) })
+}
+
+// tokenOf returns the token of a download link
+func tokenOf(t *testing.T, link string) string {
+	t.Helper()
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Query().Get("token")
+}
+
+func TestRedeem(t *testing.T) {
+	stores := []struct {
+		name  string
+		store func(t *testing.T) StoreConfig
+	}{
+		{"memory", func(t *testing.T) StoreConfig { return StoreConfig{} }},
+		{"file", func(t *testing.T) StoreConfig {
+			return StoreConfig{Driver: "file", Path: filepath.Join(t.TempDir(), "downloads.json")}
+		}},
+		{"firestore", func(t *testing.T) StoreConfig {
+			firestoretest.NewServer(t)
+			return StoreConfig{Driver: "firestore", ProjectID: firestoretest.ProjectID}
+		}},
+	}
+	for _, s := range stores {
+		t.Run(s.name, func(t *testing.T) {
+			setup(t, Config{Secret: "s3cret", BaseURL: "https://example.com/download?x=1", MaxDownloads: 2, Store: s.store(t)})
+			ctx := context.Background()
+
+			link, err := IssueURL("cs_1", "ada@example.com", "prod_1", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(link, "https://example.com/download?") || !strings.Contains(link, "x=1") {
+				t.Errorf("link %s", link)
+			}
+			if strings.Contains(link, "ada@example.com") || strings.Contains(link, "ada%40example.com") {
+				t.Errorf("link %s reveals the email", link)
+			}
+			tok := tokenOf(t, link)
+
+			// verifying counts nothing
+			for i := 0; i < 3; i++ {
+				if _, err := Verify(tok); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for i := 0; i < 2; i++ {
+				claims, err := Redeem(ctx, tok)
+				if err != nil {
+					t.Fatalf("download %d: %v", i+1, err)
+				}
+				if claims.SessionID != "cs_1" || claims.Email != "ada@example.com" || claims.ProductID != "prod_1" || claims.MaxDownloads != 2 {
+					t.Errorf("claims %+v", claims)
+				}
+			}
+			if _, err := Redeem(ctx, tok); !errors.Is(err, ErrDownloadLimit) {
+				t.Errorf("third download: got %v, want ErrDownloadLimit", err)
+			}
+
+			// a limit set per product, counted per link
+			link, _ = IssueURL("cs_1", "ada@example.com", "prod_2", 1)
+			if _, err := Redeem(ctx, tokenOf(t, link)); err != nil {
+				t.Errorf("another link: %v", err)
+			}
+		})
+	}
+}
+
+func TestRedeemTokens(t *testing.T) {
+	setup(t, Config{Secret: "s3cret", BaseURL: "https://example.com/download", MaxDownloads: -1})
+	ctx := context.Background()
+
+	unlimited, _ := IssueURL("cs_1", "ada@example.com", "prod_1", 0)
+	legacy, _ := token.Sign(&Claims{SessionID: "cs_1", ProductID: "prod_1", Expiry: time.Now().Add(time.Hour).Unix()}, "s3cret")
+	expired, _ := token.Seal(&Claims{SessionID: "cs_1", Expiry: time.Now().Add(-time.Hour).Unix()}, "s3cret")
+	foreign, _ := token.Seal(&Claims{SessionID: "cs_1", Expiry: time.Now().Add(time.Hour).Unix()}, "other")
+
+	tests := []struct {
+		name  string
+		token string
+		times int
+		want  error
+	}{
+		{"unlimited", tokenOf(t, unlimited), 10, nil},
+		{"signed before tokens were sealed", legacy, 1, nil},
+		{"expired", expired, 1, token.ErrExpired},
+		{"other secret", foreign, 1, token.ErrInvalidSignature},
+		{"garbage", "nope", 1, token.ErrMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < tt.times; i++ {
+				if _, err := Redeem(ctx, tt.token); !errors.Is(err, tt.want) {
+					t.Fatalf("got %v, want %v", err, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSetup(t *testing.T) {
+	t.Cleanup(func() { Setup(Config{}) })
+
+	if err := Setup(Config{}); err != nil || Enabled() {
+		t.Errorf("without a secret: %v, enabled %v", err, Enabled())
+	}
+	if _, err := IssueURL("cs_1", "a@example.com", "prod_1", 0); !errors.Is(err, ErrDisabled) {
+		t.Errorf("IssueURL while disabled: got %v, want ErrDisabled", err)
+	}
+	if err := Setup(Config{Secret: "s3cret"}); err == nil {
+		t.Error("accepted a config without base_url")
+	}
+	if err := Setup(Config{Secret: "s3cret", BaseURL: "https://example.com", Store: StoreConfig{Driver: "file"}}); err == nil {
+		t.Error("accepted a file store without a path")
+	}
+}
+
+func TestOpenAsset(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing.pdf" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("X-Secret", "internal")
+		w.Write([]byte("%PDF"))
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	d, err := OpenAsset(ctx, srv.URL+"/books/guide.pdf?sig=abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	if err := d.Stream(rec); err != nil {
+		t.Fatal(err)
+	}
+	d.Close()
+
+	if rec.Code != http.StatusOK || rec.Body.String() != "%PDF" {
+		t.Errorf("streamed %d %q", rec.Code, rec.Body.String())
+	}
+	headers := map[string]string{
+		"Content-Type":        "application/pdf",
+		"Content-Length":      "4",
+		"Content-Disposition": "attachment; filename=guide.pdf",
+	}
+	for k, want := range headers {
+		if got := rec.Header().Get(k); got != want {
+			t.Errorf("%s: %q, want %q", k, got, want)
+		}
+	}
+	if rec.Header().Get("X-Secret") != "" {
+		t.Error("copied an upstream header")
+	}
+
+	for _, u := range []string{srv.URL + "/missing.pdf", "http://127.0.0.1:1/closed.pdf", "::"} {
+		if _, err := OpenAsset(ctx, u); !errors.Is(err, ErrAssetUnavailable) {
+			t.Errorf("%s: got %v, want ErrAssetUnavailable", u, err)
+		}
+	}
+}
+
+func TestFetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("%PDF-1.7 guide"))
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	asset, err := Fetch(ctx, srv.URL+"/guide.pdf", 1<<10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if asset.Name != "guide.pdf" || asset.ContentType != "application/pdf" || string(asset.Body) != "%PDF-1.7 guide" {
+		t.Errorf("fetched %+v", asset)
+	}
+	if _, err := Fetch(ctx, srv.URL+"/guide.pdf", 4); !errors.Is(err, ErrAssetTooLarge) {
+		t.Errorf("got %v, want ErrAssetTooLarge", err)
+	}
+}
+
+func TestAssetName(t *testing.T) {
+	tests := map[string]string{
+		"https://cdn.example.com/a/guide.pdf":        "guide.pdf",
+		"https://cdn.example.com/a/guide.pdf?sig=1":  "guide.pdf",
+		"https://cdn.example.com/my%20guide.pdf#top": "my guide.pdf",
+		"https://cdn.example.com/":                   "",
+		"https://cdn.example.com":                    "",
+	}
+	for u, want := range tests {
+		if got := assetName(u); got != want {
+			t.Errorf("assetName(%q) = %q, want %q", u, got, want)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+)
+
+var streamClient = &http.Client{Timeout: 5 * time.Minute}
+
+// ErrAssetUnavailable is returned when the asset cannot be fetched, before
+// anything is written to the customer
+var ErrAssetUnavailable = errors.New("asset unavailable")
+
+// Download is an asset fetched for streaming, its body is still unread
+type Download struct {
+	name string
+	resp *http.Response
+}
+
+// OpenAsset fetches the asset, failing with ErrAssetUnavailable on network
+// errors and non 200 responses
+func OpenAsset(ctx context.Context, assetURL string) (*Download, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, assetURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("delivery: %w: %v", ErrAssetUnavailable, err)
+	}
+	resp, err := streamClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("delivery: %w: %v", ErrAssetUnavailable, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("delivery: %w: status %d", ErrAssetUnavailable, resp.StatusCode)
+	}
+	return &Download{name: assetName(assetURL), resp: resp}, nil
+}
+
+// Stream proxies the asset to w as an attachment, so the asset url itself
+// is never revealed to the customer. Headers are sent by then, errors can
+// only be logged.
+func (d *Download) Stream(w http.ResponseWriter) error {
+	for _, h := range []string{"Content-Type", "Content-Length", "Last-Modified"} {
+		if v := d.resp.Header.Get(h); v != "" {
+			w.Header().Set(h, v)
+		}
+	}
+	if d.name != "" {
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": d.name}))
+	}
+	w.WriteHeader(http.StatusOK)
+
+	_, err := io.Copy(w, d.resp.Body)
+	return err
+}
+
+func (d *Download) Close() error {
+	return d.resp.Body.Close()
+}
+
+// ErrAssetTooLarge is returned by Fetch for assets over the size limit
+var ErrAssetTooLarge = errors.New("asset too large")
+
+// Asset is a file fetched from an asset url
+type Asset struct {
+	Name        string
+	ContentType string
+	Body        []byte
+}
+
+// Fetch downloads the asset into memory, ie. to attach it to an email,
+// failing with ErrAssetTooLarge past maxBytes
+func Fetch(ctx context.Context, assetURL string, maxBytes int64) (*Asset, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, assetURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := streamClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("delivery: fetching asset: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("delivery: fetching asset: status %d", resp.StatusCode)
+	}
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("delivery: fetching asset: %w", err)
+	}
+	if int64(len(b)) > maxBytes {
+		return nil, fmt.Errorf("delivery: %w: over %d bytes", ErrAssetTooLarge, maxBytes)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(b)
+	}
+	return &Asset{
+		Name:        assetName(assetURL),
+		ContentType: contentType,
+		Body:        b,
+	}, nil
+}
+
+// assetName returns the file name of the asset url, or an empty string
+func assetName(assetURL string) string {
+	u, err := url.Parse(assetURL)
+	if err != nil {
+		return ""
+	}
+	if name := path.Base(u.Path); name != "" && name != "/" && name != "." {
+		return name
+	}
+	return ""
+}
@@ -0,0 +1,211 @@
+package emailevents
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/500k-agency/function/lib/connect"
+	"github.com/500k-agency/function/lib/sendgrid"
+	"github.com/500k-agency/function/product"
+)
+
+const (
+	ActionRemoveFromLists = "remove_from_lists"
+	ActionDeleteContact   = "delete_contact"
+	ActionRecordStatus    = "record_status"
+
+	defaultTolerance = 10 * time.Minute
+)
+
+var (
+	ErrDisabled      = errors.New("email event webhook is not configured")
+	ErrUnknownAction = errors.New("unknown email event action")
+	ErrStatusDenied  = errors.New("invalid delivery status secret")
+)
+
+// Config holds the SendGrid event webhook configuration
+type Config struct {
+	// verification key of the signed event webhook, the handler is disabled
+	// when empty
+	PublicKey string `toml:"public_key"`
+
+	// max age of a delivery's signature timestamp, defaults to 10 minutes.
+	// -1 to disable
+	ToleranceSeconds int `toml:"tolerance_seconds"`
+
+	// what to do on which events
+	Actions []ActionConfig `toml:"actions"`
+
+	// delivery status store
+	Store StoreConfig `toml:"store"`
+
+	// bearer token of delivery status lookups, see GetStatus. lookups are
+	// refused when empty
+	StatusSecret string `toml:"status_secret"`
+}
+
+// ActionConfig runs an action on the listed events
+type ActionConfig struct {
+	// event types, ie. bounce, dropped, spamreport or unsubscribe
+	Events []string `toml:"events"`
+
+	// remove_from_lists, delete_contact or record_status
+	Action string `toml:"action"`
+
+	// remove_from_lists: lists the contact is removed from
+	ListIDs []string `toml:"list_ids"`
+}
+
+func (c Config) tolerance() time.Duration {
+	switch {
+	case c.ToleranceSeconds < 0:
+		return 0
+	case c.ToleranceSeconds > 0:
+		return time.Duration(c.ToleranceSeconds) * time.Second
+	}
+	return defaultTolerance
+}
+
+type webhook struct {
+	conf   Config
+	key    *ecdsa.PublicKey
+	status StatusStore
+}
+
+var (
+	mu    sync.Mutex
+	hooks *webhook
+)
+
+// Setup configures the event webhook. Calling it again with the same config
+// keeps the existing status store.
+func Setup(conf Config) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if hooks != nil && reflect.DeepEqual(hooks.conf, conf) {
+		return nil
+	}
+	if conf.PublicKey == "" {
+		hooks = nil
+		return nil
+	}
+
+	key, err := sendgrid.ParseVerificationKey(conf.PublicKey)
+	if err != nil {
+		return fmt.Errorf("emailevents: %w", err)
+	}
+	for _, a := range conf.Actions {
+		switch a.Action {
+		case ActionRemoveFromLists:
+			if len(a.ListIDs) == 0 {
+				return fmt.Errorf("emailevents: %s requires list_ids", a.Action)
+			}
+		case ActionDeleteContact, ActionRecordStatus:
+		default:
+			return fmt.Errorf("emailevents: %w %q", ErrUnknownAction, a.Action)
+		}
+	}
+
+	status, err := NewStatusStore(conf.Store)
+	if err != nil {
+		return err
+	}
+	hooks = &webhook{conf: conf, key: key, status: status}
+	return nil
+}
+
+func current() (*webhook, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if hooks == nil {
+		return nil, ErrDisabled
+	}
+	return hooks, nil
+}
+
+// ConstructEvents verifies the signature of a webhook delivery and decodes
+// its batch of events
+func ConstructEvents(payload []byte, signature, timestamp string) ([]*sendgrid.WebhookEvent, error) {
+	h, err := current()
+	if err != nil {
+		return nil, err
+	}
+	if err := sendgrid.VerifyWebhookSignature(h.key, payload, signature, timestamp, h.conf.tolerance()); err != nil {
+		return nil, err
+	}
+	return sendgrid.ParseWebhookEvents(payload)
+}
+
+// Handle runs the configured actions for the event
+func Handle(ctx context.Context, ev *sendgrid.WebhookEvent) error {
+	h, err := current()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, a := range h.conf.Actions {
+		if !a.matches(ev.Event) {
+			continue
+		}
+		if err := h.run(ctx, a, ev); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", a.Action, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (a ActionConfig) matches(event sendgrid.Event) bool {
+	for _, v := range a.Events {
+		if sendgrid.Event(v) == event {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *webhook) run(ctx context.Context, a ActionConfig, ev *sendgrid.WebhookEvent) error {
+	switch a.Action {
+	case ActionRemoveFromLists:
+		return connect.Contacts.RemoveContact(ctx, ev.Email, a.ListIDs)
+	case ActionDeleteContact:
+		return connect.Contacts.DeleteContact(ctx, ev.Email)
+	case ActionRecordStatus:
+		sessionID := ev.CustomArgs[product.CustomArgSessionID]
+		productID := ev.CustomArgs[product.CustomArgProductID]
+		if sessionID == "" {
+			// not a purchase email
+			return nil
+		}
+		return h.status.Record(ctx, StatusKey(sessionID, productID), Status{
+			Event:     string(ev.Event),
+			Email:     ev.Email,
+			Reason:    ev.Reason,
+			SessionID: sessionID,
+			ProductID: productID,
+			Timestamp: time.Unix(ev.Timestamp, 0).UTC(),
+		})
+	}
+	return fmt.Errorf("%w %q", ErrUnknownAction, a.Action)
+}
+
+// GetStatus returns the latest recorded delivery status of the purchase
+// email for the product bought in the checkout session. secret must match
+// the configured status_secret, statuses hold the buyer's email.
+func GetStatus(ctx context.Context, secret, sessionID, productID string) (*Status, error) {
+	h, err := current()
+	if err != nil {
+		return nil, err
+	}
+	if h.conf.StatusSecret == "" || subtle.ConstantTimeCompare([]byte(secret), []byte(h.conf.StatusSecret)) != 1 {
+		return nil, ErrStatusDenied
+	}
+	return h.status.Get(ctx, StatusKey(sessionID, productID))
+}
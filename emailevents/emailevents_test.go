@@ -0,0 +1,202 @@
+package emailevents
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/500k-agency/function/lib/firestore/firestoretest"
+	"github.com/500k-agency/function/lib/sendgrid"
+)
+
+// newKey returns a signing key and its verification key as configured in
+// the event webhook settings
+func newKey(t *testing.T) (*ecdsa.PrivateKey, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, base64.StdEncoding.EncodeToString(der)
+}
+
+func sign(t *testing.T, key *ecdsa.PrivateKey, payload []byte, timestamp string) string {
+	t.Helper()
+	h := sha256.Sum256(append([]byte(timestamp), payload...))
+	sig, err := ecdsa.SignASN1(rand.Reader, key, h[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(sig)
+}
+
+func TestConstructEvents(t *testing.T) {
+	key, pub := newKey(t)
+	other, _ := newKey(t)
+	if err := Setup(Config{PublicKey: pub}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { Setup(Config{}) })
+
+	payload := []byte(`[{"email":"ada@example.com","event":"bounce","sg_event_id":"e1","session_id":"cs_1"}]`)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+
+	tests := []struct {
+		name      string
+		payload   []byte
+		signature string
+		timestamp string
+		want      error
+	}{
+		{"valid", payload, sign(t, key, payload, now), now, nil},
+		{"no signature", payload, "", now, sendgrid.ErrNoSignature},
+		{"other key", payload, sign(t, other, payload, now), now, sendgrid.ErrInvalidSignature},
+		{"tampered payload", []byte(`[{"event":"delivered"}]`), sign(t, key, payload, now), now, sendgrid.ErrInvalidSignature},
+		{"not base64", payload, "!", now, sendgrid.ErrInvalidSignature},
+		{"stale timestamp", payload, sign(t, key, payload, old), old, sendgrid.ErrTimestampOutsideWindow},
+		{"bad timestamp", payload, sign(t, key, payload, "x"), "x", sendgrid.ErrInvalidWebhookTimestamp},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := ConstructEvents(tt.payload, tt.signature, tt.timestamp)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			if err == nil && (len(events) != 1 || events[0].CustomArgs["session_id"] != "cs_1") {
+				t.Errorf("got events %+v", events)
+			}
+		})
+	}
+
+	Setup(Config{})
+	if _, err := ConstructEvents(payload, sign(t, key, payload, now), now); !errors.Is(err, ErrDisabled) {
+		t.Errorf("without a key: got %v, want ErrDisabled", err)
+	}
+}
+
+// errAny expects an error without a sentinel to match
+var errAny = errors.New("any error")
+
+func TestSetup(t *testing.T) {
+	_, pub := newKey(t)
+	t.Cleanup(func() { Setup(Config{}) })
+
+	tests := []struct {
+		name string
+		conf Config
+		want error
+	}{
+		{"disabled", Config{}, nil},
+		{"record status", Config{PublicKey: pub, Actions: []ActionConfig{{Action: ActionRecordStatus}}}, nil},
+		{"bad key", Config{PublicKey: "bm9wZQ=="}, sendgrid.ErrInvalidVerificationKey},
+		{"unknown action", Config{PublicKey: pub, Actions: []ActionConfig{{Action: "archive"}}}, ErrUnknownAction},
+		{"list ids required", Config{PublicKey: pub, Actions: []ActionConfig{{Action: ActionRemoveFromLists}}}, errAny},
+		{"unknown driver", Config{PublicKey: pub, Store: StoreConfig{Driver: "redis"}}, errAny},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Setup(tt.conf)
+			if tt.want == errAny && err != nil {
+				return
+			}
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordAndGetStatus(t *testing.T) {
+	_, pub := newKey(t)
+	tests := []struct {
+		name  string
+		store func(t *testing.T) StoreConfig
+	}{
+		{"memory", func(t *testing.T) StoreConfig { return StoreConfig{} }},
+		{"file", func(t *testing.T) StoreConfig {
+			return StoreConfig{Driver: "file", Path: filepath.Join(t.TempDir(), "status.json")}
+		}},
+		{"firestore", func(t *testing.T) StoreConfig {
+			firestoretest.NewServer(t)
+			return StoreConfig{Driver: "firestore", ProjectID: firestoretest.ProjectID}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Setup(Config{
+				PublicKey:    pub,
+				Actions:      []ActionConfig{{Events: []string{"delivered", "bounce"}, Action: ActionRecordStatus}},
+				Store:        tt.store(t),
+				StatusSecret: "s3cret",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { Setup(Config{}) })
+			ctx := context.Background()
+
+			if _, err := GetStatus(ctx, "s3cret", "cs_1", "prod_1"); !errors.Is(err, ErrStatusNotFound) {
+				t.Fatalf("before any event: got %v, want ErrStatusNotFound", err)
+			}
+
+			// events arrive out of order, the latest one is kept
+			events := []*sendgrid.WebhookEvent{
+				{Event: "bounce", Email: "ada@example.com", Reason: "mailbox full", Timestamp: 200},
+				{Event: "delivered", Email: "ada@example.com", Timestamp: 100},
+				{Event: "open", Email: "ada@example.com", Timestamp: 300},
+				{Event: "delivered", Email: "ada@example.com", Timestamp: 400},
+			}
+			for _, ev := range events {
+				ev.CustomArgs = map[string]string{"session_id": "cs_1", "product_id": "prod_1"}
+				if err := Handle(ctx, ev); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// events of other emails than purchase emails are skipped
+			if err := Handle(ctx, &sendgrid.WebhookEvent{Event: "bounce", Timestamp: 500}); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := GetStatus(ctx, "s3cret", "cs_1", "prod_1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := Status{Event: "delivered", Email: "ada@example.com", SessionID: "cs_1", ProductID: "prod_1", Timestamp: time.Unix(400, 0).UTC()}
+			if *got != want {
+				t.Errorf("got %+v, want %+v", got, want)
+			}
+
+			for _, secret := range []string{"", "s3cre", "s3cret "} {
+				if _, err := GetStatus(ctx, secret, "cs_1", "prod_1"); !errors.Is(err, ErrStatusDenied) {
+					t.Errorf("secret %q: got %v, want ErrStatusDenied", secret, err)
+				}
+			}
+		})
+	}
+}
+
+func TestGetStatusWithoutSecret(t *testing.T) {
+	_, pub := newKey(t)
+	if err := Setup(Config{PublicKey: pub}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { Setup(Config{}) })
+
+	if _, err := GetStatus(context.Background(), "", "cs_1", "prod_1"); !errors.Is(err, ErrStatusDenied) {
+		t.Errorf("got %v, want ErrStatusDenied", err)
+	}
+}
@@ -0,0 +1,184 @@
+package emailevents
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/500k-agency/function/lib/firestore"
+	"github.com/500k-agency/function/lib/jsonstore"
+)
+
+// attempts at recording a status while its document keeps changing
+const maxRecordAttempts = 5
+
+var ErrStatusNotFound = errors.New("delivery status not found")
+
+// StoreConfig holds the delivery status store configuration. EmailStatusHandler
+// reads back what any instance recorded with the firestore driver only.
+type StoreConfig struct {
+	Driver     string `toml:"driver"`      // memory (default), file or firestore
+	Path       string `toml:"path"`        // file driver: path to the store file
+	ProjectID  string `toml:"project_id"`  // firestore driver: gcp project
+	DatabaseID string `toml:"database_id"` // firestore driver: defaults to (default)
+	Collection string `toml:"collection"`  // firestore driver: defaults to email_status
+}
+
+// Status is the latest email event recorded for a purchase
+type Status struct {
+	Event     string    `json:"event"`
+	Email     string    `json:"email"`
+	Reason    string    `json:"reason,omitempty"`
+	SessionID string    `json:"sessionId"`
+	ProductID string    `json:"productId"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// StatusStore records the delivery status of purchase emails
+type StatusStore interface {
+	// Record stores the status unless a newer one is already recorded
+	Record(ctx context.Context, key string, s Status) error
+
+	// Get returns the status or ErrStatusNotFound
+	Get(ctx context.Context, key string) (*Status, error)
+}
+
+// StatusKey identifies the purchase email of a product in a checkout session
+func StatusKey(sessionID, productID string) string {
+	return sessionID + ":" + productID
+}
+
+// NewStatusStore instantiates a status store for the configured driver
+func NewStatusStore(conf StoreConfig) (StatusStore, error) {
+	switch conf.Driver {
+	case "", "memory":
+		return &localStatusStore{statuses: jsonstore.NewMemory[Status]()}, nil
+	case "file":
+		statuses, err := jsonstore.NewFile[Status](conf.Path)
+		if err != nil {
+			return nil, fmt.Errorf("emailevents: %w", err)
+		}
+		return &localStatusStore{statuses: statuses}, nil
+	case "firestore":
+		client, err := firestore.New(conf.ProjectID, conf.DatabaseID)
+		if err != nil {
+			return nil, fmt.Errorf("emailevents: %w", err)
+		}
+		collection := conf.Collection
+		if collection == "" {
+			collection = "email_status"
+		}
+		return &firestoreStatusStore{client: client, collection: collection}, nil
+	}
+	return nil, fmt.Errorf("emailevents: unknown store driver %q", conf.Driver)
+}
+
+// record keeps s unless statuses holds a newer event for key, events are
+// not delivered in order
+func record(statuses map[string]Status, key string, s Status) {
+	if prev, ok := statuses[key]; ok && prev.Timestamp.After(s.Timestamp) {
+		return
+	}
+	statuses[key] = s
+}
+
+// localStatusStore keeps statuses in memory or in a json file
+type localStatusStore struct {
+	statuses *jsonstore.Store[Status]
+}
+
+func (s *localStatusStore) Record(ctx context.Context, key string, v Status) error {
+	err := s.statuses.Update(func(statuses map[string]Status) error {
+		record(statuses, key, v)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("emailevents: %w", err)
+	}
+	return nil
+}
+
+func (s *localStatusStore) Get(ctx context.Context, key string) (*Status, error) {
+	var v Status
+	err := s.statuses.View(func(statuses map[string]Status) error {
+		var ok bool
+		if v, ok = statuses[key]; !ok {
+			return ErrStatusNotFound
+		}
+		return nil
+	})
+	if errors.Is(err, ErrStatusNotFound) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("emailevents: %w", err)
+	}
+	return &v, nil
+}
+
+// firestoreStatusStore keeps a Firestore document per purchase email.
+// Writes are guarded by the version read, so of two events recorded at once
+// the newer one wins.
+type firestoreStatusStore struct {
+	client     *firestore.Client
+	collection string
+}
+
+func (s *firestoreStatusStore) Record(ctx context.Context, key string, v Status) error {
+	for i := 0; i < maxRecordAttempts; i++ {
+		doc, err := s.client.Get(ctx, s.collection, key)
+		switch {
+		case errors.Is(err, firestore.ErrNotFound):
+			err = s.client.Create(ctx, s.collection, key, statusDocument(v))
+		case err != nil:
+			return fmt.Errorf("emailevents: %w", err)
+		case status(doc).Timestamp.After(v.Timestamp):
+			return nil
+		default:
+			err = s.client.Update(ctx, s.collection, key, statusDocument(v), doc.UpdateTime)
+		}
+		if !errors.Is(err, firestore.ErrPrecondition) {
+			if err != nil {
+				return fmt.Errorf("emailevents: %w", err)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("emailevents: recording %s: %w", key, firestore.ErrPrecondition)
+}
+
+func (s *firestoreStatusStore) Get(ctx context.Context, key string) (*Status, error) {
+	doc, err := s.client.Get(ctx, s.collection, key)
+	if errors.Is(err, firestore.ErrNotFound) {
+		return nil, ErrStatusNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("emailevents: %w", err)
+	}
+	return status(doc), nil
+}
+
+func statusDocument(v Status) *firestore.Document {
+	return &firestore.Document{
+		Fields: map[string]firestore.Value{
+			"event":     firestore.String(v.Event),
+			"email":     firestore.String(v.Email),
+			"reason":    firestore.String(v.Reason),
+			"sessionId": firestore.String(v.SessionID),
+			"productId": firestore.String(v.ProductID),
+			"timestamp": firestore.Timestamp(v.Timestamp),
+		},
+	}
+}
+
+func status(d *firestore.Document) *Status {
+	return &Status{
+		Event:     d.Fields["event"].Str(),
+		Email:     d.Fields["email"].Str(),
+		Reason:    d.Fields["reason"].Str(),
+		SessionID: d.Fields["sessionId"].Str(),
+		ProductID: d.Fields["productId"].Str(),
+		Timestamp: d.Fields["timestamp"].Time(),
+	}
+}
@@ -3,7 +3,9 @@ package function
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"html/template"
 	"io"
 	"log"
 	"net/http"
@@ -12,9 +14,13 @@ import (
 
 	"github.com/500k-agency/function/api"
 	"github.com/500k-agency/function/config"
+	"github.com/500k-agency/function/delivery"
+	"github.com/500k-agency/function/emailevents"
 	"github.com/500k-agency/function/lib/connect"
 	"github.com/500k-agency/function/lib/emailx"
+	"github.com/500k-agency/function/lib/eventstore"
 	"github.com/500k-agency/function/lib/sendgrid"
+	"github.com/500k-agency/function/lib/token"
 	"github.com/500k-agency/function/product"
 	"github.com/500k-agency/function/waitlist"
 	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
@@ -26,6 +32,9 @@ import (
 
 const (
 	maxStripeBodyBytes = int64(65536)
+
+	// event webhook batches hold up to a few thousand events
+	maxEmailEventsBodyBytes = int64(4 << 20)
 )
 
 func setup() {
@@ -36,14 +45,41 @@ func setup() {
 	if err != nil {
 		log.Fatalf("main.NewFromSecrets: %v\n", err)
 	}
-	connect.Configure(conf.Connect)
-	product.Setup(conf.Products)
-	waitlist.Setup(conf.Waitlist)
+	Configure(conf)
+}
+
+// Configure sets up the connections and packages used by the functions
+func Configure(conf *config.Config) {
+	if err := connect.Configure(conf.Connect); err != nil {
+		log.Fatalf("main.connect.Configure: %v\n", err)
+	}
+	if _, err := eventstore.Setup(conf.EventStore); err != nil {
+		log.Fatalf("main.eventstore.Setup: %v\n", err)
+	}
+	if err := product.Setup(conf.Products, conf.Sender, conf.Brands); err != nil {
+		log.Fatalf("main.product.Setup: %v\n", err)
+	}
+	product.SetupOperator(conf.Operator)
+	product.SetupContactFields(conf.ContactFields)
+	if err := waitlist.Setup(conf.Waitlists, conf.OptIn, conf.Referrals); err != nil {
+		log.Fatalf("main.waitlist.Setup: %v\n", err)
+	}
+	if err := delivery.Setup(conf.Delivery); err != nil {
+		log.Fatalf("main.delivery.Setup: %v\n", err)
+	}
+	if err := emailevents.Setup(conf.EmailEvents); err != nil {
+		log.Fatalf("main.emailevents.Setup: %v\n", err)
+	}
 }
 
 func init() {
 	functions.HTTP("PurchaseHandler", PurchaseHandler)
 	functions.HTTP("WaitlistHandler", WaitlistHandler)
+	functions.HTTP("ConfirmHandler", ConfirmHandler)
+	functions.HTTP("ReferralHandler", ReferralHandler)
+	functions.HTTP("DownloadHandler", DownloadHandler)
+	functions.HTTP("EmailEventsHandler", EmailEventsHandler)
+	functions.HTTP("EmailStatusHandler", EmailStatusHandler)
 }
 
 // WaitlistHandler handles incoming tally form responses
@@ -53,7 +89,7 @@ func WaitlistHandler(w http.ResponseWriter, r *http.Request) {
 	r.Body = http.MaxBytesReader(w, r.Body, maxStripeBodyBytes)
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		render.Respond(w, r, err)
+		render.Render(w, r, bodyReadError(err))
 		return
 	}
 	defer r.Body.Close()
@@ -61,51 +97,185 @@ func WaitlistHandler(w http.ResponseWriter, r *http.Request) {
 	// Pass the request body & Tally-Signature header to ConstructEvent, along with the webhook signing key
 	// You can find your endpoint's secret in your webhook settings
 	event, err := connect.TallyClient.ConstructEvent(body, r.Header.Get("Tally-Signature"))
-	// Ignore Signature for now.
 	if err != nil {
-		render.Respond(w, r, api.ErrInvalidRequest(fmt.Errorf("Tally ConstructEvent errored: %w", err)))
+		render.Render(w, r, tallyError(err))
 		return
 	}
 
 	ctx := context.WithValue(r.Context(), &api.ContextKey{Name: "eventType"}, event.EventType)
 
+	err = processOnce(ctx, eventstore.Key("tally", event.EventID), func() error {
+		return ackPermanent(eventstore.Key("tally", event.EventID), handleTallyEvent(ctx, event))
+	})
+	if err != nil {
+		render.Render(w, r, api.AsApiError(err))
+		return
+	}
+
+	// Send an HTTP response
+	render.Respond(w, r, "OK")
+}
+
+func handleTallyEvent(ctx context.Context, event *waitlist.Event) error {
 	switch event.EventType {
 	case "FORM_RESPONSE":
 		var formResponse waitlist.FormResponse
 		if err := json.Unmarshal(event.Data, &formResponse); err != nil {
-			render.Respond(w, r, fmt.Sprintf("WaitlistHandler errored: %+v", err))
-			return
+			return api.ErrInvalidRequest(fmt.Errorf("WaitlistHandler errored: %w", err))
 		}
-		var rawEmail string
-		for _, f := range formResponse.Fields {
-			if strings.Contains(strings.ToLower(f.Label), "email") {
-				rawEmail = f.Value.(string)
-			}
+
+		// reject forms without a waitlist before reading the response
+		x, err := waitlist.GetListByID(formResponse.FormID)
+		if err != nil {
+			return api.ErrUnprocessableEntity(fmt.Errorf("WaitlistHandler errored: %w", err))
 		}
 
-		ex, err := emailx.New(rawEmail)
+		signup, err := x.Contact(&formResponse)
 		if err != nil {
-			render.Respond(w, r, fmt.Sprintf("WaitlistHandler errored: %+v", err))
-			return
+			return api.ErrInvalidEmailSignup(err)
 		}
+		ex, err := emailx.New(signup.Email)
+		if err != nil {
+			return api.ErrInvalidEmailSignup(err)
+		}
+		signup.Email = ex.String()
+		referredBy := x.Referrer(&formResponse)
 
-		x := waitlist.GetListByID(formResponse.FormID)
-		contact := &sendgrid.ContactRequest{
-			ListIDs: x.ListIDs,
-			Contacts: []*sendgrid.Contact{
-				{
-					Email: ex.String(),
-				},
-			},
+		if x.DoubleOptIn {
+			confirmURL, err := x.IssueConfirmURL(signup, referredBy)
+			if err != nil {
+				return api.ErrInternalServerError(fmt.Errorf("WaitlistHandler errored: %w", err))
+			}
+			err = product.SendWaitlistConfirmation(ctx, x.ConfirmTemplateID, signup.Email, signup.FirstName, x.Name, confirmURL)
+			if err != nil {
+				return api.ErrUpstream(fmt.Errorf("WaitlistHandler errored: %w", err))
+			}
+			return nil
 		}
-		if err := connect.SendgridClient.AddContact(ctx, contact); err != nil {
-			render.Respond(w, r, fmt.Sprintf("WaitlistHandler errored: %+v", err))
-			return
+		if err := addSignup(ctx, x, signup, referredBy); err != nil {
+			return api.ErrUpstream(fmt.Errorf("WaitlistHandler errored: %w", err))
 		}
 	}
+	return nil
+}
 
-	// Send an HTTP response
-	render.Respond(w, r, "OK")
+// addSignup adds the signup to the lists of the waitlist, with its referral
+// code when the waitlist runs a referral program
+func addSignup(ctx context.Context, x *waitlist.Waitlist, signup *waitlist.Contact, referredBy string) error {
+	if x.Referral.Enabled() {
+		if _, err := x.Refer(ctx, signup, referredBy); err != nil {
+			return err
+		}
+	}
+	return connect.Contacts.AddContact(ctx, &connect.ContactRequest{
+		ListIDs:  x.ListIDs,
+		Contacts: []*connect.Contact{(*connect.Contact)(signup)},
+	})
+}
+
+// tallyError maps a failure verifying a tally webhook to an api error
+func tallyError(err error) *api.ApiError {
+	switch {
+	case errors.Is(err, connect.ErrTallyNotSigned),
+		errors.Is(err, connect.ErrTallyInvalidSignature),
+		errors.Is(err, connect.ErrTallyInvalidTimestamp),
+		errors.Is(err, connect.ErrTallyTimestampOutsideWindow):
+		return api.ErrUnauthorized(err)
+	case errors.Is(err, connect.ErrTallyNoSecret):
+		return api.ErrInternalServerError(err)
+	}
+	return api.ErrInvalidRequest(fmt.Errorf("Tally ConstructEvent errored: %w", err))
+}
+
+// confirmPage asks the signup to confirm with a POST, so link scanners
+// prefetching the email's links do not confirm addresses on their own
+var confirmPage = template.Must(template.New("confirm").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>Confirm your signup</title></head>
+<body>
+<form method="post">
+<input type="hidden" name="token" value="{{.Token}}">
+<p>Confirm your signup{{with .Waitlist}} to {{.}}{{end}}.</p>
+<button type="submit">Confirm</button>
+</form>
+</body>
+</html>
+`))
+
+// ConfirmHandler adds double opt-in waitlist signups once they follow the
+// link of their confirmation email and post the confirmation form. Each
+// token confirms once, later posts are acknowledged without adding the
+// signup again.
+func ConfirmHandler(w http.ResponseWriter, r *http.Request) {
+	setup()
+
+	tok := r.FormValue("token")
+	x, claims, err := waitlist.Confirm(tok)
+	if err != nil {
+		render.Render(w, r, confirmError(err))
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		if err := confirmPage.Execute(w, map[string]string{"Token": tok, "Waitlist": x.Name}); err != nil {
+			log.Printf("ConfirmHandler render errored: %v\n", err)
+		}
+		return
+	}
+
+	err = processOnce(r.Context(), eventstore.Key("optin", token.ID(tok)), func() error {
+		if err := addSignup(r.Context(), x, &claims.Contact, claims.ReferredBy); err != nil {
+			return api.ErrUpstream(fmt.Errorf("ConfirmHandler errored: %w", err))
+		}
+		return nil
+	})
+	if err != nil {
+		render.Render(w, r, api.AsApiError(err))
+		return
+	}
+
+	if x.RedirectURL != "" {
+		http.Redirect(w, r, x.RedirectURL, http.StatusSeeOther)
+		return
+	}
+	render.PlainText(w, r, "Thanks, your signup is confirmed.")
+}
+
+// confirmError maps a failure verifying a confirmation token to an api error
+func confirmError(err error) *api.ApiError {
+	switch {
+	case errors.Is(err, token.ErrExpired):
+		return api.ErrGone(err)
+	case errors.Is(err, token.ErrMalformed), errors.Is(err, token.ErrInvalidSignature):
+		return api.ErrUnauthorized(err)
+	case errors.Is(err, waitlist.ErrOptInDisabled), errors.Is(err, waitlist.ErrUnknownForm):
+		return api.ErrResourceNotFound(err)
+	}
+	return api.ErrInternalServerError(err)
+}
+
+// ReferralHandler returns the referral count and queue position of a
+// waitlist signup's referral code
+func ReferralHandler(w http.ResponseWriter, r *http.Request) {
+	setup()
+
+	status, err := waitlist.GetReferralStatus(r.Context(), r.URL.Query().Get("code"))
+	if err != nil {
+		render.Render(w, r, referralError(err))
+		return
+	}
+	render.JSON(w, r, status)
+}
+
+// referralError maps a failure looking up a referral code to an api error
+func referralError(err error) *api.ApiError {
+	switch {
+	case errors.Is(err, waitlist.ErrUnknownReferral), errors.Is(err, waitlist.ErrReferralsDisabled):
+		return api.ErrResourceNotFound(err)
+	}
+	return api.ErrServiceUnavailable(err)
 }
 
 // PurchaseHandler handle incoming stripe connections
@@ -115,7 +285,7 @@ func PurchaseHandler(w http.ResponseWriter, r *http.Request) {
 	r.Body = http.MaxBytesReader(w, r.Body, maxStripeBodyBytes)
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		render.Respond(w, r, err)
+		render.Render(w, r, bodyReadError(err))
 		return
 	}
 	defer r.Body.Close()
@@ -125,35 +295,295 @@ func PurchaseHandler(w http.ResponseWriter, r *http.Request) {
 	event, err := connect.StripeClient.ConstructEvent(body, r.Header.Get("Stripe-Signature"))
 	// Ignore Signature for now.
 	if err != nil {
-		render.Respond(w, r, api.ErrInvalidRequest(fmt.Errorf("Stripe ConstructEvent errored: %w", err)))
+		render.Render(w, r, api.ErrInvalidRequest(fmt.Errorf("Stripe ConstructEvent errored: %w", err)))
 		return
 	}
 
 	ctx := context.WithValue(r.Context(), &api.ContextKey{Name: "eventType"}, event.Type)
 
+	err = processOnce(ctx, eventstore.Key("stripe", event.ID), func() error {
+		return ackPermanent(eventstore.Key("stripe", event.ID), handleStripeEvent(ctx, event))
+	})
+	if err != nil {
+		render.Render(w, r, api.AsApiError(err))
+		return
+	}
+
+	// Send an HTTP response
+	render.Respond(w, r, "OK")
+}
+
+func handleStripeEvent(ctx context.Context, event stripe.Event) error {
 	switch event.Type {
-	case "checkout.session.completed":
+	case "checkout.session.completed", "checkout.session.async_payment_succeeded":
 		// Sent when a customer clicks the Pay or Subscribe button in Checkout, informing you of a new purchase.
-		// Payment is successful and the subscription is created. Provision the subscription.
+		// Delayed payment methods complete the session unpaid and send
+		// async_payment_succeeded once the payment clears.
 		var session stripe.CheckoutSession
 		if err := json.Unmarshal(event.Data.Raw, &session); err != nil {
-			render.Respond(w, r, fmt.Sprintf("CheckoutSessionCompleted handler errored: %+v", err))
-			return
+			return api.ErrInvalidRequest(fmt.Errorf("CheckoutSessionCompleted handler errored: %w", err))
 		}
 		switch session.Mode {
 		case stripe.CheckoutSessionModePayment:
-			if err := product.HandlePaymentCheckoutSession(ctx, session); err != nil {
-				render.Respond(w, r, fmt.Sprintf("CheckoutSessionCompleted CheckoutSessionModePayment handler errored: %+v", err))
-				return
+			err := product.HandlePaymentCheckoutSession(ctx, session)
+			if errors.Is(err, product.ErrSessionUnpaid) {
+				// acknowledged, fulfilled on async_payment_succeeded
+				log.Printf("CheckoutSession %s awaiting payment, skipped\n", session.ID)
+				return nil
+			}
+			if err != nil {
+				return api.ErrUpstream(fmt.Errorf("CheckoutSessionCompleted CheckoutSessionModePayment handler errored: %w", err))
 			}
 			// ignore other modes
 		case stripe.CheckoutSessionModeSubscription:
+			// provisioned by the customer.subscription.* events
 			break
 		case stripe.CheckoutSessionModeSetup:
 			break
 		}
+
+	case "customer.subscription.created", "customer.subscription.updated", "customer.subscription.deleted":
+		var sub stripe.Subscription
+		if err := json.Unmarshal(event.Data.Raw, &sub); err != nil {
+			return api.ErrInvalidRequest(fmt.Errorf("Subscription handler errored: %w", err))
+		}
+		var err error
+		switch event.Type {
+		case "customer.subscription.created":
+			err = product.HandleSubscriptionCreated(ctx, sub)
+		case "customer.subscription.updated":
+			err = product.HandleSubscriptionUpdated(ctx, sub, event.Data.PreviousAttributes)
+		case "customer.subscription.deleted":
+			err = product.HandleSubscriptionDeleted(ctx, sub)
+		}
+		if err != nil {
+			return api.ErrUpstream(fmt.Errorf("Subscription %s handler errored: %w", event.Type, err))
+		}
+
+	case "invoice.paid", "invoice.payment_failed":
+		var invoice stripe.Invoice
+		if err := json.Unmarshal(event.Data.Raw, &invoice); err != nil {
+			return api.ErrInvalidRequest(fmt.Errorf("Invoice handler errored: %w", err))
+		}
+		var err error
+		switch event.Type {
+		case "invoice.paid":
+			err = product.HandleInvoicePaid(ctx, invoice)
+		case "invoice.payment_failed":
+			err = product.HandleInvoicePaymentFailed(ctx, invoice)
+		}
+		if err != nil {
+			return api.ErrUpstream(fmt.Errorf("Invoice %s handler errored: %w", event.Type, err))
+		}
+
+	case "charge.refunded":
+		var charge stripe.Charge
+		if err := json.Unmarshal(event.Data.Raw, &charge); err != nil {
+			return api.ErrInvalidRequest(fmt.Errorf("ChargeRefunded handler errored: %w", err))
+		}
+		if err := product.HandleChargeRefunded(ctx, charge); err != nil {
+			return api.ErrUpstream(fmt.Errorf("ChargeRefunded handler errored: %w", err))
+		}
+
+	case "charge.dispute.created":
+		var dispute stripe.Dispute
+		if err := json.Unmarshal(event.Data.Raw, &dispute); err != nil {
+			return api.ErrInvalidRequest(fmt.Errorf("DisputeCreated handler errored: %w", err))
+		}
+		if err := product.HandleDisputeCreated(ctx, dispute); err != nil {
+			return api.ErrUpstream(fmt.Errorf("DisputeCreated handler errored: %w", err))
+		}
+	}
+	return nil
+}
+
+// DownloadHandler validates sealed download links and streams the purchased
+// asset. The download is counted only once the asset is fetched.
+func DownloadHandler(w http.ResponseWriter, r *http.Request) {
+	setup()
+
+	tok := r.URL.Query().Get("token")
+	claims, err := delivery.Verify(tok)
+	if err != nil {
+		render.Render(w, r, downloadError(err))
+		return
+	}
+
+	p := product.GetProductByID(claims.ProductID)
+	if p.StripeID == "" {
+		render.Render(w, r, api.ErrResourceNotFound(fmt.Errorf("product %q not found", claims.ProductID)))
+		return
+	}
+
+	download, err := delivery.OpenAsset(r.Context(), p.Asset())
+	if err != nil {
+		render.Render(w, r, downloadError(err))
+		return
+	}
+	defer download.Close()
+
+	if _, err := delivery.Redeem(r.Context(), tok); err != nil {
+		render.Render(w, r, downloadError(err))
+		return
+	}
+	if err := download.Stream(w); err != nil {
+		// headers are sent, nothing left to tell the client
+		log.Printf("DownloadHandler stream errored: %v\n", err)
+	}
+}
+
+// downloadError maps a failure redeeming a download token to an api error
+func downloadError(err error) *api.ApiError {
+	switch {
+	case errors.Is(err, token.ErrExpired):
+		return api.ErrGone(err)
+	case errors.Is(err, delivery.ErrDownloadLimit):
+		return api.ErrForbidden(err)
+	case errors.Is(err, token.ErrMalformed), errors.Is(err, token.ErrInvalidSignature):
+		return api.ErrUnauthorized(err)
+	case errors.Is(err, delivery.ErrDisabled):
+		return api.ErrResourceNotFound(err)
+	case errors.Is(err, delivery.ErrAssetUnavailable):
+		return api.ErrBadGateway(err)
+	}
+	return api.ErrServiceUnavailable(err)
+}
+
+// EmailEventsHandler handles signed SendGrid event webhook deliveries
+func EmailEventsHandler(w http.ResponseWriter, r *http.Request) {
+	setup()
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxEmailEventsBodyBytes)
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		render.Render(w, r, bodyReadError(err))
+		return
+	}
+	defer r.Body.Close()
+
+	events, err := emailevents.ConstructEvents(body, r.Header.Get(sendgrid.SignatureHeader), r.Header.Get(sendgrid.TimestampHeader))
+	if err != nil {
+		render.Render(w, r, emailEventsError(err))
+		return
+	}
+
+	// events are deduplicated one by one, a failed batch is redelivered as
+	// a whole and only its failed events run again
+	var errs []error
+	for _, ev := range events {
+		ev := ev
+		ctx := context.WithValue(r.Context(), &api.ContextKey{Name: "eventType"}, ev.Event)
+		err := processOnce(ctx, eventstore.Key("sendgrid", ev.SgEventID), func() error {
+			return emailevents.Handle(ctx, ev)
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		render.Render(w, r, api.ErrUpstream(fmt.Errorf("EmailEventsHandler errored: %w", err)))
+		return
 	}
 
 	// Send an HTTP response
 	render.Respond(w, r, "OK")
 }
+
+// emailEventsError maps a failure verifying an event webhook delivery to an
+// api error
+func emailEventsError(err error) *api.ApiError {
+	switch {
+	case errors.Is(err, emailevents.ErrDisabled):
+		return api.ErrResourceNotFound(err)
+	case errors.Is(err, sendgrid.ErrNoSignature),
+		errors.Is(err, sendgrid.ErrInvalidSignature),
+		errors.Is(err, sendgrid.ErrInvalidWebhookTimestamp),
+		errors.Is(err, sendgrid.ErrTimestampOutsideWindow):
+		return api.ErrUnauthorized(err)
+	}
+	return api.ErrInvalidRequest(fmt.Errorf("SendGrid ConstructEvents errored: %w", err))
+}
+
+// EmailStatusHandler returns the latest delivery status of the purchase
+// email of a checkout session's product. It is read with the configured
+// emailevents status_secret as a bearer token.
+func EmailStatusHandler(w http.ResponseWriter, r *http.Request) {
+	setup()
+
+	q := r.URL.Query()
+	secret := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	status, err := emailevents.GetStatus(r.Context(), secret, q.Get("session_id"), q.Get("product_id"))
+	if err != nil {
+		render.Render(w, r, emailStatusError(err))
+		return
+	}
+	render.JSON(w, r, status)
+}
+
+// emailStatusError maps a failure looking up a delivery status to an api
+// error
+func emailStatusError(err error) *api.ApiError {
+	switch {
+	case errors.Is(err, emailevents.ErrStatusDenied):
+		return api.ErrUnauthorized(err)
+	case errors.Is(err, emailevents.ErrStatusNotFound), errors.Is(err, emailevents.ErrDisabled):
+		return api.ErrResourceNotFound(err)
+	}
+	return api.ErrServiceUnavailable(err)
+}
+
+// bodyReadError maps a failure reading the webhook body to an api error
+func bodyReadError(err error) *api.ApiError {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		return api.ErrRequestEntityTooLarge(err)
+	}
+	return api.ErrInvalidRequest(err)
+}
+
+// ackPermanent acknowledges events whose failures retrying cannot fix, ie.
+// an unknown product, so the provider stops redelivering them and resending
+// the emails that did go out. They are logged for the operator instead.
+func ackPermanent(key string, err error) error {
+	if product.IsPermanent(err) {
+		log.Printf("event %s acknowledged without retry, fix the config: %v\n", key, err)
+		return nil
+	}
+	return err
+}
+
+// processOnce runs fn unless the event store has already seen the event.
+// Replayed deliveries are acknowledged without running fn again, deliveries
+// racing one still in flight get a 409 so the provider retries them later,
+// and failures are recorded so the provider's next retry is processed.
+func processOnce(ctx context.Context, key string, fn func() error) error {
+	if strings.HasSuffix(key, ":") {
+		// no event id to deduplicate on
+		return fn()
+	}
+
+	store := eventstore.DefaultStore
+	if err := store.Begin(ctx, key); err != nil {
+		switch {
+		case errors.Is(err, eventstore.ErrAlreadyProcessed):
+			log.Printf("skipping replayed event %s: %v\n", key, err)
+			return nil
+		case errors.Is(err, eventstore.ErrInProgress):
+			// let the provider retry once the in-flight delivery settles
+			return api.ErrConflict(err)
+		}
+		return api.ErrServiceUnavailable(fmt.Errorf("eventstore.Begin errored: %w", err))
+	}
+
+	if err := fn(); err != nil {
+		if ferr := store.Fail(ctx, key, err); ferr != nil {
+			log.Printf("eventstore.Fail %s: %v\n", key, ferr)
+		}
+		return err
+	}
+
+	if err := store.Complete(ctx, key); err != nil {
+		log.Printf("eventstore.Complete %s: %v\n", key, err)
+	}
+	return nil
+}
@@ -9,13 +9,23 @@ type Config struct {
 
 type Configs struct {
 	Stripe   Config         `toml:"stripe"`
-	Tally    Config         `toml:"tally"`
+	Tally    TallyConfig    `toml:"tally"`
 	Sendgrid SendgridConfig `tomp:"sendgrid"`
+	Postmark PostmarkConfig `toml:"postmark"`
+	Mailgun  MailgunConfig  `toml:"mailgun"`
+	SMTP     SMTPConfig     `toml:"smtp"`
+
+	// provider emails are sent with: sendgrid, postmark, mailgun or smtp
+	Mailer string `toml:"mailer"`
+	// provider contacts are kept in: sendgrid, mailgun or none, defaults to
+	// the mailer's
+	Contacts string `toml:"contacts"`
 }
 
 // Configure loads the connect configs from config file
-func Configure(confs Configs) {
+func Configure(confs Configs) error {
 	SetupStripe(confs.Stripe)
 	SetupSendgrid(confs.Sendgrid)
 	SetupTally(confs.Tally)
+	return setupMail(confs)
 }
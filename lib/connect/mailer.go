@@ -0,0 +1,238 @@
+package connect
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Providers selectable as the mailer or the contact store
+const (
+	ProviderSendgrid = "sendgrid"
+	ProviderPostmark = "postmark"
+	ProviderMailgun  = "mailgun"
+	ProviderSMTP     = "smtp"
+	ProviderNone     = "none"
+)
+
+// max duration of a postmark or mailgun api request, response included
+const providerTimeout = 30 * time.Second
+
+var ErrUnknownProvider = errors.New("unknown email provider")
+
+// ProviderError is an error response of the postmark or mailgun api
+type ProviderError struct {
+	Provider   string
+	StatusCode int
+	Message    string
+}
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("%s: %d %s", e.Provider, e.StatusCode, e.Message)
+}
+
+// Retryable reports whether the request may succeed when retried
+func (e *ProviderError) Retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// Rejected reports whether the provider rejected the request itself, which
+// will never succeed
+func (e *ProviderError) Rejected() bool {
+	switch e.StatusCode {
+	case http.StatusBadRequest, http.StatusNotFound, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity:
+		return true
+	}
+	return false
+}
+
+// Mailer sends templated emails
+type Mailer interface {
+	Send(ctx context.Context, m *Message) error
+}
+
+// ContactStore keeps the contacts and their lists
+type ContactStore interface {
+	AddContact(ctx context.Context, v *ContactRequest, opts ...ContactOption) error
+	// GetContact returns nil when there is no contact with the email
+	GetContact(ctx context.Context, email string) (*Contact, error)
+	// RemoveContact and DeleteContact ignore unknown contacts
+	RemoveContact(ctx context.Context, email string, listIDs []string) error
+	DeleteContact(ctx context.Context, email string) error
+}
+
+var (
+	Mail     Mailer
+	Contacts ContactStore
+)
+
+// ContactOptions configures AddContact
+type ContactOptions struct {
+	importTimeout time.Duration
+}
+
+type ContactOption func(*ContactOptions)
+
+// WaitForImport blocks AddContact until the contact import job finishes or
+// the timeout passes, reporting failed imports as errors. A zero timeout
+// returns as soon as the import is queued.
+func WaitForImport(timeout time.Duration) ContactOption {
+	return func(o *ContactOptions) {
+		o.importTimeout = timeout
+	}
+}
+
+// Address is an email address with an optional display name
+type Address struct {
+	Email string
+	Name  string
+}
+
+// Attachment is a file attached to an email
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Content     []byte
+}
+
+// Message is a dynamic template email. TemplateID is the id of the
+// provider's template, the template alias on postmark, the template name on
+// mailgun and the handlebars file name in the templates directory for smtp.
+type Message struct {
+	From    Address
+	ReplyTo *Address
+	To      []Address
+
+	TemplateID   string
+	TemplateData map[string]interface{}
+
+	// tags, ie. sendgrid categories
+	Categories []string
+	// metadata echoed back by the provider's event webhooks
+	CustomArgs map[string]string
+
+	Attachments []Attachment
+
+	// unsubscribe group shown in the email, 0 for none
+	UnsubscribeGroupID int64
+	UnsubscribeGroups  []int64
+
+	// marketing emails skip suppressed recipients and go out on the
+	// broadcast stream. Transactional emails, ie. purchase emails, are always
+	// sent, whether or not they carry an unsubscribe group.
+	Marketing bool
+}
+
+// Contact is a contact with the reserved fields common to the providers.
+// CustomFields are keyed by field name.
+type Contact struct {
+	Email               string
+	FirstName           string
+	LastName            string
+	AddressLine1        string
+	AddressLine2        string
+	City                string
+	StateProvinceRegion string
+	PostalCode          string
+	Country             string
+	CustomFields        map[string]interface{}
+}
+
+// ContactRequest adds or updates the contacts and adds them to the lists
+type ContactRequest struct {
+	ListIDs  []string
+	Contacts []*Contact
+}
+
+// setupMail selects the mailer and contact store. The contact store
+// defaults to the mailer's when the mailer keeps contacts, and to none
+// otherwise.
+func setupMail(confs Configs) error {
+	mailer := confs.Mailer
+	if mailer == "" {
+		mailer = ProviderSendgrid
+	}
+	switch mailer {
+	case ProviderSendgrid:
+		Mail = SendgridClient
+	case ProviderPostmark:
+		Mail = SetupPostmark(confs.Postmark)
+	case ProviderMailgun:
+		Mail = SetupMailgun(confs.Mailgun)
+	case ProviderSMTP:
+		Mail = SetupSMTP(confs.SMTP)
+	default:
+		return fmt.Errorf("mailer: %w %q", ErrUnknownProvider, mailer)
+	}
+
+	contacts := confs.Contacts
+	if contacts == "" {
+		switch mailer {
+		case ProviderSendgrid, ProviderMailgun:
+			contacts = mailer
+		default:
+			contacts = ProviderNone
+		}
+	}
+	switch contacts {
+	case ProviderSendgrid:
+		Contacts = SendgridClient
+	case ProviderMailgun:
+		if m, ok := Mail.(*Mailgun); ok {
+			Contacts = m
+		} else {
+			Contacts = SetupMailgun(confs.Mailgun)
+		}
+	case ProviderNone:
+		Contacts = noContacts{}
+	default:
+		return fmt.Errorf("contacts: %w %q", ErrUnknownProvider, contacts)
+	}
+	return nil
+}
+
+// noContacts is the contact store of mailers without contacts, ie. smtp
+type noContacts struct{}
+
+func (noContacts) AddContact(context.Context, *ContactRequest, ...ContactOption) error { return nil }
+func (noContacts) GetContact(context.Context, string) (*Contact, error)                { return nil, nil }
+func (noContacts) RemoveContact(context.Context, string, []string) error               { return nil }
+func (noContacts) DeleteContact(context.Context, string) error                         { return nil }
+
+// doProviderRequest sends the request and decodes the json response into v,
+// if not nil. Error responses are returned as a *ProviderError.
+func doProviderRequest(client *http.Client, provider string, req *http.Request, v interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", provider, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("%s: %w", provider, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		// both apis describe the error in a message field
+		var errResp struct {
+			Message string `json:"message"`
+		}
+		msg := strings.TrimSpace(string(body))
+		if json.Unmarshal(body, &errResp) == nil && errResp.Message != "" {
+			msg = errResp.Message
+		}
+		return &ProviderError{Provider: provider, StatusCode: resp.StatusCode, Message: msg}
+	}
+	if v == nil || len(body) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("%s: decoding response: %w", provider, err)
+	}
+	return nil
+}
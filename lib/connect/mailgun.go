@@ -0,0 +1,263 @@
+package connect
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+)
+
+const defaultMailgunURL = "https://api.mailgun.net"
+
+// Mailgun sends stored template emails through the mailgun api and keeps
+// contacts as members of mailing lists, list ids are the list addresses.
+// Contact fields and custom fields are stored as member vars.
+type Mailgun struct {
+	client  *http.Client
+	baseURL string
+	domain  string
+	apiKey  string
+}
+
+type MailgunConfig struct {
+	APIKey string `toml:"api_key"`
+	Domain string `toml:"domain"`
+	// api url, https://api.eu.mailgun.net for eu domains or a local stand-in
+	// for testing
+	BaseURL string `toml:"base_url"`
+}
+
+func SetupMailgun(conf MailgunConfig) *Mailgun {
+	m := &Mailgun{
+		client:  &http.Client{Timeout: providerTimeout},
+		baseURL: strings.TrimSuffix(conf.BaseURL, "/"),
+		domain:  conf.Domain,
+		apiKey:  conf.APIKey,
+	}
+	if m.baseURL == "" {
+		m.baseURL = defaultMailgunURL
+	}
+	return m
+}
+
+// mailgun allows up to 3 tags per message
+const maxMailgunTags = 3
+
+// Send sends the message with the stored template of the name. Custom args
+// become user variables, echoed back by the mailgun webhooks. Mailgun has no
+// unsubscribe groups, marketing emails are sent as any other.
+func (m *Mailgun) Send(ctx context.Context, msg *Message) error {
+	vars, err := json.Marshal(msg.TemplateData)
+	if err != nil {
+		return err
+	}
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	fields := [][2]string{
+		{"from", formatAddress(msg.From)},
+		{"template", msg.TemplateID},
+		{"h:X-Mailgun-Variables", string(vars)},
+	}
+	for _, a := range msg.To {
+		fields = append(fields, [2]string{"to", formatAddress(a)})
+	}
+	if msg.ReplyTo != nil {
+		fields = append(fields, [2]string{"h:Reply-To", formatAddress(*msg.ReplyTo)})
+	}
+	for i, tag := range msg.Categories {
+		if i == maxMailgunTags {
+			break
+		}
+		fields = append(fields, [2]string{"o:tag", tag})
+	}
+	for k, v := range msg.CustomArgs {
+		fields = append(fields, [2]string{"v:" + k, v})
+	}
+	for _, f := range fields {
+		if err := w.WriteField(f[0], f[1]); err != nil {
+			return err
+		}
+	}
+	for _, a := range msg.Attachments {
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Disposition", `form-data; name="attachment"; filename="`+escapeQuotes(a.Filename)+`"`)
+		h.Set("Content-Type", a.ContentType)
+		part, err := w.CreatePart(h)
+		if err != nil {
+			return err
+		}
+		if _, err := part.Write(a.Content); err != nil {
+			return err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	req, err := m.newRequest(ctx, http.MethodPost, m.baseURL+"/v3/"+url.PathEscape(m.domain)+"/messages", &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return doProviderRequest(m.client, ProviderMailgun, req, nil)
+}
+
+// AddContact adds or updates the contacts on every list. Mailgun has no
+// contacts outside of lists. New members are added subscribed, existing
+// ones keep their subscription so an unsubscribe is never undone.
+func (m *Mailgun) AddContact(ctx context.Context, v *ContactRequest, opts ...ContactOption) error {
+	for _, listID := range v.ListIDs {
+		for _, c := range v.Contacts {
+			if err := m.upsertMember(ctx, listID, c); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// upsertMember updates the name and vars of an existing member, or adds the
+// contact as a subscribed member
+func (m *Mailgun) upsertMember(ctx context.Context, listID string, c *Contact) error {
+	vars, err := json.Marshal(mailgunVars(c))
+	if err != nil {
+		return err
+	}
+	form := url.Values{
+		"name": {strings.TrimSpace(c.FirstName + " " + c.LastName)},
+		"vars": {string(vars)},
+	}
+
+	members := m.baseURL + "/v3/lists/" + url.PathEscape(listID) + "/members"
+	req, err := m.newRequest(ctx, http.MethodPut, members+"/"+url.PathEscape(c.Email), strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	err = doProviderRequest(m.client, ProviderMailgun, req, nil)
+	var pErr *ProviderError
+	if !errors.As(err, &pErr) || pErr.StatusCode != http.StatusNotFound {
+		return err
+	}
+
+	// not a member yet
+	form.Set("address", c.Email)
+	form.Set("subscribed", "yes")
+	req, err = m.newRequest(ctx, http.MethodPost, members, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return doProviderRequest(m.client, ProviderMailgun, req, nil)
+}
+
+// GetContact always returns nil, mailgun members only exist per list. Custom
+// fields are therefore written as given: product_ids holds the products of
+// the latest purchase only.
+func (m *Mailgun) GetContact(ctx context.Context, email string) (*Contact, error) {
+	return nil, nil
+}
+
+// RemoveContact removes the member with the given email from the lists
+func (m *Mailgun) RemoveContact(ctx context.Context, email string, listIDs []string) error {
+	for _, listID := range listIDs {
+		if err := m.removeMember(ctx, listID, email); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteContact removes the member with the given email from every list
+func (m *Mailgun) DeleteContact(ctx context.Context, email string) error {
+	next := m.baseURL + "/v3/lists/pages?limit=100"
+	for next != "" {
+		req, err := m.newRequest(ctx, http.MethodGet, next, nil)
+		if err != nil {
+			return err
+		}
+
+		var page struct {
+			Items []struct {
+				Address string `json:"address"`
+			} `json:"items"`
+			Paging struct {
+				Next string `json:"next"`
+			} `json:"paging"`
+		}
+		if err := doProviderRequest(m.client, ProviderMailgun, req, &page); err != nil {
+			return err
+		}
+		for _, l := range page.Items {
+			if err := m.removeMember(ctx, l.Address, email); err != nil {
+				return err
+			}
+		}
+
+		// the last page links to an empty one
+		next = ""
+		if len(page.Items) > 0 {
+			next = page.Paging.Next
+		}
+	}
+	return nil
+}
+
+// removeMember removes the member from the list, unknown members are ignored
+func (m *Mailgun) removeMember(ctx context.Context, listID, email string) error {
+	u := m.baseURL + "/v3/lists/" + url.PathEscape(listID) + "/members/" + url.PathEscape(email)
+	req, err := m.newRequest(ctx, http.MethodDelete, u, nil)
+	if err != nil {
+		return err
+	}
+	err = doProviderRequest(m.client, ProviderMailgun, req, nil)
+	var pErr *ProviderError
+	if errors.As(err, &pErr) && pErr.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+func (m *Mailgun) newRequest(ctx context.Context, method, u string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth("api", m.apiKey)
+	return req, nil
+}
+
+// mailgunVars are the member vars of the contact, the non-empty contact
+// fields and its custom fields
+func mailgunVars(c *Contact) map[string]interface{} {
+	vars := make(map[string]interface{}, len(c.CustomFields)+8)
+	for k, v := range map[string]string{
+		"first_name":            c.FirstName,
+		"last_name":             c.LastName,
+		"address_line_1":        c.AddressLine1,
+		"address_line_2":        c.AddressLine2,
+		"city":                  c.City,
+		"state_province_region": c.StateProvinceRegion,
+		"postal_code":           c.PostalCode,
+		"country":               c.Country,
+	} {
+		if v != "" {
+			vars[k] = v
+		}
+	}
+	for k, v := range c.CustomFields {
+		vars[k] = v
+	}
+	return vars
+}
+
+func escapeQuotes(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
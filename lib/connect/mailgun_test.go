@@ -0,0 +1,185 @@
+package connect
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestMailgunSend(t *testing.T) {
+	var form map[string][]string
+	var attachment string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "api" || pass != "key" {
+			t.Errorf("basic auth %q %q", user, pass)
+		}
+		if r.URL.Path != "/v3/mg.example.com/messages" {
+			t.Errorf("path %s", r.URL.Path)
+		}
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Fatal(err)
+		}
+		form = r.MultipartForm.Value
+		if fh := r.MultipartForm.File["attachment"]; len(fh) == 1 {
+			f, _ := fh[0].Open()
+			b, _ := io.ReadAll(f)
+			attachment = fh[0].Filename + ":" + string(b)
+		}
+		w.Write([]byte(`{"id":"<1@mg.example.com>","message":"Queued"}`))
+	}))
+	defer srv.Close()
+
+	m := SetupMailgun(MailgunConfig{APIKey: "key", Domain: "mg.example.com", BaseURL: srv.URL})
+	err := m.Send(context.Background(), &Message{
+		From:         Address{Email: "shop@example.com", Name: "Shop"},
+		ReplyTo:      &Address{Email: "help@example.com"},
+		To:           []Address{{Email: "ada@example.com"}, {Email: "bob@example.com"}},
+		TemplateID:   "purchase",
+		TemplateData: map[string]interface{}{"name": "Ada"},
+		Categories:   []string{"a", "b", "c", "d"},
+		CustomArgs:   map[string]string{"session_id": "cs_1"},
+		Attachments:  []Attachment{{Filename: `my "book".pdf`, ContentType: "application/pdf", Content: []byte("pdf")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][]string{
+		"from":                  {`"Shop" <shop@example.com>`},
+		"template":              {"purchase"},
+		"h:X-Mailgun-Variables": {`{"name":"Ada"}`},
+		"to":                    {"ada@example.com", "bob@example.com"},
+		"h:Reply-To":            {"help@example.com"},
+		"o:tag":                 {"a", "b", "c"},
+		"v:session_id":          {"cs_1"},
+	}
+	if !reflect.DeepEqual(form, want) {
+		t.Errorf("sent %v, want %v", form, want)
+	}
+	if attachment != `my "book".pdf:pdf` {
+		t.Errorf("attachment %q", attachment)
+	}
+}
+
+// mailgunLists is a stand-in of the mailgun mailing lists api
+type mailgunLists struct {
+	mu      sync.Mutex
+	members map[string]map[string]mailgunMember // list -> address -> member
+}
+
+type mailgunMember struct {
+	Name       string
+	Vars       map[string]interface{}
+	Subscribed string
+}
+
+func (s *mailgunLists) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.URL.Path == "/v3/lists/pages" {
+		var items []map[string]string
+		if r.URL.Query().Get("page") == "" {
+			for l := range s.members {
+				items = append(items, map[string]string{"address": l})
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"items":  items,
+			"paging": map[string]string{"next": "http://" + r.Host + "/v3/lists/pages?page=next&limit=100"},
+		})
+		return
+	}
+
+	rest := strings.TrimPrefix(r.URL.Path, "/v3/lists/")
+	list, address, _ := strings.Cut(strings.Replace(rest, "/members", "", 1), "/")
+	members := s.members[list]
+	if members == nil {
+		http.Error(w, `{"message":"list not found"}`, http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodPut, http.MethodPost:
+		r.ParseForm()
+		if r.Method == http.MethodPost {
+			address = r.PostForm.Get("address")
+		} else if _, ok := members[address]; !ok {
+			http.Error(w, `{"message":"member not found"}`, http.StatusNotFound)
+			return
+		}
+		var vars map[string]interface{}
+		json.Unmarshal([]byte(r.PostForm.Get("vars")), &vars)
+		m := members[address]
+		m.Name, m.Vars = r.PostForm.Get("name"), vars
+		if s := r.PostForm.Get("subscribed"); s != "" {
+			m.Subscribed = s
+		}
+		members[address] = m
+	case http.MethodDelete:
+		if _, ok := members[address]; !ok {
+			http.Error(w, `{"message":"member not found"}`, http.StatusNotFound)
+			return
+		}
+		delete(members, address)
+	}
+	w.Write([]byte(`{"message":"ok"}`))
+}
+
+func TestMailgunContacts(t *testing.T) {
+	lists := &mailgunLists{members: map[string]map[string]mailgunMember{
+		"buyers@mg.example.com": {"ada@example.com": {Name: "Ada", Subscribed: "no"}},
+		"news@mg.example.com":   {},
+	}}
+	srv := httptest.NewServer(lists)
+	defer srv.Close()
+	m := SetupMailgun(MailgunConfig{APIKey: "key", Domain: "mg.example.com", BaseURL: srv.URL})
+	ctx := context.Background()
+
+	err := m.AddContact(ctx, &ContactRequest{
+		ListIDs: []string{"buyers@mg.example.com", "news@mg.example.com"},
+		Contacts: []*Contact{
+			{Email: "ada@example.com", FirstName: "Ada", LastName: "Lovelace", CustomFields: map[string]interface{}{"product_ids": "prod_1"}},
+			{Email: "bob@example.com", Country: "NL"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		list, address string
+		want          mailgunMember
+	}{
+		// existing members keep their unsubscribe
+		{"buyers@mg.example.com", "ada@example.com", mailgunMember{"Ada Lovelace", map[string]interface{}{"first_name": "Ada", "last_name": "Lovelace", "product_ids": "prod_1"}, "no"}},
+		{"buyers@mg.example.com", "bob@example.com", mailgunMember{"", map[string]interface{}{"country": "NL"}, "yes"}},
+		{"news@mg.example.com", "ada@example.com", mailgunMember{"Ada Lovelace", map[string]interface{}{"first_name": "Ada", "last_name": "Lovelace", "product_ids": "prod_1"}, "yes"}},
+	}
+	for _, tt := range tests {
+		if got := lists.members[tt.list][tt.address]; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s in %s: got %+v, want %+v", tt.address, tt.list, got, tt.want)
+		}
+	}
+
+	if err := m.RemoveContact(ctx, "bob@example.com", []string{"buyers@mg.example.com", "news@mg.example.com"}); err != nil {
+		t.Fatalf("removing a member missing from a list: %v", err)
+	}
+	if _, ok := lists.members["buyers@mg.example.com"]["bob@example.com"]; ok {
+		t.Error("bob is still a buyer")
+	}
+
+	if err := m.DeleteContact(ctx, "ada@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	for list, members := range lists.members {
+		if _, ok := members["ada@example.com"]; ok {
+			t.Errorf("ada is still a member of %s", list)
+		}
+	}
+}
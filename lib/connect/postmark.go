@@ -0,0 +1,139 @@
+package connect
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+)
+
+const defaultPostmarkURL = "https://api.postmarkapp.com"
+
+// Postmark sends template emails through the postmark api. Postmark has no
+// contact lists.
+type Postmark struct {
+	client      *http.Client
+	baseURL     string
+	serverToken string
+
+	messageStream   string
+	broadcastStream string
+}
+
+type PostmarkConfig struct {
+	ServerToken string `toml:"server_token"`
+	// api url, ie. a local stand-in for testing
+	BaseURL string `toml:"base_url"`
+
+	// stream of transactional emails, defaults to outbound
+	MessageStream string `toml:"message_stream"`
+	// stream of marketing emails, defaults to broadcast
+	BroadcastStream string `toml:"broadcast_stream"`
+}
+
+func SetupPostmark(conf PostmarkConfig) *Postmark {
+	p := &Postmark{
+		client:          &http.Client{Timeout: providerTimeout},
+		baseURL:         strings.TrimSuffix(conf.BaseURL, "/"),
+		serverToken:     conf.ServerToken,
+		messageStream:   conf.MessageStream,
+		broadcastStream: conf.BroadcastStream,
+	}
+	if p.baseURL == "" {
+		p.baseURL = defaultPostmarkURL
+	}
+	if p.messageStream == "" {
+		p.messageStream = "outbound"
+	}
+	if p.broadcastStream == "" {
+		p.broadcastStream = "broadcast"
+	}
+	return p
+}
+
+type postmarkAttachment struct {
+	Name        string `json:"Name"`
+	Content     string `json:"Content"`
+	ContentType string `json:"ContentType"`
+}
+
+// Documentation: https://postmarkapp.com/developer/api/templates-api#email-with-template
+type postmarkEmail struct {
+	From          string                 `json:"From"`
+	To            string                 `json:"To"`
+	ReplyTo       string                 `json:"ReplyTo,omitempty"`
+	TemplateID    int64                  `json:"TemplateId,omitempty"`
+	TemplateAlias string                 `json:"TemplateAlias,omitempty"`
+	TemplateModel map[string]interface{} `json:"TemplateModel"`
+	Tag           string                 `json:"Tag,omitempty"`
+	Metadata      map[string]string      `json:"Metadata,omitempty"`
+	Attachments   []postmarkAttachment   `json:"Attachments,omitempty"`
+	MessageStream string                 `json:"MessageStream"`
+}
+
+// Send sends the message with the template of the id, or of the alias when
+// the template id is not numeric. Postmark takes a single tag, the first
+// category.
+func (p *Postmark) Send(ctx context.Context, m *Message) error {
+	email := postmarkEmail{
+		From:          formatAddress(m.From),
+		To:            formatAddresses(m.To),
+		TemplateModel: m.TemplateData,
+		Metadata:      m.CustomArgs,
+		MessageStream: p.messageStream,
+	}
+	if id, err := strconv.ParseInt(m.TemplateID, 10, 64); err == nil {
+		email.TemplateID = id
+	} else {
+		email.TemplateAlias = m.TemplateID
+	}
+	if m.ReplyTo != nil {
+		email.ReplyTo = formatAddress(*m.ReplyTo)
+	}
+	if len(m.Categories) > 0 {
+		email.Tag = m.Categories[0]
+	}
+	if m.Marketing {
+		email.MessageStream = p.broadcastStream
+	}
+	for _, a := range m.Attachments {
+		email.Attachments = append(email.Attachments, postmarkAttachment{
+			Name:        a.Filename,
+			Content:     base64.StdEncoding.EncodeToString(a.Content),
+			ContentType: a.ContentType,
+		})
+	}
+
+	body, err := json.Marshal(email)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/email/withTemplate", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Postmark-Server-Token", p.serverToken)
+	return doProviderRequest(p.client, ProviderPostmark, req, nil)
+}
+
+// formatAddress formats the address for a From or To header
+func formatAddress(a Address) string {
+	if a.Name == "" {
+		return a.Email
+	}
+	return (&mail.Address{Name: a.Name, Address: a.Email}).String()
+}
+
+func formatAddresses(addrs []Address) string {
+	formatted := make([]string, len(addrs))
+	for i, a := range addrs {
+		formatted[i] = formatAddress(a)
+	}
+	return strings.Join(formatted, ", ")
+}
@@ -0,0 +1,129 @@
+package connect
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestPostmarkSend(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  Message
+		want postmarkEmail
+	}{
+		{
+			"template alias",
+			Message{
+				From:         Address{Email: "shop@example.com", Name: "Shop"},
+				To:           []Address{{Email: "ada@example.com"}},
+				TemplateID:   "purchase",
+				TemplateData: map[string]interface{}{"name": "Ada"},
+				Categories:   []string{"purchase", "ebook"},
+				CustomArgs:   map[string]string{"session_id": "cs_1"},
+			},
+			postmarkEmail{
+				From:          `"Shop" <shop@example.com>`,
+				To:            "ada@example.com",
+				TemplateAlias: "purchase",
+				TemplateModel: map[string]interface{}{"name": "Ada"},
+				Tag:           "purchase",
+				Metadata:      map[string]string{"session_id": "cs_1"},
+				MessageStream: "outbound",
+			},
+		},
+		{
+			"template id, marketing and attachment",
+			Message{
+				From:        Address{Email: "shop@example.com"},
+				ReplyTo:     &Address{Email: "help@example.com"},
+				To:          []Address{{Email: "ada@example.com", Name: "Ada"}, {Email: "bob@example.com"}},
+				TemplateID:  "1234",
+				Marketing:   true,
+				Attachments: []Attachment{{Filename: "book.pdf", ContentType: "application/pdf", Content: []byte("pdf")}},
+			},
+			postmarkEmail{
+				From:          "shop@example.com",
+				To:            `"Ada" <ada@example.com>, bob@example.com`,
+				ReplyTo:       "help@example.com",
+				TemplateID:    1234,
+				MessageStream: "broadcast",
+				Attachments:   []postmarkAttachment{{Name: "book.pdf", Content: "cGRm", ContentType: "application/pdf"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got postmarkEmail
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost || r.URL.Path != "/email/withTemplate" {
+					t.Errorf("got %s %s", r.Method, r.URL.Path)
+				}
+				if tok := r.Header.Get("X-Postmark-Server-Token"); tok != "tok" {
+					t.Errorf("server token %q", tok)
+				}
+				json.NewDecoder(r.Body).Decode(&got)
+				w.Write([]byte(`{"ErrorCode":0,"Message":"OK"}`))
+			}))
+			defer srv.Close()
+
+			p := SetupPostmark(PostmarkConfig{ServerToken: "tok", BaseURL: srv.URL + "/"})
+			if err := p.Send(context.Background(), &tt.msg); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sent %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostmarkErrors(t *testing.T) {
+	tests := []struct {
+		status    int
+		body      string
+		message   string
+		rejected  bool
+		retryable bool
+	}{
+		{http.StatusUnprocessableEntity, `{"ErrorCode":1101,"Message":"Template not found"}`, "Template not found", true, false},
+		{http.StatusTooManyRequests, `{"message":"slow down"}`, "slow down", false, true},
+		{http.StatusInternalServerError, "oops\n", "oops", false, true},
+		{http.StatusUnauthorized, `{"message":"bad token"}`, "bad token", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			p := SetupPostmark(PostmarkConfig{BaseURL: srv.URL})
+			err := p.Send(context.Background(), &Message{TemplateID: "t"})
+			var pErr *ProviderError
+			if !errors.As(err, &pErr) {
+				t.Fatalf("got %v, want a ProviderError", err)
+			}
+			if pErr.Provider != ProviderPostmark || pErr.StatusCode != tt.status || pErr.Message != tt.message {
+				t.Errorf("got %+v", pErr)
+			}
+			if pErr.Rejected() != tt.rejected || pErr.Retryable() != tt.retryable {
+				t.Errorf("rejected %v retryable %v, want %v %v", pErr.Rejected(), pErr.Retryable(), tt.rejected, tt.retryable)
+			}
+		})
+	}
+}
+
+func TestProviderClientTimeout(t *testing.T) {
+	if p := SetupPostmark(PostmarkConfig{}); p.client.Timeout != providerTimeout {
+		t.Errorf("client timeout %v, want %v", p.client.Timeout, providerTimeout)
+	}
+	if m := SetupMailgun(MailgunConfig{}); m.client.Timeout != providerTimeout {
+		t.Errorf("client timeout %v, want %v", m.client.Timeout, providerTimeout)
+	}
+}
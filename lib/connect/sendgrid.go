@@ -2,6 +2,12 @@ package connect
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/500k-agency/function/lib/sendgrid"
 )
@@ -9,40 +15,286 @@ import (
 type Sendgrid struct {
 	Client  *sendgrid.Client
 	Sandbox bool
+
+	// skip suppressed recipients of marketing emails before sending
+	checkSuppressions bool
+
+	// default for WaitForImport, 0 returns as soon as the import is queued
+	importTimeout time.Duration
+
+	// custom field ids by name, fetched on first use
+	fieldsMu sync.Mutex
+	fieldIDs map[string]string
 }
 
+var ErrUnknownCustomField = errors.New("unknown custom field")
+
 type SendgridConfig struct {
 	Config
 	Sandbox bool `toml:"sandbox" env:"SANDBOX"`
+
+	// block AddContact until the import job finishes, up to this many seconds
+	ImportTimeoutSeconds int `toml:"import_timeout_seconds"`
+
+	// client side throttling of api requests, 0 to disable
+	RateLimitPerSecond float64 `toml:"rate_limit_per_second"`
+	RateLimitBurst     int     `toml:"rate_limit_burst"`
+
+	// look up suppressions before sending marketing emails, see Send
+	CheckSuppressions bool `toml:"check_suppressions"`
+
+	// log every request and response, ie. while testing locally. dumps
+	// contacts and email bodies, keep it off in production
+	Debug bool `toml:"debug"`
 }
 
-var SendgridClient *Sendgrid
+var (
+	SendgridClient *Sendgrid
 
+	sendgridMu   sync.Mutex
+	sendgridConf SendgridConfig
+)
+
+// SetupSendgrid sets up the sendgrid client. Calling it again with the same
+// config keeps the existing client, so its rate limit and custom field ids
+// carry over between requests.
 func SetupSendgrid(conf SendgridConfig) *Sendgrid {
-	client, _ := sendgrid.NewClient(
-		nil,
+	sendgridMu.Lock()
+	defer sendgridMu.Unlock()
+
+	if SendgridClient != nil && sendgridConf == conf {
+		return SendgridClient
+	}
+
+	opts := []sendgrid.Option{
 		sendgrid.WithApp(conf.AppID, conf.AppSecret),
-		sendgrid.WithDebug(true),
-	)
+		sendgrid.WithDebug(conf.Debug),
+	}
+	if conf.RateLimitPerSecond > 0 {
+		opts = append(opts, sendgrid.WithRateLimit(conf.RateLimitPerSecond, conf.RateLimitBurst))
+	}
+	client, _ := sendgrid.NewClient(nil, opts...)
 	SendgridClient = &Sendgrid{
-		Client:  client,
-		Sandbox: conf.Sandbox,
+		Client:            client,
+		Sandbox:           conf.Sandbox,
+		checkSuppressions: conf.CheckSuppressions,
+		importTimeout:     time.Duration(conf.ImportTimeoutSeconds) * time.Second,
 	}
+	sendgridConf = conf
 	return SendgridClient
 }
 
-func (s *Sendgrid) AddContact(ctx context.Context, v *sendgrid.ContactRequest) error {
+// AddContact upserts the contacts, custom fields are resolved from their
+// names to the field ids
+func (s *Sendgrid) AddContact(ctx context.Context, v *ContactRequest, opts ...ContactOption) error {
 	if s.Sandbox {
 		return nil
 	}
-	if _, _, err := s.Client.Contact.Upsert(ctx, v); err != nil {
+	o := ContactOptions{importTimeout: s.importTimeout}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	req := &sendgrid.ContactRequest{
+		ListIDs:  v.ListIDs,
+		Contacts: make([]*sendgrid.Contact, len(v.Contacts)),
+	}
+	for i, c := range v.Contacts {
+		req.Contacts[i] = &sendgrid.Contact{
+			Email:               c.Email,
+			FirstName:           c.FirstName,
+			LastName:            c.LastName,
+			AddressLine1:        c.AddressLine1,
+			AddressLine2:        c.AddressLine2,
+			City:                c.City,
+			StateProvinceRegion: c.StateProvinceRegion,
+			PostalCode:          c.PostalCode,
+			Country:             c.Country,
+			CustomFields:        c.CustomFields,
+		}
+	}
+	s.resolveCustomFields(ctx, req.Contacts)
+
+	jobID, _, err := s.Client.Contact.Upsert(ctx, req)
+	if err != nil {
+		return err
+	}
+	if o.importTimeout <= 0 || jobID == "" {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, o.importTimeout)
+	defer cancel()
+	if _, err := s.Client.Job.WaitForJob(ctx, jobID, nil); err != nil {
+		return fmt.Errorf("contact import: %w", err)
+	}
+	return nil
+}
+
+// GetContact looks up the contact with the given email, nil when there is
+// none. Its custom fields are keyed by name.
+func (s *Sendgrid) GetContact(ctx context.Context, email string) (*Contact, error) {
+	if s.Sandbox {
+		return nil, nil
+	}
+	contacts, _, err := s.Client.Contact.GetByEmails(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	c, ok := contacts[email]
+	if !ok {
+		return nil, nil
+	}
+	return &Contact{
+		Email:               c.Email,
+		FirstName:           c.FirstName,
+		LastName:            c.LastName,
+		AddressLine1:        c.AddressLine1,
+		AddressLine2:        c.AddressLine2,
+		City:                c.City,
+		StateProvinceRegion: c.StateProvinceRegion,
+		PostalCode:          c.PostalCode,
+		Country:             c.Country,
+		CustomFields:        c.CustomFields,
+	}, nil
+}
+
+// resolveCustomFields rekeys the custom fields of the contacts from field
+// names, as configured, to the field ids the upsert expects. Keys that are
+// already ids are kept. Fields that cannot be resolved, ie. not defined in
+// sendgrid, are dropped with a log line so the contact is still added.
+func (s *Sendgrid) resolveCustomFields(ctx context.Context, contacts []*sendgrid.Contact) {
+	for _, c := range contacts {
+		if len(c.CustomFields) == 0 {
+			continue
+		}
+		fields := make(map[string]interface{}, len(c.CustomFields))
+		for name, value := range c.CustomFields {
+			id, err := s.customFieldID(ctx, name)
+			if err != nil {
+				log.Printf("sendgrid: dropping custom field of %s: %v\n", c.Email, err)
+				continue
+			}
+			fields[id] = value
+		}
+		c.CustomFields = fields
+	}
+}
+
+// customFieldID returns the id of the custom field, refetching the field
+// definitions once when the name is unknown, ie. created since
+func (s *Sendgrid) customFieldID(ctx context.Context, name string) (string, error) {
+	s.fieldsMu.Lock()
+	defer s.fieldsMu.Unlock()
+
+	if id, ok := s.fieldIDs[name]; ok {
+		return id, nil
+	}
+	fields, _, err := s.Client.CustomField.List(ctx)
+	if err != nil {
+		return "", fmt.Errorf("listing custom fields: %w", err)
+	}
+	s.fieldIDs = make(map[string]string, 2*len(fields.CustomFields))
+	for _, f := range fields.CustomFields {
+		s.fieldIDs[f.Name] = f.ID
+		s.fieldIDs[f.ID] = f.ID
+	}
+	if id, ok := s.fieldIDs[name]; ok {
+		return id, nil
+	}
+	return "", fmt.Errorf("%w %q", ErrUnknownCustomField, name)
+}
+
+// RemoveContact removes the contact with the given email from the lists.
+// Unknown contacts are ignored.
+func (s *Sendgrid) RemoveContact(ctx context.Context, email string, listIDs []string) error {
+	if s.Sandbox || len(listIDs) == 0 {
+		return nil
+	}
+	contacts, _, err := s.Client.Contact.GetByEmails(ctx, email)
+	if err != nil {
 		return err
 	}
+	contact, ok := contacts[email]
+	if !ok {
+		return nil
+	}
+	for _, listID := range listIDs {
+		if _, _, err := s.Client.List.RemoveContacts(ctx, listID, contact.ID); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func (s *Sendgrid) Send(ctx context.Context, v *sendgrid.MailRequest) error {
+// DeleteContact erases the contact with the given email, ie. for GDPR
+// erasure requests. Unknown contacts are ignored.
+func (s *Sendgrid) DeleteContact(ctx context.Context, email string) error {
 	if s.Sandbox {
+		return nil
+	}
+	contacts, _, err := s.Client.Contact.GetByEmails(ctx, email)
+	if err != nil {
+		return err
+	}
+	contact, ok := contacts[email]
+	if !ok {
+		return nil
+	}
+	_, _, err = s.Client.Contact.Delete(ctx, contact.ID)
+	return err
+}
+
+// Send sends the message as a dynamic template email
+func (s *Sendgrid) Send(ctx context.Context, m *Message) error {
+	to := make([]*sendgrid.MailAddress, len(m.To))
+	for i, a := range m.To {
+		to[i] = &sendgrid.MailAddress{Email: a.Email, Name: a.Name}
+	}
+	req := &sendgrid.MailRequest{
+		Personalizations: []*sendgrid.MailPerson{
+			{
+				To:                  to,
+				DynamicTemplateData: m.TemplateData,
+			},
+		},
+		From:         sendgrid.MailAddress{Email: m.From.Email, Name: m.From.Name},
+		TemplateID:   m.TemplateID,
+		Categories:   m.Categories,
+		CustomArgs:   m.CustomArgs,
+		MailSettings: &sendgrid.MailSettings{},
+	}
+	if m.ReplyTo != nil {
+		req.ReplyTo = &sendgrid.MailAddress{Email: m.ReplyTo.Email, Name: m.ReplyTo.Name}
+	}
+	if m.UnsubscribeGroupID != 0 {
+		req.Asm = &sendgrid.Asm{
+			GroupID:         m.UnsubscribeGroupID,
+			GroupsToDisplay: m.UnsubscribeGroups,
+		}
+	}
+	for _, a := range m.Attachments {
+		req.Attachments = append(req.Attachments, sendgrid.NewAttachment(a.Filename, a.ContentType, a.Content))
+	}
+	if m.Marketing && s.checkSuppressions {
+		// recipients who unsubscribed from the group or globally, bounced or
+		// reported spam are skipped, nothing is sent when none is left
+		if err := s.dropSuppressed(ctx, req); err != nil {
+			return fmt.Errorf("suppression check: %w", err)
+		}
+		if len(req.Personalizations) == 0 {
+			return nil
+		}
+	}
+	return s.SendMail(ctx, req)
+}
+
+// SendMail sends the email as is, in sandbox mode when configured
+func (s *Sendgrid) SendMail(ctx context.Context, v *sendgrid.MailRequest) error {
+	if s.Sandbox {
+		if v.MailSettings == nil {
+			v.MailSettings = &sendgrid.MailSettings{}
+		}
 		v.MailSettings.SandboxMode = sendgrid.NewSetting(true)
 	}
 	if _, err := s.Client.Mail.Send(ctx, v); err != nil {
@@ -50,3 +302,74 @@ func (s *Sendgrid) Send(ctx context.Context, v *sendgrid.MailRequest) error {
 	}
 	return nil
 }
+
+// dropSuppressed removes suppressed to recipients from the email, and the
+// personalizations left without one
+func (s *Sendgrid) dropSuppressed(ctx context.Context, v *sendgrid.MailRequest) error {
+	var emails []string
+	for _, p := range v.Personalizations {
+		for _, to := range p.To {
+			emails = append(emails, to.Email)
+		}
+	}
+	if len(emails) == 0 {
+		return nil
+	}
+
+	suppressed := map[string]bool{}
+	if v.Asm != nil && v.Asm.GroupID != 0 {
+		groupSuppressed, _, err := s.Client.AsmGroup.SearchSuppressions(ctx, v.Asm.GroupID, emails...)
+		if err != nil {
+			return err
+		}
+		for _, email := range groupSuppressed {
+			suppressed[strings.ToLower(email)] = true
+		}
+	}
+	for _, email := range emails {
+		if suppressed[strings.ToLower(email)] {
+			continue
+		}
+		ok, err := s.isSuppressed(ctx, email)
+		if err != nil {
+			return err
+		}
+		suppressed[strings.ToLower(email)] = ok
+	}
+
+	personalizations := v.Personalizations[:0]
+	for _, p := range v.Personalizations {
+		to := p.To[:0]
+		for _, addr := range p.To {
+			if suppressed[strings.ToLower(addr.Email)] {
+				log.Printf("sendgrid: skipping suppressed recipient %s\n", addr.Email)
+				continue
+			}
+			to = append(to, addr)
+		}
+		if p.To = to; len(p.To) > 0 {
+			personalizations = append(personalizations, p)
+		}
+	}
+	v.Personalizations = personalizations
+	return nil
+}
+
+// isSuppressed reports whether the email is globally unsubscribed, bounced
+// or reported spam
+func (s *Sendgrid) isSuppressed(ctx context.Context, email string) (bool, error) {
+	unsubscribed, _, err := s.Client.Suppression.IsGloballyUnsubscribed(ctx, email)
+	if err != nil || unsubscribed {
+		return unsubscribed, err
+	}
+	for _, list := range []string{sendgrid.SuppressionBounces, sendgrid.SuppressionSpamReports} {
+		entries, _, err := s.Client.Suppression.Get(ctx, list, email)
+		if err != nil {
+			return false, err
+		}
+		if len(entries) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,291 @@
+package connect
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/500k-agency/function/lib/handlebars"
+)
+
+const (
+	defaultSMTPPort = 587
+	// port of smtp over implicit tls
+	smtpsPort = 465
+	// max duration of a delivery when the context sets no deadline
+	smtpTimeout = 30 * time.Second
+
+	templateExt = ".handlebars"
+)
+
+var (
+	titleRegexp = regexp.MustCompile(`(?is)<title>(.*?)</title>`)
+
+	ErrSMTPNoTLS = errors.New("smtp server does not offer STARTTLS")
+)
+
+// SMTP renders the handlebars templates locally and sends them to an smtp
+// server. Port 465 connects over tls, other ports upgrade the connection
+// with STARTTLS when the server offers it, or fail when tls is required.
+// SMTP has no contact lists.
+type SMTP struct {
+	host         string
+	port         int
+	username     string
+	password     string
+	requireTLS   bool
+	templatesDir string
+
+	// trusted roots, nil for the system roots
+	rootCAs *x509.CertPool
+}
+
+type SMTPConfig struct {
+	Host     string `toml:"host"`
+	Port     int    `toml:"port"`
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+
+	// refuse to send when the server does not offer STARTTLS, instead of
+	// sending in plaintext. Always on for port 465, which is tls throughout.
+	RequireTLS bool `toml:"require_tls"`
+
+	// directory of the handlebars templates, template_id names the file
+	TemplatesDir string `toml:"templates_dir"`
+}
+
+func SetupSMTP(conf SMTPConfig) *SMTP {
+	s := &SMTP{
+		host:         conf.Host,
+		port:         conf.Port,
+		username:     conf.Username,
+		password:     conf.Password,
+		requireTLS:   conf.RequireTLS,
+		templatesDir: conf.TemplatesDir,
+	}
+	if s.port == 0 {
+		s.port = defaultSMTPPort
+	}
+	if s.templatesDir == "" {
+		s.templatesDir = "templates"
+	}
+	return s
+}
+
+// Send renders <templates_dir>/<template_id>.handlebars with the template
+// data and sends it, the subject is the rendered <title>. Custom args and
+// categories have no smtp equivalent and are dropped.
+func (s *SMTP) Send(ctx context.Context, m *Message) error {
+	src, err := os.ReadFile(filepath.Join(s.templatesDir, filepath.Base(m.TemplateID)+templateExt))
+	if err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	body, err := handlebars.Render(string(src), m.TemplateData)
+	if err != nil {
+		return fmt.Errorf("smtp: %s: %w", m.TemplateID, err)
+	}
+	msg, err := buildMIME(m, body)
+	if err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+
+	to := make([]string, len(m.To))
+	for i, a := range m.To {
+		to[i] = a.Email
+	}
+	if err := s.send(ctx, m.From.Email, to, msg); err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	return nil
+}
+
+func (s *SMTP) send(ctx context.Context, from string, to []string, msg []byte) error {
+	addr := net.JoinHostPort(s.host, strconv.Itoa(s.port))
+	tlsConfig := &tls.Config{ServerName: s.host, RootCAs: s.rootCAs}
+	implicitTLS := s.port == smtpsPort
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(smtpTimeout)
+	}
+	dialer := &net.Dialer{Deadline: deadline}
+	var conn net.Conn
+	var err error
+	if implicitTLS {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(deadline)
+
+	c, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if !implicitTLS {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(tlsConfig); err != nil {
+				return err
+			}
+		} else if s.requireTLS {
+			return ErrSMTPNoTLS
+		}
+	}
+	if s.username != "" {
+		// refuses to send the password unencrypted, except to localhost
+		if err := c.Auth(smtp.PlainAuth("", s.username, s.password, s.host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// buildMIME formats the html email with its attachments
+func buildMIME(m *Message, body string) ([]byte, error) {
+	var subject string
+	if match := titleRegexp.FindStringSubmatch(body); match != nil {
+		subject = html.UnescapeString(strings.TrimSpace(match[1]))
+	}
+
+	var buf bytes.Buffer
+	header := textproto.MIMEHeader{}
+	header.Set("From", formatAddress(m.From))
+	header.Set("To", formatAddresses(m.To))
+	if m.ReplyTo != nil {
+		header.Set("Reply-To", formatAddress(*m.ReplyTo))
+	}
+	header.Set("Subject", mime.QEncoding.Encode("utf-8", subject))
+	header.Set("Date", time.Now().Format(time.RFC1123Z))
+	header.Set("Message-ID", messageID(m.From.Email))
+	header.Set("MIME-Version", "1.0")
+
+	if len(m.Attachments) == 0 {
+		header.Set("Content-Type", "text/html; charset=utf-8")
+		header.Set("Content-Transfer-Encoding", "quoted-printable")
+		writeHeader(&buf, header)
+		if err := writeQuotedPrintable(&buf, body); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	w := multipart.NewWriter(&buf)
+	header.Set("Content-Type", "multipart/mixed; boundary="+w.Boundary())
+	writeHeader(&buf, header)
+
+	part, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/html; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := writeQuotedPrintable(part, body); err != nil {
+		return nil, err
+	}
+	for _, a := range m.Attachments {
+		part, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {a.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename})},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeBase64(part, a.Content); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeHeader(buf *bytes.Buffer, header textproto.MIMEHeader) {
+	for _, k := range []string{"From", "To", "Reply-To", "Subject", "Date", "Message-ID", "MIME-Version", "Content-Type", "Content-Transfer-Encoding"} {
+		if v := header.Get(k); v != "" {
+			fmt.Fprintf(buf, "%s: %s\r\n", k, v)
+		}
+	}
+	buf.WriteString("\r\n")
+}
+
+func writeQuotedPrintable(w io.Writer, body string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// writeBase64 writes the content base64 encoded in lines of 76 characters
+func writeBase64(w io.Writer, content []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(content)
+	for len(encoded) > 0 {
+		n := 76
+		if len(encoded) < n {
+			n = len(encoded)
+		}
+		if _, err := fmt.Fprintf(w, "%s\r\n", encoded[:n]); err != nil {
+			return err
+		}
+		encoded = encoded[n:]
+	}
+	return nil
+}
+
+// messageID returns a random message id at the sender's domain
+func messageID(from string) string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	_, domain, ok := strings.Cut(from, "@")
+	if !ok {
+		domain = "localhost"
+	}
+	return "<" + hex.EncodeToString(b) + "@" + domain + ">"
+}
@@ -0,0 +1,245 @@
+package connect
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpServer is a stand-in smtp server taking one delivery per connection,
+// offering STARTTLS when tlsConfig is set
+type smtpServer struct {
+	addr      *net.TCPAddr
+	tlsConfig *tls.Config
+	got       chan smtpDelivery
+}
+
+type smtpDelivery struct {
+	tls  bool
+	auth string
+	from string
+	to   []string
+	data string
+}
+
+func newSMTPServer(t *testing.T, tlsConfig *tls.Config) *smtpServer {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	s := &smtpServer{addr: l.Addr().(*net.TCPAddr), tlsConfig: tlsConfig, got: make(chan smtpDelivery, 1)}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+	var d smtpDelivery
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			tp.PrintfLine("250-localhost")
+			if s.tlsConfig != nil && !d.tls {
+				tp.PrintfLine("250-STARTTLS")
+			}
+			tp.PrintfLine("250 AUTH PLAIN")
+		case "STARTTLS":
+			tp.PrintfLine("220 ready")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn, d.tls = tlsConn, true
+			tp = textproto.NewConn(conn)
+		case "AUTH":
+			d.auth = arg
+			tp.PrintfLine("235 ok")
+		case "MAIL":
+			d.from = arg
+			tp.PrintfLine("250 ok")
+		case "RCPT":
+			d.to = append(d.to, arg)
+			tp.PrintfLine("250 ok")
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			b, _ := tp.ReadDotBytes()
+			d.data = string(b)
+			tp.PrintfLine("250 queued")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			s.got <- d
+			return
+		default:
+			tp.PrintfLine("502 unknown command")
+		}
+	}
+}
+
+// selfSigned returns a server certificate for 127.0.0.1 and a pool trusting it
+func selfSigned(t *testing.T) (*tls.Config, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "smtp stand-in"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}, pool
+}
+
+func TestSMTPSend(t *testing.T) {
+	serverTLS, roots := selfSigned(t)
+	tests := []struct {
+		name       string
+		serverTLS  *tls.Config
+		requireTLS bool
+		username   string
+		wantTLS    bool
+		wantErr    error
+	}{
+		{"plaintext", nil, false, "", false, nil},
+		{"plaintext auth to localhost", nil, false, "shop", false, nil},
+		{"starttls", serverTLS, true, "shop", true, nil},
+		{"tls required", nil, true, "", false, ErrSMTPNoTLS},
+	}
+
+	dir := t.TempDir()
+	tmpl := `<html><head><title>Thanks {{name}} &amp; welcome</title></head><body>Hi {{name}}</body></html>`
+	if err := os.WriteFile(filepath.Join(dir, "purchase"+templateExt), []byte(tmpl), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newSMTPServer(t, tt.serverTLS)
+			s := SetupSMTP(SMTPConfig{
+				Host:         "127.0.0.1",
+				Port:         srv.addr.Port,
+				Username:     tt.username,
+				Password:     "pw",
+				RequireTLS:   tt.requireTLS,
+				TemplatesDir: dir,
+			})
+			s.rootCAs = roots
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			err := s.Send(ctx, &Message{
+				From:         Address{Email: "shop@example.com", Name: "Shop"},
+				To:           []Address{{Email: "ada@example.com"}, {Email: "bob@example.com"}},
+				TemplateID:   "purchase",
+				TemplateData: map[string]interface{}{"name": "Ada"},
+				Attachments:  []Attachment{{Filename: "book.pdf", ContentType: "application/pdf", Content: []byte("pdf")}},
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			d := <-srv.got
+			if d.tls != tt.wantTLS {
+				t.Errorf("tls %v, want %v", d.tls, tt.wantTLS)
+			}
+			if (d.auth != "") != (tt.username != "") {
+				t.Errorf("auth %q with username %q", d.auth, tt.username)
+			}
+			if d.from != "FROM:<shop@example.com>" || strings.Join(d.to, ",") != "TO:<ada@example.com>,TO:<bob@example.com>" {
+				t.Errorf("envelope %s %v", d.from, d.to)
+			}
+			for _, want := range []string{
+				"From: \"Shop\" <shop@example.com>\n",
+				"To: ada@example.com, bob@example.com\n",
+				"Subject: Thanks Ada & welcome\n",
+				"Content-Type: multipart/mixed; boundary=",
+				"Hi Ada",
+				"Content-Disposition: attachment; filename=book.pdf\n",
+				"cGRm\n",
+			} {
+				if !strings.Contains(d.data, want) {
+					t.Errorf("message lacks %q:\n%s", want, d.data)
+				}
+			}
+		})
+	}
+}
+
+func TestSMTPMissingTemplate(t *testing.T) {
+	s := SetupSMTP(SMTPConfig{Host: "127.0.0.1", TemplatesDir: t.TempDir()})
+	err := s.Send(context.Background(), &Message{TemplateID: "../../etc/passwd"})
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("got %v, want a missing template", err)
+	}
+}
+
+func TestSMTPTimeout(t *testing.T) {
+	// a server that accepts connections and never greets
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			bufio.NewReader(conn).ReadByte()
+			conn.Close()
+		}
+	}()
+
+	s := SetupSMTP(SMTPConfig{Host: "127.0.0.1", Port: l.Addr().(*net.TCPAddr).Port})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	var netErr net.Error
+	if err := s.send(ctx, "a@example.com", []string{"b@example.com"}, nil); !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("got %v, want a timeout", err)
+	}
+}
@@ -1,6 +1,8 @@
 package connect
 
 import (
+	"errors"
+
 	"github.com/stripe/stripe-go/v76"
 	"github.com/stripe/stripe-go/v76/client"
 	"github.com/stripe/stripe-go/v76/webhook"
@@ -16,6 +18,8 @@ type Stripe struct {
 
 var (
 	StripeClient *Stripe
+
+	ErrSessionNotFound = errors.New("checkout session not found")
 )
 
 // SetupStripe sets up stripe with the credentials given
@@ -53,6 +57,11 @@ func (s *Stripe) CreateCustomerBillingPortal(customerID, returnUrl string) (*str
 	return s.client.BillingPortalSessions.New(params)
 }
 
+// GetCustomer fetches the stripe customer
+func (s *Stripe) GetCustomer(customerID string) (*stripe.Customer, error) {
+	return s.client.Customers.Get(customerID, nil)
+}
+
 // ConstructEvent validates stripe webhook secret is authentic
 func (s *Stripe) ConstructEvent(body []byte, header string) (stripe.Event, error) {
 	return webhook.ConstructEventWithOptions(
@@ -71,8 +80,25 @@ func (s *Stripe) VerifySession(sessionID string) (*stripe.CheckoutSession, error
 	return s.client.CheckoutSessions.Get(sessionID, params)
 }
 
-// Sessio
-func (s *Stripe) GetSessionItems(sessionID string) []*stripe.LineItem {
+// GetSessionByPaymentIntent finds the checkout session that created the payment intent
+func (s *Stripe) GetSessionByPaymentIntent(paymentIntentID string) (*stripe.CheckoutSession, error) {
+	params := &stripe.CheckoutSessionListParams{
+		PaymentIntent: stripe.String(paymentIntentID),
+	}
+	params.Limit = stripe.Int64(1)
+
+	iter := s.client.CheckoutSessions.List(params)
+	if iter.Next() {
+		return iter.CheckoutSession(), nil
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	return nil, ErrSessionNotFound
+}
+
+// GetSessionItems lists the line items purchased in the checkout session
+func (s *Stripe) GetSessionItems(sessionID string) ([]*stripe.LineItem, error) {
 	params := &stripe.CheckoutSessionListLineItemsParams{
 		Session: stripe.String(sessionID),
 	}
@@ -82,5 +108,8 @@ func (s *Stripe) GetSessionItems(sessionID string) []*stripe.LineItem {
 	for iter.Next() {
 		items = append(items, iter.LineItem())
 	}
-	return items
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
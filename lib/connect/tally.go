@@ -7,27 +7,55 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/500k-agency/function/waitlist"
 )
 
+// retried deliveries keep the createdAt of the original event
+const defaultTallyTolerance = 24 * time.Hour
+
 // Tally config struct with exposed methods needed
 type Tally struct {
-	config Config
+	secrets   []string
+	tolerance time.Duration
+}
+
+type TallyConfig struct {
+	// signing secret of the tally webhooks
+	WebhookSecret string `toml:"webhook_secret"`
+	// previous secrets still accepted while rolling the secret over
+	WebhookSecrets []string `toml:"webhook_secrets"`
+
+	// max age of an event's createdAt, defaults to 24 hours. -1 to disable
+	ToleranceSeconds int `toml:"tolerance_seconds"`
 }
 
 var (
 	TallyClient *Tally
 
-	ErrNotSigned        = errors.New("webhook has no Stripe-Signature header")
-	ErrNoValidSignature = errors.New("webhook had no valid signature")
+	ErrTallyNoSecret               = errors.New("tally webhook secret is not configured")
+	ErrTallyNotSigned              = errors.New("tally webhook has no Tally-Signature header")
+	ErrTallyInvalidSignature       = errors.New("tally webhook had no valid signature")
+	ErrTallyInvalidTimestamp       = errors.New("tally webhook event has no valid createdAt")
+	ErrTallyTimestampOutsideWindow = errors.New("tally webhook event outside of the tolerance window")
 )
 
-// SetupTally sets up stripe with the credentials given
-func SetupTally(conf Config) *Tally {
-	TallyClient = &Tally{
-		config: conf,
+// SetupTally sets up tally with the webhook secrets given
+func SetupTally(conf TallyConfig) *Tally {
+	t := &Tally{}
+	for _, s := range append([]string{conf.WebhookSecret}, conf.WebhookSecrets...) {
+		if s != "" {
+			t.secrets = append(t.secrets, s)
+		}
 	}
+	switch {
+	case conf.ToleranceSeconds > 0:
+		t.tolerance = time.Duration(conf.ToleranceSeconds) * time.Second
+	case conf.ToleranceSeconds == 0:
+		t.tolerance = defaultTallyTolerance
+	}
+	TallyClient = t
 	return TallyClient
 }
 
@@ -37,22 +65,48 @@ func ComputeSignature(payload []byte, secret string) []byte {
 	return mac.Sum(nil)
 }
 
-// ConstructEvent validates stripe webhook secret is authentic
+// ConstructEvent validates the tally webhook is signed with one of the
+// secrets and was created within the tolerance window
 func (s *Tally) ConstructEvent(body []byte, header string) (*waitlist.Event, error) {
 	t := &waitlist.Event{}
 
+	if len(s.secrets) == 0 {
+		return t, ErrTallyNoSecret
+	}
 	if header == "" {
-		return t, ErrNotSigned
+		return t, ErrTallyNotSigned
 	}
-
-	expectedSignature := base64.StdEncoding.EncodeToString(ComputeSignature(body, s.config.WebhookSecret))
-	if header != expectedSignature {
-		return t, ErrNoValidSignature
+	signature, err := base64.StdEncoding.DecodeString(header)
+	if err != nil {
+		return t, fmt.Errorf("%w: %v", ErrTallyInvalidSignature, err)
+	}
+	if !s.validSignature(body, signature) {
+		return t, ErrTallyInvalidSignature
 	}
 
 	if err := json.Unmarshal(body, &t); err != nil {
 		return t, fmt.Errorf("Failed to parse webhook body json: %s", err.Error())
 	}
 
+	if s.tolerance > 0 {
+		if t.CreatedAt == nil || t.CreatedAt.IsZero() {
+			return t, ErrTallyInvalidTimestamp
+		}
+		if d := time.Since(*t.CreatedAt); d > s.tolerance || d < -s.tolerance {
+			return t, ErrTallyTimestampOutsideWindow
+		}
+	}
+
 	return t, nil
 }
+
+// validSignature compares the signature against every secret in constant
+// time
+func (s *Tally) validSignature(body, signature []byte) bool {
+	for _, secret := range s.secrets {
+		if hmac.Equal(signature, ComputeSignature(body, secret)) {
+			return true
+		}
+	}
+	return false
+}
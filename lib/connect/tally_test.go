@@ -0,0 +1,89 @@
+package connect
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// tallyBody returns a webhook body created at the given time
+func tallyBody(createdAt time.Time) []byte {
+	return []byte(fmt.Sprintf(`{"eventId":"ev_1","eventType":"FORM_RESPONSE","createdAt":%q}`, createdAt.UTC().Format(time.RFC3339)))
+}
+
+func tallySign(body []byte, secret string) string {
+	return base64.StdEncoding.EncodeToString(ComputeSignature(body, secret))
+}
+
+func TestTallyConstructEvent(t *testing.T) {
+	tally := SetupTally(TallyConfig{WebhookSecret: "current", WebhookSecrets: []string{"", "previous"}, ToleranceSeconds: 60})
+	body := tallyBody(time.Now())
+	stale := tallyBody(time.Now().Add(-2 * time.Minute))
+	future := tallyBody(time.Now().Add(2 * time.Minute))
+	undated := []byte(`{"eventId":"ev_1"}`)
+
+	tests := []struct {
+		name   string
+		body   []byte
+		header string
+		want   error
+	}{
+		{"valid", body, tallySign(body, "current"), nil},
+		{"previous secret", body, tallySign(body, "previous"), nil},
+		{"not signed", body, "", ErrTallyNotSigned},
+		{"unknown secret", body, tallySign(body, "other"), ErrTallyInvalidSignature},
+		{"tampered", append(body[:len(body):len(body)], ' '), tallySign(body, "current"), ErrTallyInvalidSignature},
+		{"truncated signature", body, tallySign(body, "current")[:20], ErrTallyInvalidSignature},
+		{"not base64", body, "!!!", ErrTallyInvalidSignature},
+		{"stale", stale, tallySign(stale, "current"), ErrTallyTimestampOutsideWindow},
+		{"from the future", future, tallySign(future, "current"), ErrTallyTimestampOutsideWindow},
+		{"no createdAt", undated, tallySign(undated, "current"), ErrTallyInvalidTimestamp},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ev, err := tally.ConstructEvent(tt.body, tt.header)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			if err == nil && ev.EventID != "ev_1" {
+				t.Errorf("event %+v", ev)
+			}
+		})
+	}
+}
+
+func TestTallyTolerance(t *testing.T) {
+	old := tallyBody(time.Now().Add(-48 * time.Hour))
+	retried := tallyBody(time.Now().Add(-23 * time.Hour))
+	undated := []byte(`{"eventId":"ev_1"}`)
+
+	tests := []struct {
+		name      string
+		tolerance int
+		body      []byte
+		want      error
+	}{
+		{"default window", 0, retried, nil},
+		{"outside the default window", 0, old, ErrTallyTimestampOutsideWindow},
+		{"disabled", -1, old, nil},
+		{"disabled without createdAt", -1, undated, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tally := SetupTally(TallyConfig{WebhookSecret: "current", ToleranceSeconds: tt.tolerance})
+			if _, err := tally.ConstructEvent(tt.body, tallySign(tt.body, "current")); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestTallyNoSecret(t *testing.T) {
+	body := tallyBody(time.Now())
+	tally := SetupTally(TallyConfig{WebhookSecrets: []string{""}})
+	if _, err := tally.ConstructEvent(body, tallySign(body, "")); !errors.Is(err, ErrTallyNoSecret) {
+		t.Errorf("got %v, want ErrTallyNoSecret", err)
+	}
+}
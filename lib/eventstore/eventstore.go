@@ -0,0 +1,153 @@
+package eventstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// State is the processing state recorded for a webhook event
+type State string
+
+const (
+	StateProcessing State = "processing"
+	StateProcessed  State = "processed"
+	StateFailed     State = "failed"
+)
+
+const (
+	DriverMemory    = "memory"
+	DriverFile      = "file"
+	DriverFirestore = "firestore"
+
+	// defaultLease is how long an event may stay in processing before
+	// another delivery is allowed to pick it up again.
+	defaultLease = 10 * time.Minute
+
+	// retention is how long records are kept, past the 30 days Stripe
+	// lets events be resent from its dashboard
+	retention = 31 * 24 * time.Hour
+)
+
+var (
+	ErrNotFound         = errors.New("event not found")
+	ErrAlreadyProcessed = errors.New("event already processed")
+	ErrInProgress       = errors.New("event is being processed")
+	ErrUnknownDriver    = errors.New("unknown event store driver")
+)
+
+// Record holds the processing state of a single webhook event
+type Record struct {
+	ID        string    `json:"id"`
+	State     State     `json:"state"`
+	Attempts  int       `json:"attempts"`
+	Error     string    `json:"error,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// EventStore records processed webhook events so provider retries
+// are not handled more than once.
+type EventStore interface {
+	// Get returns the record for the event or ErrNotFound
+	Get(ctx context.Context, id string) (*Record, error)
+
+	// Begin marks the event as processing. It returns ErrAlreadyProcessed
+	// if the event was handled before and ErrInProgress if another
+	// delivery holds an unexpired lease on it.
+	Begin(ctx context.Context, id string) error
+
+	// Complete marks the event as processed
+	Complete(ctx context.Context, id string) error
+
+	// Fail marks the event as failed so the next delivery retries it
+	Fail(ctx context.Context, id string, cause error) error
+}
+
+// Config holds the event store configuration
+type Config struct {
+	Driver       string `toml:"driver"`        // memory (default), file or firestore
+	Path         string `toml:"path"`          // file driver: path to the store file
+	ProjectID    string `toml:"project_id"`    // firestore driver: gcp project
+	DatabaseID   string `toml:"database_id"`   // firestore driver: defaults to (default)
+	Collection   string `toml:"collection"`    // firestore driver: defaults to events
+	LeaseSeconds int    `toml:"lease_seconds"` // processing lease, defaults to 10 minutes
+}
+
+func (c Config) lease() time.Duration {
+	if c.LeaseSeconds > 0 {
+		return time.Duration(c.LeaseSeconds) * time.Second
+	}
+	return defaultLease
+}
+
+var (
+	DefaultStore EventStore
+
+	mu         sync.Mutex
+	loadedConf *Config
+)
+
+// Setup configures the default event store. Calling it again with the same
+// config keeps the existing store, so in-memory state survives across
+// requests served by the same instance.
+func Setup(conf Config) (EventStore, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if DefaultStore != nil && loadedConf != nil && *loadedConf == conf {
+		return DefaultStore, nil
+	}
+
+	store, err := New(conf)
+	if err != nil {
+		return nil, err
+	}
+	DefaultStore = store
+	loadedConf = &conf
+	return DefaultStore, nil
+}
+
+// New instantiates an event store for the configured driver
+func New(conf Config) (EventStore, error) {
+	switch conf.Driver {
+	case "", DriverMemory:
+		return NewMemoryStore(conf.lease()), nil
+	case DriverFile:
+		return NewFileStore(conf.Path, conf.lease())
+	case DriverFirestore:
+		return NewFirestoreStore(conf.ProjectID, conf.DatabaseID, conf.Collection, conf.lease())
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownDriver, conf.Driver)
+}
+
+// Key namespaces an event id by its source, ie. stripe or tally
+func Key(source, id string) string {
+	return source + ":" + id
+}
+
+// begin applies the Begin state transition to an existing record
+func begin(rec *Record, lease time.Duration, now time.Time) error {
+	if rec == nil {
+		return nil
+	}
+	switch rec.State {
+	case StateProcessed:
+		return ErrAlreadyProcessed
+	case StateProcessing:
+		if now.Sub(rec.UpdatedAt) < lease {
+			return ErrInProgress
+		}
+	}
+	return nil
+}
+
+// prune drops the records last updated before the retention window
+func prune(records map[string]Record, now time.Time) {
+	for id, rec := range records {
+		if now.Sub(rec.UpdatedAt) > retention {
+			delete(records, id)
+		}
+	}
+}
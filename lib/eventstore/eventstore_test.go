@@ -0,0 +1,194 @@
+package eventstore
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/500k-agency/function/lib/firestore/firestoretest"
+)
+
+func TestBegin(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name string
+		rec  *Record
+		want error
+	}{
+		{"new event", nil, nil},
+		{"failed", &Record{State: StateFailed, UpdatedAt: now}, nil},
+		{"processed", &Record{State: StateProcessed, UpdatedAt: now.Add(-time.Hour)}, ErrAlreadyProcessed},
+		{"leased", &Record{State: StateProcessing, UpdatedAt: now.Add(-time.Minute)}, ErrInProgress},
+		{"lease expired", &Record{State: StateProcessing, UpdatedAt: now.Add(-time.Hour)}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := begin(tt.rec, defaultLease, now); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrune(t *testing.T) {
+	now := time.Now()
+	records := map[string]Record{
+		"recent": {UpdatedAt: now.Add(-24 * time.Hour)},
+		"old":    {UpdatedAt: now.Add(-retention - time.Hour)},
+	}
+	prune(records, now)
+	if _, ok := records["old"]; ok {
+		t.Error("kept a record past the retention window")
+	}
+	if _, ok := records["recent"]; !ok {
+		t.Error("dropped a recent record")
+	}
+}
+
+// drivers returns the configs of every driver, firestore against a stand-in
+func drivers() []struct {
+	name string
+	conf func(t *testing.T) Config
+} {
+	return []struct {
+		name string
+		conf func(t *testing.T) Config
+	}{
+		{"memory", func(t *testing.T) Config { return Config{} }},
+		{"file", func(t *testing.T) Config {
+			return Config{Driver: DriverFile, Path: filepath.Join(t.TempDir(), "events.json")}
+		}},
+		{"firestore", func(t *testing.T) Config {
+			firestoretest.NewServer(t)
+			return Config{Driver: DriverFirestore, ProjectID: firestoretest.ProjectID}
+		}},
+	}
+}
+
+func TestStateMachine(t *testing.T) {
+	for _, d := range drivers() {
+		t.Run(d.name, func(t *testing.T) {
+			store, err := New(d.conf(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := context.Background()
+			id := Key("stripe", "evt_1")
+
+			if _, err := store.Get(ctx, id); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("Get before Begin: got %v, want ErrNotFound", err)
+			}
+
+			steps := []struct {
+				name     string
+				do       func() error
+				want     error
+				state    State
+				attempts int
+				errMsg   string
+			}{
+				{"begin", func() error { return store.Begin(ctx, id) }, nil, StateProcessing, 1, ""},
+				{"concurrent delivery", func() error { return store.Begin(ctx, id) }, ErrInProgress, StateProcessing, 1, ""},
+				{"fail", func() error { return store.Fail(ctx, id, errors.New("sendgrid down")) }, nil, StateFailed, 1, "sendgrid down"},
+				{"retry", func() error { return store.Begin(ctx, id) }, nil, StateProcessing, 2, ""},
+				{"complete", func() error { return store.Complete(ctx, id) }, nil, StateProcessed, 2, ""},
+				{"redelivery", func() error { return store.Begin(ctx, id) }, ErrAlreadyProcessed, StateProcessed, 2, ""},
+			}
+			for _, step := range steps {
+				if err := step.do(); !errors.Is(err, step.want) {
+					t.Fatalf("%s: got %v, want %v", step.name, err, step.want)
+				}
+				rec, err := store.Get(ctx, id)
+				if err != nil {
+					t.Fatalf("%s: %v", step.name, err)
+				}
+				if rec.ID != id || rec.State != step.state || rec.Attempts != step.attempts || rec.Error != step.errMsg {
+					t.Errorf("%s: got %+v, want state %s, %d attempts, error %q", step.name, rec, step.state, step.attempts, step.errMsg)
+				}
+			}
+		})
+	}
+}
+
+func TestLeaseExpiry(t *testing.T) {
+	for _, d := range drivers() {
+		t.Run(d.name, func(t *testing.T) {
+			conf := d.conf(t)
+			conf.LeaseSeconds = 1
+			store, err := New(conf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := context.Background()
+
+			if err := store.Begin(ctx, "evt"); err != nil {
+				t.Fatal(err)
+			}
+			// the delivery holding the lease crashed without Fail
+			time.Sleep(1100 * time.Millisecond)
+			if err := store.Begin(ctx, "evt"); err != nil {
+				t.Errorf("Begin after the lease expired: %v", err)
+			}
+		})
+	}
+}
+
+func TestConcurrentBegin(t *testing.T) {
+	for _, d := range drivers() {
+		t.Run(d.name, func(t *testing.T) {
+			store, err := New(d.conf(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var wg sync.WaitGroup
+			errs := make([]error, 8)
+			for i := range errs {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					errs[i] = store.Begin(context.Background(), "evt")
+				}(i)
+			}
+			wg.Wait()
+
+			began := 0
+			for _, err := range errs {
+				switch {
+				case err == nil:
+					began++
+				case !errors.Is(err, ErrInProgress):
+					t.Errorf("unexpected error %v", err)
+				}
+			}
+			if began != 1 {
+				t.Errorf("%d deliveries began processing, want 1", began)
+			}
+		})
+	}
+}
+
+func TestSetupKeepsStore(t *testing.T) {
+	t.Cleanup(func() { DefaultStore, loadedConf = nil, nil })
+
+	first, err := Setup(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.Begin(context.Background(), "evt")
+	again, _ := Setup(Config{})
+	if again != first {
+		t.Error("Setup with the same config replaced the store")
+	}
+	other, _ := Setup(Config{LeaseSeconds: 5})
+	if other == first {
+		t.Error("Setup with another config kept the store")
+	}
+
+	if _, err := New(Config{Driver: "redis"}); !errors.Is(err, ErrUnknownDriver) {
+		t.Errorf("unknown driver: got %v, want ErrUnknownDriver", err)
+	}
+}
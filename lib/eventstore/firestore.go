@@ -0,0 +1,126 @@
+package eventstore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/500k-agency/function/lib/firestore"
+)
+
+// FirestoreStore keeps event records as documents in a Firestore collection
+// using the REST API. State transitions are guarded by Firestore
+// preconditions, so concurrent deliveries of the same event across
+// instances cannot both begin processing. Set a TTL policy on the expiresAt
+// field to drop records past the retention window.
+type FirestoreStore struct {
+	client     *firestore.Client
+	collection string
+	lease      time.Duration
+}
+
+func NewFirestoreStore(projectID, databaseID, collection string, lease time.Duration) (*FirestoreStore, error) {
+	if projectID == "" {
+		return nil, errors.New("eventstore: firestore driver requires a project_id")
+	}
+	if collection == "" {
+		collection = "events"
+	}
+	client, err := firestore.New(projectID, databaseID)
+	if err != nil {
+		return nil, err
+	}
+	return &FirestoreStore{
+		client:     client,
+		collection: collection,
+		lease:      lease,
+	}, nil
+}
+
+func (s *FirestoreStore) Get(ctx context.Context, id string) (*Record, error) {
+	doc, err := s.get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return record(id, doc), nil
+}
+
+func (s *FirestoreStore) Begin(ctx context.Context, id string) error {
+	now := time.Now().UTC()
+
+	doc, err := s.get(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		rec := &Record{ID: id, State: StateProcessing, Attempts: 1, UpdatedAt: now}
+		err := s.client.Create(ctx, s.collection, id, newDocument(rec))
+		if errors.Is(err, firestore.ErrPrecondition) {
+			// someone else created the record in between
+			return ErrInProgress
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	rec := record(id, doc)
+	if err := begin(rec, s.lease, now); err != nil {
+		return err
+	}
+	rec.State = StateProcessing
+	rec.Attempts++
+	rec.Error = ""
+	rec.UpdatedAt = now
+
+	err = s.client.Update(ctx, s.collection, id, newDocument(rec), doc.UpdateTime)
+	if errors.Is(err, firestore.ErrPrecondition) {
+		// the record changed since we read it, another delivery won
+		return ErrInProgress
+	}
+	return err
+}
+
+func (s *FirestoreStore) Complete(ctx context.Context, id string) error {
+	return s.update(ctx, id, StateProcessed, nil)
+}
+
+func (s *FirestoreStore) Fail(ctx context.Context, id string, cause error) error {
+	return s.update(ctx, id, StateFailed, cause)
+}
+
+func (s *FirestoreStore) update(ctx context.Context, id string, state State, cause error) error {
+	rec := &Record{ID: id, State: state, UpdatedAt: time.Now().UTC()}
+	if cause != nil {
+		rec.Error = cause.Error()
+	}
+	return s.client.Update(ctx, s.collection, id, newDocument(rec), "", "state", "error", "updatedAt", "expiresAt")
+}
+
+func (s *FirestoreStore) get(ctx context.Context, id string) (*firestore.Document, error) {
+	doc, err := s.client.Get(ctx, s.collection, id)
+	if errors.Is(err, firestore.ErrNotFound) {
+		return nil, ErrNotFound
+	}
+	return doc, err
+}
+
+func newDocument(rec *Record) *firestore.Document {
+	return &firestore.Document{
+		Fields: map[string]firestore.Value{
+			"state":     firestore.String(string(rec.State)),
+			"attempts":  firestore.Integer(rec.Attempts),
+			"error":     firestore.String(rec.Error),
+			"updatedAt": firestore.Timestamp(rec.UpdatedAt),
+			"expiresAt": firestore.Timestamp(rec.UpdatedAt.Add(retention)),
+		},
+	}
+}
+
+func record(id string, d *firestore.Document) *Record {
+	return &Record{
+		ID:        id,
+		State:     State(d.Fields["state"].Str()),
+		Attempts:  d.Fields["attempts"].Int(),
+		Error:     d.Fields["error"].Str(),
+		UpdatedAt: d.Fields["updatedAt"].Time(),
+	}
+}
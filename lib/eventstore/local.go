@@ -0,0 +1,88 @@
+package eventstore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/500k-agency/function/lib/jsonstore"
+)
+
+// LocalStore keeps event records in process memory or in a json file on the
+// local disk, so it only deduplicates retries that reach the same instance.
+// Records past the retention window are dropped.
+type LocalStore struct {
+	lease   time.Duration
+	records *jsonstore.Store[Record]
+}
+
+func NewMemoryStore(lease time.Duration) *LocalStore {
+	return &LocalStore{lease: lease, records: jsonstore.NewMemory[Record]()}
+}
+
+func NewFileStore(path string, lease time.Duration) (*LocalStore, error) {
+	records, err := jsonstore.NewFile[Record](path)
+	if err != nil {
+		return nil, fmt.Errorf("eventstore: %w", err)
+	}
+	return &LocalStore{lease: lease, records: records}, nil
+}
+
+func (s *LocalStore) Get(ctx context.Context, id string) (*Record, error) {
+	var rec Record
+	err := s.records.View(func(records map[string]Record) error {
+		var ok bool
+		if rec, ok = records[id]; !ok {
+			return ErrNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+func (s *LocalStore) Begin(ctx context.Context, id string) error {
+	return s.records.Update(func(records map[string]Record) error {
+		// pruning is harmless to keep or to drop when begin refuses
+		now := time.Now()
+		prune(records, now)
+		rec, ok := records[id]
+		if ok {
+			if err := begin(&rec, s.lease, now); err != nil {
+				return err
+			}
+		}
+		rec.ID = id
+		rec.State = StateProcessing
+		rec.Attempts++
+		rec.Error = ""
+		rec.UpdatedAt = now.UTC()
+		records[id] = rec
+		return nil
+	})
+}
+
+func (s *LocalStore) Complete(ctx context.Context, id string) error {
+	return s.update(id, StateProcessed, nil)
+}
+
+func (s *LocalStore) Fail(ctx context.Context, id string, cause error) error {
+	return s.update(id, StateFailed, cause)
+}
+
+func (s *LocalStore) update(id string, state State, cause error) error {
+	return s.records.Update(func(records map[string]Record) error {
+		rec := records[id]
+		rec.ID = id
+		rec.State = state
+		rec.Error = ""
+		if cause != nil {
+			rec.Error = cause.Error()
+		}
+		rec.UpdatedAt = time.Now().UTC()
+		records[id] = rec
+		return nil
+	})
+}
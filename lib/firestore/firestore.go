@@ -0,0 +1,385 @@
+// Package firestore is a minimal client of the Firestore REST API, shared by
+// the stores that keep state across function instances.
+//
+// Credentials are fetched from the GCP metadata server, which is available
+// to deployed cloud functions. When FIRESTORE_EMULATOR_HOST is set requests
+// go to the emulator without authentication.
+package firestore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	firestoreURL = "https://firestore.googleapis.com/v1/"
+	metadataURL  = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+)
+
+var (
+	ErrNotFound     = errors.New("firestore document not found")
+	ErrPrecondition = errors.New("firestore precondition failed")
+)
+
+// Client talks to the documents of a single database
+type Client struct {
+	client   *http.Client
+	database string // projects/<project>/databases/<database>/documents
+	baseURL  string
+	emulator bool
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+type Value struct {
+	StringValue    *string `json:"stringValue,omitempty"`
+	IntegerValue   *string `json:"integerValue,omitempty"`
+	TimestampValue *string `json:"timestampValue,omitempty"`
+}
+
+type Document struct {
+	Name       string           `json:"name,omitempty"`
+	Fields     map[string]Value `json:"fields"`
+	UpdateTime string           `json:"updateTime,omitempty"`
+}
+
+type apiError struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+	} `json:"error"`
+}
+
+func New(projectID, databaseID string) (*Client, error) {
+	if projectID == "" {
+		return nil, errors.New("firestore: project_id is required")
+	}
+	if databaseID == "" {
+		databaseID = "(default)"
+	}
+
+	c := &Client{
+		client:   &http.Client{Timeout: 10 * time.Second},
+		database: fmt.Sprintf("projects/%s/databases/%s/documents", projectID, databaseID),
+		baseURL:  firestoreURL,
+	}
+	if host := os.Getenv("FIRESTORE_EMULATOR_HOST"); host != "" {
+		c.baseURL = "http://" + host + "/v1/"
+		c.emulator = true
+	}
+	return c, nil
+}
+
+// String, Integer and Timestamp build document values
+func String(s string) Value {
+	return Value{StringValue: &s}
+}
+
+func Integer(n int) Value {
+	s := strconv.Itoa(n)
+	return Value{IntegerValue: &s}
+}
+
+func Timestamp(t time.Time) Value {
+	s := t.UTC().Format(time.RFC3339Nano)
+	return Value{TimestampValue: &s}
+}
+
+// Str, Int and Time read document values, zero when unset
+func (v Value) Str() string {
+	if v.StringValue == nil {
+		return ""
+	}
+	return *v.StringValue
+}
+
+func (v Value) Int() int {
+	if v.IntegerValue == nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(*v.IntegerValue)
+	return n
+}
+
+func (v Value) Time() time.Time {
+	if v.TimestampValue == nil {
+		return time.Time{}
+	}
+	t, _ := time.Parse(time.RFC3339Nano, *v.TimestampValue)
+	return t
+}
+
+// Get returns the document or ErrNotFound
+func (c *Client) Get(ctx context.Context, collection, id string) (*Document, error) {
+	doc := &Document{}
+	if err := c.do(ctx, http.MethodGet, documentPath(collection, id), nil, doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// Create creates the document, ErrPrecondition when it already exists
+func (c *Client) Create(ctx context.Context, collection, id string, doc *Document) error {
+	q := url.Values{"documentId": {id}}
+	return c.do(ctx, http.MethodPost, collection+"?"+q.Encode(), doc, nil)
+}
+
+// Update writes the fields of the document, all of them when fieldPaths is
+// empty. A non-empty updateTime fails with ErrPrecondition when the document
+// changed since it was read.
+func (c *Client) Update(ctx context.Context, collection, id string, doc *Document, updateTime string, fieldPaths ...string) error {
+	q := url.Values{}
+	if updateTime != "" {
+		q.Set("currentDocument.updateTime", updateTime)
+	}
+	for _, f := range fieldPaths {
+		q.Add("updateMask.fieldPaths", f)
+	}
+	path := documentPath(collection, id)
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+	return c.do(ctx, http.MethodPatch, path, doc, nil)
+}
+
+// Delete deletes the document, deleting a missing document is not an error
+func (c *Client) Delete(ctx context.Context, collection, id string) error {
+	return c.do(ctx, http.MethodDelete, documentPath(collection, id), nil, nil)
+}
+
+// Increment atomically adds n to the integer field, creating the document
+// when missing, sets the other fields of doc and returns the new value
+func (c *Client) Increment(ctx context.Context, collection, id, field string, n int, doc *Document) (int, error) {
+	if doc == nil {
+		doc = &Document{}
+	}
+	fieldPaths := make([]string, 0, len(doc.Fields))
+	for k := range doc.Fields {
+		fieldPaths = append(fieldPaths, k)
+	}
+	doc.Name = c.database + "/" + documentPath(collection, id)
+
+	body := map[string]interface{}{
+		"writes": []interface{}{map[string]interface{}{
+			"update":     doc,
+			"updateMask": map[string]interface{}{"fieldPaths": fieldPaths},
+			"updateTransforms": []interface{}{map[string]interface{}{
+				"fieldPath": field,
+				"increment": Integer(n),
+			}},
+		}},
+	}
+	var resp struct {
+		WriteResults []struct {
+			TransformResults []Value `json:"transformResults"`
+		} `json:"writeResults"`
+	}
+	if err := c.do(ctx, http.MethodPost, ":commit", body, &resp); err != nil {
+		return 0, err
+	}
+	if len(resp.WriteResults) == 0 || len(resp.WriteResults[0].TransformResults) == 0 {
+		return 0, errors.New("firestore: commit returned no transform result")
+	}
+	return resp.WriteResults[0].TransformResults[0].Int(), nil
+}
+
+// Write is a single document write of a Commit
+type Write struct {
+	Collection string
+	ID         string
+	Doc        *Document
+	// fields written, all of them when empty
+	FieldPaths []string
+
+	// preconditions: Create fails when the document exists, a non-empty
+	// UpdateTime when it changed since it was read
+	Create     bool
+	UpdateTime string
+}
+
+// Commit applies the writes atomically, none of them when a precondition
+// fails with ErrPrecondition
+func (c *Client) Commit(ctx context.Context, writes ...Write) error {
+	body := make([]interface{}, len(writes))
+	for i, w := range writes {
+		doc := *w.Doc
+		doc.Name = c.database + "/" + documentPath(w.Collection, w.ID)
+		doc.UpdateTime = ""
+		write := map[string]interface{}{"update": doc}
+		if len(w.FieldPaths) > 0 {
+			write["updateMask"] = map[string]interface{}{"fieldPaths": w.FieldPaths}
+		}
+		switch {
+		case w.Create:
+			write["currentDocument"] = map[string]interface{}{"exists": false}
+		case w.UpdateTime != "":
+			write["currentDocument"] = map[string]interface{}{"updateTime": w.UpdateTime}
+		}
+		body[i] = write
+	}
+	return c.do(ctx, http.MethodPost, ":commit", map[string]interface{}{"writes": body}, nil)
+}
+
+// Filter compares a document field, op is a Firestore field filter operator
+// such as EQUAL or LESS_THAN
+type Filter struct {
+	Field string
+	Op    string
+	Value Value
+}
+
+// Count counts the documents of the collection matching every filter.
+// Combining an equality with a range filter needs a composite index.
+func (c *Client) Count(ctx context.Context, collection string, filters ...Filter) (int, error) {
+	query := map[string]interface{}{
+		"from": []interface{}{map[string]string{"collectionId": collection}},
+	}
+	if len(filters) > 0 {
+		fieldFilters := make([]interface{}, len(filters))
+		for i, f := range filters {
+			fieldFilters[i] = map[string]interface{}{"fieldFilter": map[string]interface{}{
+				"field": map[string]string{"fieldPath": f.Field},
+				"op":    f.Op,
+				"value": f.Value,
+			}}
+		}
+		query["where"] = map[string]interface{}{"compositeFilter": map[string]interface{}{
+			"op":      "AND",
+			"filters": fieldFilters,
+		}}
+	}
+	body := map[string]interface{}{
+		"structuredAggregationQuery": map[string]interface{}{
+			"structuredQuery": query,
+			"aggregations":    []interface{}{map[string]interface{}{"alias": "n", "count": map[string]interface{}{}}},
+		},
+	}
+
+	var resp []struct {
+		Result struct {
+			AggregateFields map[string]Value `json:"aggregateFields"`
+		} `json:"result"`
+	}
+	if err := c.do(ctx, http.MethodPost, ":runAggregationQuery", body, &resp); err != nil {
+		return 0, err
+	}
+	for _, r := range resp {
+		if v, ok := r.Result.AggregateFields["n"]; ok {
+			return v.Int(), nil
+		}
+	}
+	return 0, nil
+}
+
+func documentPath(collection, id string) string {
+	return collection + "/" + url.PathEscape(id)
+}
+
+// do sends the request relative to the database's documents, paths starting
+// with a colon address the database itself, ie. ":commit"
+func (c *Client) do(ctx context.Context, method, path string, body, v interface{}) error {
+	var buf io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		buf = bytes.NewReader(b)
+	}
+
+	u := c.baseURL + c.database
+	if len(path) > 0 && path[0] == ':' {
+		u += path
+	} else {
+		u += "/" + path
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if !c.emulator {
+		token, err := c.accessToken(ctx)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("firestore: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var ferr apiError
+		json.NewDecoder(resp.Body).Decode(&ferr)
+		switch {
+		case resp.StatusCode == http.StatusNotFound && method == http.MethodGet:
+			return ErrNotFound
+		case resp.StatusCode == http.StatusConflict,
+			// queries fail the same way when an index is missing
+			ferr.Error.Status == "FAILED_PRECONDITION" && path != ":runAggregationQuery",
+			ferr.Error.Status == "ALREADY_EXISTS":
+			return ErrPrecondition
+		}
+		return fmt.Errorf("firestore: %s %s: %d %s", method, path, resp.StatusCode, ferr.Error.Message)
+	}
+
+	if v != nil {
+		return json.NewDecoder(resp.Body).Decode(v)
+	}
+	return nil
+}
+
+// accessToken returns a cached oauth token from the metadata server
+func (c *Client) accessToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && time.Now().Before(c.tokenExpiry) {
+		return c.token, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metadataURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("firestore: fetching access token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("firestore: fetching access token: status %d", resp.StatusCode)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("firestore: decoding access token: %w", err)
+	}
+
+	c.token = token.AccessToken
+	// refresh a minute early to avoid using a token on the edge of expiry
+	c.tokenExpiry = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - time.Minute)
+	return c.token, nil
+}
@@ -0,0 +1,247 @@
+package firestore_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/500k-agency/function/lib/firestore"
+	"github.com/500k-agency/function/lib/firestore/firestoretest"
+)
+
+func newClient(t *testing.T) (*firestore.Client, *firestoretest.Server) {
+	t.Helper()
+	srv := firestoretest.NewServer(t)
+	c, err := firestore.New(firestoretest.ProjectID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, srv
+}
+
+func doc(fields map[string]firestore.Value) *firestore.Document {
+	return &firestore.Document{Fields: fields}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := firestore.New("", ""); err == nil {
+		t.Error("accepted a client without a project")
+	}
+}
+
+func TestValues(t *testing.T) {
+	now := time.Date(2024, 3, 5, 14, 7, 9, 500, time.FixedZone("CET", 3600))
+	if got := firestore.String("a").Str(); got != "a" {
+		t.Errorf("string %q", got)
+	}
+	if got := firestore.Integer(-42).Int(); got != -42 {
+		t.Errorf("integer %d", got)
+	}
+	if got := firestore.Timestamp(now).Time(); !got.Equal(now) {
+		t.Errorf("timestamp %v, want %v", got, now)
+	}
+	var zero firestore.Value
+	if zero.Str() != "" || zero.Int() != 0 || !zero.Time().IsZero() {
+		t.Error("unset values are not zero")
+	}
+}
+
+func TestDocuments(t *testing.T) {
+	c, srv := newClient(t)
+	ctx := context.Background()
+
+	if _, err := c.Get(ctx, "downloads", "a/b"); !errors.Is(err, firestore.ErrNotFound) {
+		t.Fatalf("got %v, want ErrNotFound", err)
+	}
+	if err := c.Create(ctx, "downloads", "a/b", doc(map[string]firestore.Value{"email": firestore.String("ada@example.com"), "n": firestore.Integer(1)})); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Create(ctx, "downloads", "a/b", doc(nil)); !errors.Is(err, firestore.ErrPrecondition) {
+		t.Errorf("creating twice: got %v, want ErrPrecondition", err)
+	}
+	if srv.Doc("downloads", "a/b") == nil {
+		t.Fatal("the id is not escaped into a single document")
+	}
+
+	d, err := c.Get(ctx, "downloads", "a/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Fields["email"].Str() != "ada@example.com" || d.UpdateTime == "" {
+		t.Errorf("got %+v", d)
+	}
+
+	// only the masked fields are written
+	if err := c.Update(ctx, "downloads", "a/b", doc(map[string]firestore.Value{"n": firestore.Integer(2), "email": firestore.String("x")}), d.UpdateTime, "n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Update(ctx, "downloads", "a/b", doc(nil), d.UpdateTime); !errors.Is(err, firestore.ErrPrecondition) {
+		t.Errorf("stale update: got %v, want ErrPrecondition", err)
+	}
+	updated, _ := c.Get(ctx, "downloads", "a/b")
+	if updated.Fields["n"].Int() != 2 || updated.Fields["email"].Str() != "ada@example.com" {
+		t.Errorf("got %+v", updated.Fields)
+	}
+
+	if err := c.Delete(ctx, "downloads", "a/b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Delete(ctx, "downloads", "a/b"); err != nil {
+		t.Errorf("deleting a missing document: %v", err)
+	}
+	if srv.Len("downloads") != 0 {
+		t.Error("document not deleted")
+	}
+}
+
+func TestIncrement(t *testing.T) {
+	c, srv := newClient(t)
+	ctx := context.Background()
+
+	for want := 1; want <= 3; want++ {
+		n, err := c.Increment(ctx, "counts", "cs_1", "n", 1, doc(map[string]firestore.Value{"session": firestore.String("cs_1")}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != want {
+			t.Errorf("got %d, want %d", n, want)
+		}
+	}
+	if n, _ := c.Increment(ctx, "counts", "cs_1", "n", -2, nil); n != 1 {
+		t.Errorf("decrement: got %d, want 1", n)
+	}
+	if d := srv.Doc("counts", "cs_1"); d.Fields["session"].Str() != "cs_1" || d.Fields["n"].Int() != 1 {
+		t.Errorf("stored %+v", d.Fields)
+	}
+}
+
+func TestCommit(t *testing.T) {
+	c, srv := newClient(t)
+	ctx := context.Background()
+
+	if err := c.Create(ctx, "referrals", "existing", doc(map[string]firestore.Value{"n": firestore.Integer(1)})); err != nil {
+		t.Fatal(err)
+	}
+	existing, _ := c.Get(ctx, "referrals", "existing")
+
+	tests := []struct {
+		name   string
+		writes []firestore.Write
+		want   error
+	}{
+		{"create conflicts", []firestore.Write{
+			{Collection: "referrals", ID: "new", Doc: doc(nil), Create: true},
+			{Collection: "referrals", ID: "existing", Doc: doc(nil), Create: true},
+		}, firestore.ErrPrecondition},
+		{"stale update", []firestore.Write{
+			{Collection: "referrals", ID: "new", Doc: doc(nil), Create: true},
+			{Collection: "referrals", ID: "existing", Doc: doc(nil), UpdateTime: "1970-01-01T00:00:00Z"},
+		}, firestore.ErrPrecondition},
+		{"applied", []firestore.Write{
+			{Collection: "referrals", ID: "new", Doc: doc(map[string]firestore.Value{"code": firestore.String("abc")}), Create: true},
+			{Collection: "referrals", ID: "existing", Doc: doc(map[string]firestore.Value{"n": firestore.Integer(2)}), UpdateTime: existing.UpdateTime, FieldPaths: []string{"n"}},
+		}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := c.Commit(ctx, tt.writes...); !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			// a failed commit writes nothing
+			if created := srv.Doc("referrals", "new") != nil; created != (tt.want == nil) {
+				t.Errorf("new document written: %v", created)
+			}
+		})
+	}
+	if d := srv.Doc("referrals", "existing"); d.Fields["n"].Int() != 2 {
+		t.Errorf("stored %+v", d.Fields)
+	}
+}
+
+func TestCount(t *testing.T) {
+	c, _ := newClient(t)
+	ctx := context.Background()
+
+	for i, email := range []string{"a", "a", "b"} {
+		c.Create(ctx, "signups", fmt.Sprint(i), doc(map[string]firestore.Value{"email": firestore.String(email), "n": firestore.Integer(i)}))
+	}
+	tests := []struct {
+		name    string
+		filters []firestore.Filter
+		want    int
+	}{
+		{"all", nil, 3},
+		{"equal", []firestore.Filter{{Field: "email", Op: "EQUAL", Value: firestore.String("a")}}, 2},
+		{"and", []firestore.Filter{
+			{Field: "email", Op: "EQUAL", Value: firestore.String("a")},
+			{Field: "n", Op: "LESS_THAN", Value: firestore.Integer(1)},
+		}, 1},
+		{"none", []firestore.Filter{{Field: "email", Op: "EQUAL", Value: firestore.String("c")}}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := c.Count(ctx, "signups", tt.filters...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != tt.want {
+				t.Errorf("got %d, want %d", n, tt.want)
+			}
+		})
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		code   int
+		status string
+		call   func(c *firestore.Client) error
+		want   error
+	}{
+		{"missing document", 404, "NOT_FOUND", func(c *firestore.Client) error {
+			_, err := c.Get(context.Background(), "a", "b")
+			return err
+		}, firestore.ErrNotFound},
+		{"stale update", 400, "FAILED_PRECONDITION", func(c *firestore.Client) error {
+			return c.Update(context.Background(), "a", "b", doc(nil), "t")
+		}, firestore.ErrPrecondition},
+		{"already exists", 409, "ALREADY_EXISTS", func(c *firestore.Client) error {
+			return c.Create(context.Background(), "a", "b", doc(nil))
+		}, firestore.ErrPrecondition},
+		{"missing index", 400, "FAILED_PRECONDITION", func(c *firestore.Client) error {
+			_, err := c.Count(context.Background(), "a")
+			return err
+		}, nil},
+		{"unavailable", 503, "UNAVAILABLE", func(c *firestore.Client) error {
+			return c.Delete(context.Background(), "a", "b")
+		}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.code)
+				fmt.Fprintf(w, `{"error":{"code":%d,"message":"failed","status":%q}}`, tt.code, tt.status)
+			}))
+			defer srv.Close()
+			t.Setenv("FIRESTORE_EMULATOR_HOST", strings.TrimPrefix(srv.URL, "http://"))
+			c, _ := firestore.New("test", "")
+
+			err := tt.call(c)
+			if err == nil {
+				t.Fatal("no error")
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+			if tt.want == nil && (errors.Is(err, firestore.ErrNotFound) || errors.Is(err, firestore.ErrPrecondition)) {
+				t.Errorf("got %v, want a plain error", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+// Package firestoretest runs an in-memory stand-in of the Firestore REST
+// API for tests, covering what lib/firestore uses: document reads and
+// writes with preconditions, commits with increments and count queries.
+package firestoretest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/500k-agency/function/lib/firestore"
+)
+
+// ProjectID is the project the server answers for
+const ProjectID = "test"
+
+const database = "/v1/projects/" + ProjectID + "/databases/(default)/documents"
+
+// Server holds the documents by "<collection>/<id>"
+type Server struct {
+	mu   sync.Mutex
+	docs map[string]*firestore.Document
+	n    int64
+}
+
+// NewServer starts the server and points FIRESTORE_EMULATOR_HOST at it for
+// the duration of the test
+func NewServer(t testing.TB) *Server {
+	s := &Server{docs: map[string]*firestore.Document{}}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	t.Setenv("FIRESTORE_EMULATOR_HOST", strings.TrimPrefix(srv.URL, "http://"))
+	return s
+}
+
+// Doc returns the stored document, nil when missing
+func (s *Server) Doc(collection, id string) *firestore.Document {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.docs[collection+"/"+id]
+}
+
+// Len counts the documents of the collection
+func (s *Server) Len(collection string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for k := range s.docs {
+		if strings.HasPrefix(k, collection+"/") {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path, err := url.PathUnescape(strings.TrimPrefix(r.URL.EscapedPath(), database))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT")
+		return
+	}
+	switch {
+	case path == ":commit":
+		s.commit(w, r)
+	case path == ":runAggregationQuery":
+		s.count(w, r)
+	case r.Method == http.MethodGet:
+		d := s.docs[strings.TrimPrefix(path, "/")]
+		if d == nil {
+			writeError(w, http.StatusNotFound, "NOT_FOUND")
+			return
+		}
+		json.NewEncoder(w).Encode(d)
+	case r.Method == http.MethodPost:
+		key := strings.TrimPrefix(path, "/") + "/" + r.URL.Query().Get("documentId")
+		if s.docs[key] != nil {
+			writeError(w, http.StatusConflict, "ALREADY_EXISTS")
+			return
+		}
+		var d firestore.Document
+		json.NewDecoder(r.Body).Decode(&d)
+		s.put(key, &d, nil)
+		w.Write([]byte("{}"))
+	case r.Method == http.MethodPatch:
+		key := strings.TrimPrefix(path, "/")
+		if ut := r.URL.Query().Get("currentDocument.updateTime"); ut != "" && (s.docs[key] == nil || s.docs[key].UpdateTime != ut) {
+			writeError(w, http.StatusBadRequest, "FAILED_PRECONDITION")
+			return
+		}
+		var d firestore.Document
+		json.NewDecoder(r.Body).Decode(&d)
+		s.put(key, &d, r.URL.Query()["updateMask.fieldPaths"])
+		w.Write([]byte("{}"))
+	case r.Method == http.MethodDelete:
+		delete(s.docs, strings.TrimPrefix(path, "/"))
+		w.Write([]byte("{}"))
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "UNIMPLEMENTED")
+	}
+}
+
+// put writes the fields of d, only those of mask when set. An empty mask
+// writes no fields, like Firestore.
+func (s *Server) put(key string, d *firestore.Document, mask []string) {
+	cur := s.docs[key]
+	if cur == nil || mask == nil {
+		cur = &firestore.Document{Fields: map[string]firestore.Value{}}
+	}
+	if mask == nil {
+		for k, v := range d.Fields {
+			cur.Fields[k] = v
+		}
+	} else {
+		for _, f := range mask {
+			if v, ok := d.Fields[f]; ok {
+				cur.Fields[f] = v
+			} else {
+				delete(cur.Fields, f)
+			}
+		}
+	}
+	s.n++
+	cur.Name = key
+	cur.UpdateTime = time.Unix(0, s.n).UTC().Format(time.RFC3339Nano)
+	s.docs[key] = cur
+}
+
+type write struct {
+	Update           firestore.Document             `json:"update"`
+	UpdateMask       *struct{ FieldPaths []string } `json:"updateMask"`
+	UpdateTransforms []struct {
+		FieldPath string          `json:"fieldPath"`
+		Increment firestore.Value `json:"increment"`
+	} `json:"updateTransforms"`
+	CurrentDocument *struct {
+		Exists     *bool  `json:"exists"`
+		UpdateTime string `json:"updateTime"`
+	} `json:"currentDocument"`
+}
+
+// commit checks every precondition before applying any write
+func (s *Server) commit(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Writes []write `json:"writes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT")
+		return
+	}
+
+	keys := make([]string, len(body.Writes))
+	for i, wr := range body.Writes {
+		_, rel, _ := strings.Cut(wr.Update.Name, "/documents/")
+		keys[i], _ = url.PathUnescape(rel)
+		cur := s.docs[keys[i]]
+		if pre := wr.CurrentDocument; pre != nil {
+			if pre.Exists != nil && *pre.Exists != (cur != nil) {
+				writeError(w, http.StatusConflict, "ALREADY_EXISTS")
+				return
+			}
+			if pre.UpdateTime != "" && (cur == nil || cur.UpdateTime != pre.UpdateTime) {
+				writeError(w, http.StatusBadRequest, "FAILED_PRECONDITION")
+				return
+			}
+		}
+	}
+
+	type result struct {
+		TransformResults []firestore.Value `json:"transformResults,omitempty"`
+	}
+	results := make([]result, len(body.Writes))
+	for i, wr := range body.Writes {
+		var mask []string
+		if wr.UpdateMask != nil {
+			mask = append([]string{}, wr.UpdateMask.FieldPaths...)
+		}
+		s.put(keys[i], &wr.Update, mask)
+		for _, t := range wr.UpdateTransforms {
+			n := s.docs[keys[i]].Fields[t.FieldPath].Int() + t.Increment.Int()
+			s.docs[keys[i]].Fields[t.FieldPath] = firestore.Integer(n)
+			results[i].TransformResults = append(results[i].TransformResults, firestore.Integer(n))
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"writeResults": results})
+}
+
+// count answers aggregation queries of AND-ed EQUAL and LESS_THAN filters
+func (s *Server) count(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Query struct {
+			Structured struct {
+				From []struct {
+					CollectionID string `json:"collectionId"`
+				} `json:"from"`
+				Where struct {
+					CompositeFilter struct {
+						Filters []struct {
+							FieldFilter struct {
+								Field struct {
+									FieldPath string `json:"fieldPath"`
+								} `json:"field"`
+								Op    string          `json:"op"`
+								Value firestore.Value `json:"value"`
+							} `json:"fieldFilter"`
+						} `json:"filters"`
+					} `json:"compositeFilter"`
+				} `json:"where"`
+			} `json:"structuredQuery"`
+		} `json:"structuredAggregationQuery"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || len(body.Query.Structured.From) == 0 {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT")
+		return
+	}
+
+	prefix := body.Query.Structured.From[0].CollectionID + "/"
+	n := 0
+	for k, d := range s.docs {
+		if !strings.HasPrefix(k, prefix) || strings.Contains(k[len(prefix):], "/") {
+			continue
+		}
+		match := true
+		for _, f := range body.Query.Structured.Where.CompositeFilter.Filters {
+			got, want := d.Fields[f.FieldFilter.Field.FieldPath], f.FieldFilter.Value
+			switch f.FieldFilter.Op {
+			case "EQUAL":
+				match = match && compare(got, want) == 0
+			case "LESS_THAN":
+				match = match && compare(got, want) < 0
+			}
+		}
+		if match {
+			n++
+		}
+	}
+	fmt.Fprintf(w, `[{"result":{"aggregateFields":{"n":{"integerValue":"%d"}}}}]`, n)
+}
+
+func compare(a, b firestore.Value) int {
+	if a.IntegerValue != nil && b.IntegerValue != nil {
+		return a.Int() - b.Int()
+	}
+	return strings.Compare(a.Str(), b.Str())
+}
+
+func writeError(w http.ResponseWriter, code int, status string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	fmt.Fprintf(w, `{"error":{"code":%d,"message":%q,"status":%q}}`, code, strings.ToLower(status), status)
+}
@@ -0,0 +1,155 @@
+package handlebars
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// helpers are the inline helpers of the SendGrid subset
+//
+// Documentation: https://docs.sendgrid.com/for-developers/sending-email/using-handlebars
+var helpers = map[string]func(params ...interface{}) (string, error){
+	"formatDate": formatDate,
+	"insert":     insert,
+}
+
+// insert renders the value, or the "default=..." fallback when it is empty
+//
+//	{{insert name "default=Customer"}}
+func insert(params ...interface{}) (string, error) {
+	if len(params) == 0 {
+		return "", errors.New("missing value")
+	}
+	if s := toString(params[0]); s != "" {
+		return s, nil
+	}
+	for _, p := range params[1:] {
+		if s, ok := p.(string); ok && strings.HasPrefix(s, "default=") {
+			return s[len("default="):], nil
+		}
+	}
+	return "", nil
+}
+
+// formatDate formats an ISO 8601 or unix timestamp with a moment.js style
+// format, in UTC or at the optional offset
+//
+//	{{formatDate timeStamp "MMMM DD, YYYY" "-0800"}}
+func formatDate(params ...interface{}) (string, error) {
+	if len(params) < 2 {
+		return "", errors.New("usage: formatDate timestamp format [timezoneOffset]")
+	}
+	if params[0] == nil {
+		return "", nil
+	}
+	t, err := parseTime(params[0])
+	if err != nil {
+		return "", err
+	}
+
+	loc := time.UTC
+	if len(params) > 2 {
+		offset := toString(params[2])
+		z, err := time.Parse("-0700", offset)
+		if err != nil {
+			return "", fmt.Errorf("invalid timezone offset %q", offset)
+		}
+		_, secs := z.Zone()
+		loc = time.FixedZone(offset, secs)
+	}
+	return formatMoment(t.In(loc), toString(params[1])), nil
+}
+
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+func parseTime(v interface{}) (time.Time, error) {
+	switch t := v.(type) {
+	case float64:
+		return fromUnix(t), nil
+	case string:
+		if n, err := strconv.ParseFloat(t, 64); err == nil {
+			return fromUnix(n), nil
+		}
+		for _, layout := range timeLayouts {
+			if parsed, err := time.Parse(layout, t); err == nil {
+				return parsed, nil
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %q", toString(v))
+}
+
+// fromUnix reads timestamps past the year 5138 as milliseconds
+func fromUnix(n float64) time.Time {
+	if math.Abs(n) > 1e11 {
+		return time.UnixMilli(int64(n)).UTC()
+	}
+	return time.Unix(int64(n), 0).UTC()
+}
+
+// moment.js format tokens, longest first
+var momentTokens = []struct {
+	token  string
+	format func(t time.Time) string
+}{
+	{"YYYY", func(t time.Time) string { return t.Format("2006") }},
+	{"YY", func(t time.Time) string { return t.Format("06") }},
+	{"MMMM", func(t time.Time) string { return t.Format("January") }},
+	{"MMM", func(t time.Time) string { return t.Format("Jan") }},
+	{"MM", func(t time.Time) string { return t.Format("01") }},
+	{"M", func(t time.Time) string { return t.Format("1") }},
+	{"DD", func(t time.Time) string { return t.Format("02") }},
+	{"D", func(t time.Time) string { return t.Format("2") }},
+	{"dddd", func(t time.Time) string { return t.Format("Monday") }},
+	{"ddd", func(t time.Time) string { return t.Format("Mon") }},
+	{"HH", func(t time.Time) string { return t.Format("15") }},
+	{"H", func(t time.Time) string { return strconv.Itoa(t.Hour()) }},
+	{"hh", func(t time.Time) string { return t.Format("03") }},
+	{"h", func(t time.Time) string { return t.Format("3") }},
+	{"mm", func(t time.Time) string { return t.Format("04") }},
+	{"m", func(t time.Time) string { return t.Format("4") }},
+	{"ss", func(t time.Time) string { return t.Format("05") }},
+	{"s", func(t time.Time) string { return t.Format("5") }},
+	{"A", func(t time.Time) string { return t.Format("PM") }},
+	{"a", func(t time.Time) string { return t.Format("pm") }},
+	{"ZZ", func(t time.Time) string { return t.Format("-0700") }},
+	{"Z", func(t time.Time) string { return t.Format("-07:00") }},
+}
+
+// formatMoment formats t, text in [brackets] is kept as is
+func formatMoment(t time.Time, format string) string {
+	var out strings.Builder
+	for i := 0; i < len(format); {
+		if format[i] == '[' {
+			if j := strings.IndexByte(format[i:], ']'); j > 0 {
+				out.WriteString(format[i+1 : i+j])
+				i += j + 1
+				continue
+			}
+		}
+		matched := false
+		for _, tok := range momentTokens {
+			if strings.HasPrefix(format[i:], tok.token) {
+				out.WriteString(tok.format(t))
+				i += len(tok.token)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			out.WriteByte(format[i])
+			i++
+		}
+	}
+	return out.String()
+}
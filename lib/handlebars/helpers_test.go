@@ -0,0 +1,80 @@
+package handlebars
+
+import (
+	"testing"
+)
+
+func TestFormatDate(t *testing.T) {
+	tests := []struct {
+		name   string
+		params []interface{}
+		want   string
+	}{
+		{"iso", []interface{}{"2024-03-05T14:07:09Z", "MMMM DD, YYYY"}, "March 05, 2024"},
+		{"short tokens", []interface{}{"2024-03-05T14:07:09Z", "M/D/YY h:m:s a"}, "3/5/24 2:7:9 pm"},
+		{"long tokens", []interface{}{"2024-03-05T04:07:09Z", "dddd ddd MMM HH H hh mm ss A"}, "Tuesday Tue Mar 04 4 04 07 09 AM"},
+		{"offset", []interface{}{"2024-03-05T04:07:09Z", "YYYY-MM-DD HH:mm Z", "-0800"}, "2024-03-04 20:07 -08:00"},
+		{"offset numeric", []interface{}{"2024-03-05T04:07:09Z", "HH:mm ZZ", "+0530"}, "09:37 +0530"},
+		{"escaped text", []interface{}{"2024-03-05", "[Day] D [of] MMMM"}, "Day 5 of March"},
+		{"date only", []interface{}{"2024-03-05", "YYYY-MM-DD"}, "2024-03-05"},
+		{"local time", []interface{}{"2024-03-05 14:07:09", "HH:mm"}, "14:07"},
+		{"unix seconds", []interface{}{float64(1709647629), "YYYY-MM-DD HH:mm:ss"}, "2024-03-05 14:07:09"},
+		{"unix string", []interface{}{"1709647629", "YYYY-MM-DD"}, "2024-03-05"},
+		{"unix milliseconds", []interface{}{float64(1709647629000), "YYYY-MM-DD HH:mm:ss"}, "2024-03-05 14:07:09"},
+		{"missing", []interface{}{nil, "YYYY"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := formatDate(tt.params...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatDateErrors(t *testing.T) {
+	tests := map[string][]interface{}{
+		"no format":    {"2024-03-05"},
+		"bad date":     {"March 5th", "YYYY"},
+		"bad offset":   {"2024-03-05", "YYYY", "PST"},
+		"not a string": {true, "YYYY"},
+	}
+	for name, params := range tests {
+		if _, err := formatDate(params...); err == nil {
+			t.Errorf("%s: formatted without an error", name)
+		}
+	}
+}
+
+func TestInsert(t *testing.T) {
+	tests := []struct {
+		name   string
+		params []interface{}
+		want   string
+	}{
+		{"value", []interface{}{"Ada", "default=Customer"}, "Ada"},
+		{"number", []interface{}{float64(0), "default=none"}, "0"},
+		{"empty", []interface{}{"", "default=Customer"}, "Customer"},
+		{"nil", []interface{}{nil, "default="}, ""},
+		{"no default", []interface{}{nil}, ""},
+		{"not a default", []interface{}{nil, "Customer"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := insert(tt.params...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+	if _, err := insert(); err == nil {
+		t.Error("inserted without a value")
+	}
+}
@@ -0,0 +1,336 @@
+package handlebars
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrSyntax = errors.New("handlebars syntax error")
+
+// block helpers of the SendGrid subset
+var blockHelpers = map[string]bool{
+	"if":     true,
+	"unless": true,
+	"each":   true,
+	"equals": true,
+}
+
+// Template is a parsed handlebars template
+type Template struct {
+	nodes []node
+}
+
+type node interface{}
+
+type textNode string
+
+// exprNode is a {{value}} or {{helper param...}} expression
+type exprNode struct {
+	name   string
+	params []string
+	raw    bool
+	line   int
+}
+
+// blockNode is a {{#helper param...}} ... {{else}} ... {{/helper}} block
+type blockNode struct {
+	name    string
+	params  []string
+	body    []node
+	inverse []node
+	line    int
+}
+
+type tokenKind int
+
+const (
+	tokenText tokenKind = iota
+	tokenExpr
+	tokenOpen
+	tokenElse
+	tokenClose
+	tokenEOF
+)
+
+type token struct {
+	kind   tokenKind
+	text   string
+	name   string
+	params []string
+	raw    bool
+	line   int
+
+	// ~ whitespace control on either side of the tag
+	stripLeft, stripRight bool
+}
+
+// Parse parses a handlebars template
+func Parse(src string) (*Template, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	nodes, stop, err := p.parseNodes(false)
+	if err != nil {
+		return nil, err
+	}
+	if stop.kind != tokenEOF {
+		return nil, syntaxError(stop.line, "unexpected tag")
+	}
+	return &Template{nodes: nodes}, nil
+}
+
+func syntaxError(line int, format string, args ...interface{}) error {
+	return fmt.Errorf("%w: line %d: %s", ErrSyntax, line, fmt.Sprintf(format, args...))
+}
+
+// lex splits the template into text and tags
+func lex(src string) ([]token, error) {
+	var (
+		toks []token
+		line = 1
+	)
+	for len(src) > 0 {
+		i := strings.Index(src, "{{")
+		if i < 0 {
+			toks = append(toks, token{kind: tokenText, text: src, line: line})
+			break
+		}
+		if i > 0 {
+			toks = append(toks, token{kind: tokenText, text: src[:i], line: line})
+			line += strings.Count(src[:i], "\n")
+			src = src[i:]
+		}
+
+		open, close := "{{", "}}"
+		raw := strings.HasPrefix(src, "{{{")
+		if raw {
+			open, close = "{{{", "}}}"
+		}
+		inner := strings.TrimPrefix(src[len(open):], "~")
+		if strings.HasPrefix(inner, "!--") {
+			// block comments may contain }}
+			close = "--}}"
+			if k := strings.Index(src, "--~}}"); k >= 0 && k < strings.Index(src+close, close) {
+				close = "--~}}"
+			}
+		}
+		j := strings.Index(src[len(open):], close)
+		if j < 0 {
+			return nil, syntaxError(line, "unclosed tag")
+		}
+		body := src[len(open) : len(open)+j]
+		tagLen := len(open) + j + len(close)
+		if close == "--~}}" {
+			body += "~"
+		}
+
+		tok := token{line: line, raw: raw}
+		if strings.HasPrefix(body, "~") {
+			tok.stripLeft = true
+			body = body[1:]
+		}
+		if strings.HasSuffix(body, "~") {
+			tok.stripRight = true
+			body = body[:len(body)-1]
+		}
+		line += strings.Count(src[:tagLen], "\n")
+		src = src[tagLen:]
+
+		body = strings.TrimSpace(body)
+		if strings.HasPrefix(body, "!") {
+			// comments only keep their whitespace control
+			toks = append(toks, token{kind: tokenText, line: tok.line, stripLeft: tok.stripLeft, stripRight: tok.stripRight})
+			continue
+		}
+		if err := classify(&tok, body); err != nil {
+			return nil, err
+		}
+		toks = append(toks, tok)
+	}
+
+	// apply whitespace control to the neighbouring text, comments are empty
+	// text tokens that keep the flags of their tag
+	for i, t := range toks {
+		if t.stripLeft && i > 0 && toks[i-1].kind == tokenText {
+			toks[i-1].text = strings.TrimRight(toks[i-1].text, " \t\r\n")
+		}
+		if t.stripRight && i+1 < len(toks) && toks[i+1].kind == tokenText {
+			toks[i+1].text = strings.TrimLeft(toks[i+1].text, " \t\r\n")
+		}
+	}
+	return toks, nil
+}
+
+// classify sets the kind, name and params of the tag from its body
+func classify(tok *token, body string) error {
+	switch {
+	case body == "":
+		return syntaxError(tok.line, "empty tag")
+	case body == "else" || body == "^":
+		tok.kind = tokenElse
+		return nil
+	case strings.HasPrefix(body, "else "):
+		// {{else if cond}} chains another block in the inverse
+		tok.kind = tokenElse
+		body = strings.TrimSpace(body[len("else "):])
+	case strings.HasPrefix(body, "#"):
+		tok.kind = tokenOpen
+		body = strings.TrimSpace(body[1:])
+	case strings.HasPrefix(body, "/"):
+		tok.kind = tokenClose
+		tok.name = strings.TrimSpace(body[1:])
+		return nil
+	default:
+		tok.kind = tokenExpr
+	}
+
+	fields, err := splitArgs(body)
+	if err != nil {
+		return syntaxError(tok.line, "%v", err)
+	}
+	tok.name, tok.params = fields[0], fields[1:]
+
+	switch tok.kind {
+	case tokenOpen, tokenElse:
+		if !blockHelpers[tok.name] {
+			return syntaxError(tok.line, "unknown block helper %q", tok.name)
+		}
+	case tokenExpr:
+		if _, ok := helpers[tok.name]; !ok && len(tok.params) > 0 {
+			return syntaxError(tok.line, "unknown helper %q", tok.name)
+		}
+	}
+	return nil
+}
+
+// splitArgs splits a tag body on spaces, keeping quoted strings together
+func splitArgs(s string) ([]string, error) {
+	var (
+		args  []string
+		cur   strings.Builder
+		quote rune
+	)
+	for _, r := range s {
+		switch {
+		case quote != 0:
+			cur.WriteRune(r)
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			cur.WriteRune(r)
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			if cur.Len() > 0 {
+				args = append(args, cur.String())
+				cur.Reset()
+			}
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("unterminated string")
+	}
+	if cur.Len() > 0 {
+		args = append(args, cur.String())
+	}
+	if len(args) == 0 {
+		return nil, errors.New("empty tag")
+	}
+	return args, nil
+}
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func (p *parser) next() token {
+	if p.pos >= len(p.toks) {
+		return token{kind: tokenEOF}
+	}
+	t := p.toks[p.pos]
+	p.pos++
+	return t
+}
+
+// parseNodes parses until the end of the template, or the else or closing
+// tag of the enclosing block, and returns the token it stopped at
+func (p *parser) parseNodes(inBlock bool) ([]node, token, error) {
+	var nodes []node
+	for {
+		t := p.next()
+		switch t.kind {
+		case tokenText:
+			if t.text != "" {
+				nodes = append(nodes, textNode(t.text))
+			}
+		case tokenExpr:
+			nodes = append(nodes, &exprNode{name: t.name, params: t.params, raw: t.raw, line: t.line})
+		case tokenOpen:
+			b, err := p.parseBlock(t, t.name)
+			if err != nil {
+				return nil, t, err
+			}
+			nodes = append(nodes, b)
+		case tokenElse, tokenClose:
+			if !inBlock {
+				return nil, t, syntaxError(t.line, "unexpected {{%s}}", tagText(t))
+			}
+			return nodes, t, nil
+		case tokenEOF:
+			return nodes, t, nil
+		}
+	}
+}
+
+// parseBlock parses the body and inverse of the block opened by open, up to
+// the {{/closing}} tag. Chained {{else if}} blocks share the closing tag.
+func (p *parser) parseBlock(open token, closing string) (*blockNode, error) {
+	b := &blockNode{name: open.name, params: open.params, line: open.line}
+
+	body, stop, err := p.parseNodes(true)
+	if err != nil {
+		return nil, err
+	}
+	b.body = body
+
+	if stop.kind == tokenElse {
+		if stop.name != "" {
+			chained, err := p.parseBlock(stop, closing)
+			if err != nil {
+				return nil, err
+			}
+			b.inverse = []node{chained}
+			return b, nil
+		}
+		if b.inverse, stop, err = p.parseNodes(true); err != nil {
+			return nil, err
+		}
+		if stop.kind == tokenElse {
+			return nil, syntaxError(stop.line, "unexpected {{else}}")
+		}
+	}
+
+	switch {
+	case stop.kind == tokenEOF:
+		return nil, syntaxError(open.line, "unclosed {{#%s}}", closing)
+	case stop.name != closing:
+		return nil, syntaxError(stop.line, "{{/%s}} does not close {{#%s}}", stop.name, closing)
+	}
+	return b, nil
+}
+
+func tagText(t token) string {
+	switch t.kind {
+	case tokenElse:
+		return strings.TrimSpace("else " + t.name)
+	case tokenClose:
+		return "/" + t.name
+	}
+	return t.name
+}
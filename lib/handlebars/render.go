@@ -0,0 +1,268 @@
+package handlebars
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Render parses and renders the template against data
+func Render(src string, data interface{}) (string, error) {
+	t, err := Parse(src)
+	if err != nil {
+		return "", err
+	}
+	return t.Render(data)
+}
+
+// Render renders the template against data. data is converted through its
+// json encoding, the same way SendGrid receives dynamic_template_data.
+func (t *Template) Render(data interface{}) (string, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return "", fmt.Errorf("handlebars: encoding data: %w", err)
+	}
+	var value interface{}
+	if err := json.Unmarshal(b, &value); err != nil {
+		return "", fmt.Errorf("handlebars: encoding data: %w", err)
+	}
+
+	var out strings.Builder
+	root := &frame{value: value}
+	root.root = root
+	if err := render(&out, t.nodes, root); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// frame is the context a block renders in
+type frame struct {
+	value  interface{}
+	vars   map[string]interface{} // @index, @first, @last and @key
+	parent *frame
+	root   *frame
+}
+
+func (f *frame) child(value interface{}, vars map[string]interface{}) *frame {
+	return &frame{value: value, vars: vars, parent: f, root: f.root}
+}
+
+func render(out *strings.Builder, nodes []node, f *frame) error {
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case textNode:
+			out.WriteString(string(n))
+		case *exprNode:
+			var v interface{}
+			if helper, ok := helpers[n.name]; ok {
+				params := make([]interface{}, len(n.params))
+				for i, p := range n.params {
+					params[i] = f.eval(p)
+				}
+				s, err := helper(params...)
+				if err != nil {
+					return fmt.Errorf("handlebars: line %d: %s: %w", n.line, n.name, err)
+				}
+				v = s
+			} else {
+				v = f.eval(n.name)
+			}
+			if n.raw {
+				out.WriteString(toString(v))
+			} else {
+				out.WriteString(escape(toString(v)))
+			}
+		case *blockNode:
+			if err := renderBlock(out, n, f); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func renderBlock(out *strings.Builder, b *blockNode, f *frame) error {
+	params := make([]interface{}, len(b.params))
+	for i, p := range b.params {
+		params[i] = f.eval(p)
+	}
+	want := map[string]int{"if": 1, "unless": 1, "each": 1, "equals": 2}[b.name]
+	if len(params) != want {
+		return fmt.Errorf("%w: line %d: {{#%s}} takes %d arguments, got %d", ErrSyntax, b.line, b.name, want, len(params))
+	}
+
+	switch b.name {
+	case "if":
+		if truthy(params[0]) {
+			return render(out, b.body, f)
+		}
+		return render(out, b.inverse, f)
+	case "unless":
+		if !truthy(params[0]) {
+			return render(out, b.body, f)
+		}
+		return render(out, b.inverse, f)
+	case "equals":
+		if toString(params[0]) == toString(params[1]) {
+			return render(out, b.body, f)
+		}
+		return render(out, b.inverse, f)
+	case "each":
+		switch v := params[0].(type) {
+		case []interface{}:
+			if len(v) == 0 {
+				break
+			}
+			for i, item := range v {
+				vars := map[string]interface{}{"index": float64(i), "first": i == 0, "last": i == len(v)-1}
+				if err := render(out, b.body, f.child(item, vars)); err != nil {
+					return err
+				}
+			}
+			return nil
+		case map[string]interface{}:
+			if len(v) == 0 {
+				break
+			}
+			keys := make([]string, 0, len(v))
+			for k := range v {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for i, k := range keys {
+				vars := map[string]interface{}{"key": k, "index": float64(i), "first": i == 0, "last": i == len(keys)-1}
+				if err := render(out, b.body, f.child(v[k], vars)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		return render(out, b.inverse, f)
+	}
+	return fmt.Errorf("%w: line %d: unknown block helper %q", ErrSyntax, b.line, b.name)
+}
+
+// eval resolves a literal or a path against the frame
+func (f *frame) eval(arg string) interface{} {
+	if len(arg) >= 2 && (arg[0] == '"' || arg[0] == '\'') && arg[len(arg)-1] == arg[0] {
+		return arg[1 : len(arg)-1]
+	}
+	switch arg {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "null", "undefined":
+		return nil
+	}
+	if n, err := strconv.ParseFloat(arg, 64); err == nil {
+		return n
+	}
+	return f.lookup(arg)
+}
+
+// lookup resolves a path like name.first, ../name, this, @index or @root.name
+func (f *frame) lookup(path string) interface{} {
+	for strings.HasPrefix(path, "../") {
+		if f.parent != nil {
+			f = f.parent
+		}
+		path = path[len("../"):]
+	}
+
+	switch {
+	case path == "this" || path == ".":
+		return f.value
+	case strings.HasPrefix(path, "this."):
+		path = path[len("this."):]
+	case strings.HasPrefix(path, "./"):
+		path = path[len("./"):]
+	case path == "@root":
+		return f.root.value
+	case strings.HasPrefix(path, "@root."):
+		return get(f.root.value, path[len("@root."):])
+	case strings.HasPrefix(path, "@"):
+		name, rest, _ := strings.Cut(path[1:], ".")
+		return get(f.vars[name], rest)
+	}
+	return get(f.value, path)
+}
+
+// get walks the dotted path into v
+func get(v interface{}, path string) interface{} {
+	if path == "" {
+		return v
+	}
+	for _, seg := range strings.Split(path, ".") {
+		seg = strings.TrimSuffix(strings.TrimPrefix(seg, "["), "]")
+		switch t := v.(type) {
+		case map[string]interface{}:
+			v = t[seg]
+		case []interface{}:
+			i, err := strconv.Atoi(seg)
+			if err != nil || i < 0 || i >= len(t) {
+				return nil
+			}
+			v = t[i]
+		default:
+			return nil
+		}
+	}
+	return v
+}
+
+// truthy follows handlebars, empty lists are falsy
+func truthy(v interface{}) bool {
+	switch t := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return t
+	case string:
+		return t != ""
+	case float64:
+		return t != 0
+	case []interface{}:
+		return len(t) > 0
+	}
+	return true
+}
+
+func toString(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case bool:
+		return strconv.FormatBool(t)
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case []interface{}:
+		parts := make([]string, len(t))
+		for i, item := range t {
+			parts[i] = toString(item)
+		}
+		return strings.Join(parts, ",")
+	case map[string]interface{}:
+		return "[object Object]"
+	}
+	return fmt.Sprint(v)
+}
+
+var escaper = strings.NewReplacer(
+	"&", "&amp;",
+	"<", "&lt;",
+	">", "&gt;",
+	`"`, "&quot;",
+	"'", "&#x27;",
+	"`", "&#x60;",
+	"=", "&#x3D;",
+)
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
@@ -0,0 +1,140 @@
+package handlebars
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	data := map[string]interface{}{
+		"name":    "Ada",
+		"empty":   "",
+		"zero":    0,
+		"html":    `<b>"Ada" & 'co'</b>`,
+		"user":    map[string]interface{}{"first": "Ada", "last": "Lovelace"},
+		"items":   []interface{}{"a", "b", "c"},
+		"none":    []interface{}{},
+		"prices":  map[string]interface{}{"eur": 10, "usd": 12.5},
+		"orders":  []interface{}{map[string]interface{}{"id": "o1", "qty": 2}, map[string]interface{}{"id": "o2", "qty": 1}},
+		"enabled": true,
+		"plan":    "pro",
+	}
+
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"text", "Hello", "Hello"},
+		{"value", "Hi {{name}}!", "Hi Ada!"},
+		{"missing value", "Hi {{nobody}}!", "Hi !"},
+		{"path", "{{user.first}} {{ user.last }}", "Ada Lovelace"},
+		{"index path", "{{items.[1]}}{{items.1}}{{items.9}}", "bb"},
+		{"number", "{{zero}} {{prices.usd}}", "0 12.5"},
+		{"list", "{{items}}", "a,b,c"},
+		{"object", "{{user}}", "[object Object]"},
+		{"escaped", "{{html}}", "&lt;b&gt;&quot;Ada&quot; &amp; &#x27;co&#x27;&lt;/b&gt;"},
+		{"raw", "{{{html}}}", `<b>"Ada" & 'co'</b>`},
+		{"if", "{{#if enabled}}on{{else}}off{{/if}}", "on"},
+		{"if empty string", "{{#if empty}}on{{else}}off{{/if}}", "off"},
+		{"if zero", "{{#if zero}}on{{else}}off{{/if}}", "off"},
+		{"if empty list", "{{#if none}}on{{else}}off{{/if}}", "off"},
+		{"if object", "{{#if user}}on{{/if}}", "on"},
+		{"else if", "{{#if empty}}a{{else if enabled}}b{{else}}c{{/if}}", "b"},
+		{"else if falls through", "{{#if empty}}a{{else if zero}}b{{else}}c{{/if}}", "c"},
+		{"unless", "{{#unless empty}}shown{{/unless}}", "shown"},
+		{"equals", `{{#equals plan "pro"}}pro{{else}}free{{/equals}}`, "pro"},
+		{"equals number", `{{#equals zero 0}}zero{{/equals}}`, "zero"},
+		{"not equals", `{{#equals plan "free"}}free{{else}}paid{{/equals}}`, "paid"},
+		{"each", "{{#each items}}{{@index}}:{{this}}{{#unless @last}},{{/unless}}{{/each}}", "0:a,1:b,2:c"},
+		{"each first", "{{#each items}}{{#if @first}}[{{.}}]{{/if}}{{/each}}", "[a]"},
+		{"each object sorted", "{{#each prices}}{{@key}}={{this}};{{/each}}", "eur=10;usd=12.5;"},
+		{"each item fields", "{{#each orders}}{{id}}x{{this.qty}} {{/each}}", "o1x2 o2x1 "},
+		{"each parent", "{{#each items}}{{../name}}{{/each}}", "AdaAdaAda"},
+		{"each root", "{{#each orders}}{{@root.user.first}}{{/each}}", "AdaAda"},
+		{"each empty", "{{#each none}}x{{else}}no items{{/each}}", "no items"},
+		{"each missing", "{{#each nobody}}x{{else}}no items{{/each}}", "no items"},
+		{"nested each", "{{#each orders}}{{#each ../items}}{{../id}}{{this}}{{/each}};{{/each}}", "o1ao1bo1c;o2ao2bo2c;"},
+		{"comment", "a{{! note }}b{{!-- has }} inside --}}c", "abc"},
+		{"whitespace control", "a  {{~name~}}  \n b", "aAdab"},
+		{"whitespace control on blocks", "<ul>\n  {{~#each items~}}\n  <li>{{this}}</li>\n  {{~/each~}}\n</ul>", "<ul><li>a</li><li>b</li><li>c</li></ul>"},
+		{"comment whitespace control", "a \n{{~!-- gone --~}}\n b", "ab"},
+		{"insert", `{{insert name "default=Customer"}}`, "Ada"},
+		{"insert default", `{{insert nobody "default=Customer"}}`, "Customer"},
+		{"literals", `{{#if true}}{{insert null "default=x"}}{{/if}}`, "x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Render(tt.src, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderStruct(t *testing.T) {
+	// data goes through its json encoding like dynamic_template_data
+	data := struct {
+		Name  string `json:"firstName"`
+		Count int    `json:"count"`
+	}{"Ada", 3}
+	got, err := Render("{{firstName}} {{count}} {{Name}}", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "Ada 3 " {
+		t.Errorf("got %q", got)
+	}
+
+	if _, err := Render("{{a}}", map[string]interface{}{"a": make(chan int)}); err == nil {
+		t.Error("rendered data without a json encoding")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{"unclosed tag", "Hi {{name"},
+		{"unclosed block", "{{#if a}}x"},
+		{"mismatched close", "{{#if a}}x{{/each}}"},
+		{"stray close", "x{{/if}}"},
+		{"stray else", "x{{else}}y"},
+		{"double else", "{{#if a}}x{{else}}y{{else}}z{{/if}}"},
+		{"empty tag", "{{ }}"},
+		{"unknown block helper", "{{#with user}}{{/with}}"},
+		{"unknown helper", "{{upper name}}"},
+		{"unterminated string", `{{insert name "default=x}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.src); !errors.Is(err, ErrSyntax) {
+				t.Errorf("got %v, want ErrSyntax", err)
+			}
+		})
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{"if without argument", "{{#if}}x{{/if}}"},
+		{"equals with one argument", "{{#equals a}}x{{/equals}}"},
+		{"bad timestamp", `{{formatDate "soon" "YYYY"}}`},
+		{"formatDate without format", `{{formatDate 0}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Render(tt.src, nil); err == nil {
+				t.Error("rendered without an error")
+			}
+		})
+	}
+}
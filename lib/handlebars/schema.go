@@ -0,0 +1,150 @@
+package handlebars
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var ErrMissingVariable = errors.New("missing template variable")
+
+// Schema declares the variables a template renders
+type Schema struct {
+	Required []string
+	Optional []string
+}
+
+// Declares reports whether the schema declares the variable
+func (s Schema) Declares(name string) bool {
+	return contains(s.Required, name) || contains(s.Optional, name)
+}
+
+// Check fails with ErrMissingVariable when a required variable is missing
+// from data or empty
+func (s Schema) Check(data map[string]interface{}) error {
+	var missing []string
+	for _, name := range s.Required {
+		if v, ok := data[name]; !ok || v == nil || v == "" {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %s", ErrMissingVariable, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+var schemaRegexp = regexp.MustCompile(`(?m)^\s*(required|optional)\s*:(.*)$`)
+
+// ParseSchema reads the variables declared in the leading comment of the
+// template, ok is false when it declares none
+//
+//	{{!--
+//	  required: productName, productUrl
+//	  optional: firstName
+//	--}}
+func ParseSchema(src string) (s Schema, ok bool, err error) {
+	src = strings.TrimSpace(src)
+	if !strings.HasPrefix(src, "{{!--") {
+		return s, false, nil
+	}
+	end := strings.Index(src, "--}}")
+	if end < 0 {
+		return s, false, syntaxError(1, "unclosed comment")
+	}
+
+	for _, m := range schemaRegexp.FindAllStringSubmatch(src[:end], -1) {
+		ok = true
+		for _, name := range strings.FieldsFunc(m[2], func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+			if s.Declares(name) {
+				return s, ok, fmt.Errorf("%w: %q declared twice", ErrSyntax, name)
+			}
+			if m[1] == "required" {
+				s.Required = append(s.Required, name)
+			} else {
+				s.Optional = append(s.Optional, name)
+			}
+		}
+	}
+	return s, ok, nil
+}
+
+// Variables lists the top level variables the template reads, sorted
+func (t *Template) Variables() []string {
+	seen := map[string]bool{}
+	collectVariables(t.nodes, 0, seen)
+
+	vars := make([]string, 0, len(seen))
+	for name := range seen {
+		vars = append(vars, name)
+	}
+	sort.Strings(vars)
+	return vars
+}
+
+// collectVariables walks the nodes, depth counts the enclosing each blocks
+func collectVariables(nodes []node, depth int, seen map[string]bool) {
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case *exprNode:
+			if _, ok := helpers[n.name]; !ok {
+				addVariable(n.name, depth, seen)
+			}
+			for _, p := range n.params {
+				addVariable(p, depth, seen)
+			}
+		case *blockNode:
+			for _, p := range n.params {
+				addVariable(p, depth, seen)
+			}
+			bodyDepth := depth
+			if n.name == "each" {
+				bodyDepth++
+			}
+			collectVariables(n.body, bodyDepth, seen)
+			collectVariables(n.inverse, depth, seen)
+		}
+	}
+}
+
+// addVariable records the root variable a path at the depth reads, if any
+func addVariable(path string, depth int, seen map[string]bool) {
+	if path == "" || strings.ContainsAny(path[:1], `"'0123456789-`) {
+		return
+	}
+	switch path {
+	case "true", "false", "null", "undefined", "this", ".":
+		return
+	}
+
+	switch {
+	case strings.HasPrefix(path, "@root."):
+		path = path[len("@root."):]
+	case strings.HasPrefix(path, "@"):
+		return
+	default:
+		for strings.HasPrefix(path, "../") {
+			path = path[len("../"):]
+			depth--
+		}
+		path = strings.TrimPrefix(strings.TrimPrefix(path, "this."), "./")
+		if depth > 0 {
+			// relative to the item of an each block
+			return
+		}
+	}
+
+	name, _, _ := strings.Cut(path, ".")
+	seen[name] = true
+}
+
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
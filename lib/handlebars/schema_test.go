@@ -0,0 +1,100 @@
+package handlebars
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseSchema(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		want    Schema
+		wantOk  bool
+		wantErr error
+	}{
+		{
+			name:   "declared",
+			src:    "\n{{!--\n  required: productName, productUrl\n  optional: firstName\n--}}\nHi",
+			want:   Schema{Required: []string{"productName", "productUrl"}, Optional: []string{"firstName"}},
+			wantOk: true,
+		},
+		{
+			name:   "repeated lines",
+			src:    "{{!--\nrequired: a\nrequired: b c\n--}}",
+			want:   Schema{Required: []string{"a", "b", "c"}},
+			wantOk: true,
+		},
+		{name: "no comment", src: "Hi {{name}}"},
+		{name: "comment without schema", src: "{{!-- order receipt --}}Hi"},
+		{name: "not leading", src: "Hi {{!-- required: a --}}"},
+		{name: "unclosed", src: "{{!--\nrequired: a", wantErr: ErrSyntax},
+		{name: "declared twice", src: "{{!--\nrequired: a\noptional: a\n--}}", wantOk: true, wantErr: ErrSyntax},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, ok, err := ParseSchema(tt.src)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			if ok != tt.wantOk {
+				t.Errorf("ok %v, want %v", ok, tt.wantOk)
+			}
+			if err == nil && !reflect.DeepEqual(s, tt.want) {
+				t.Errorf("got %+v, want %+v", s, tt.want)
+			}
+		})
+	}
+}
+
+func TestSchemaCheck(t *testing.T) {
+	s := Schema{Required: []string{"productName", "productUrl"}, Optional: []string{"firstName"}}
+	if !s.Declares("firstName") || s.Declares("lastName") {
+		t.Error("Declares")
+	}
+
+	tests := []struct {
+		name string
+		data map[string]interface{}
+		want error
+	}{
+		{"complete", map[string]interface{}{"productName": "Guide", "productUrl": "https://example.com", "extra": 1}, nil},
+		{"missing", map[string]interface{}{"productName": "Guide"}, ErrMissingVariable},
+		{"empty", map[string]interface{}{"productName": "Guide", "productUrl": ""}, ErrMissingVariable},
+		{"nil", map[string]interface{}{"productName": nil, "productUrl": "https://example.com"}, ErrMissingVariable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.Check(tt.data); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVariables(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{"values", "{{b}} {{a.first}} {{{c}}} {{b}}", []string{"a", "b", "c"}},
+		{"helpers", `{{formatDate date "YYYY"}} {{insert name "default=x"}}`, []string{"date", "name"}},
+		{"blocks", `{{#if a}}{{b}}{{else if c}}{{d}}{{else}}{{e}}{{/if}}{{#equals f "x"}}{{/equals}}`, []string{"a", "b", "c", "d", "e", "f"}},
+		{"each items are relative", "{{#each items}}{{id}} {{this.qty}} {{../total}} {{@root.currency}} {{@index}}{{/each}}", []string{"currency", "items", "total"}},
+		{"each inverse", "{{#each items}}{{/each}}{{#each items}}x{{else}}{{empty}}{{/each}}", []string{"empty", "items"}},
+		{"literals", `{{#equals 1 "a"}}{{/equals}}{{#if true}}{{this}}{{/if}}`, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := Parse(tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := tmpl.Variables(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+// Package jsonstore keeps a map of values in process memory or in a json
+// file on the local disk, shared by the memory and file drivers of the
+// stores.
+//
+// Neither is shared by cloud function instances: memory is lost when the
+// instance is recycled and the file lives on the instance's disk. The stores
+// offer a firestore driver for state that must hold across instances.
+package jsonstore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var ErrNoPath = errors.New("jsonstore: file store requires a path")
+
+// Store holds values by key. Access is serialized within the process. File
+// stores read the file on every call and replace it atomically on every
+// update, so a crash mid-write never leaves a truncated file behind.
+type Store[V any] struct {
+	mu     sync.Mutex
+	path   string
+	values map[string]V // memory store
+}
+
+// NewMemory returns a store kept in process memory
+func NewMemory[V any]() *Store[V] {
+	return &Store[V]{values: map[string]V{}}
+}
+
+// NewFile returns a store kept in the json file at path, creating its
+// directory. An existing file must be readable.
+func NewFile[V any](path string) (*Store[V], error) {
+	if path == "" {
+		return nil, ErrNoPath
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("jsonstore: %w", err)
+	}
+	s := &Store[V]{path: path}
+	if _, err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// View calls fn with the stored values, changes to them are discarded by
+// file stores
+func (s *Store[V]) View(fn func(values map[string]V) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	values, err := s.load()
+	if err != nil {
+		return err
+	}
+	return fn(values)
+}
+
+// Update calls fn with the stored values and keeps its changes. fn must
+// return any error before changing them, memory stores keep changes as made.
+func (s *Store[V]) Update(fn func(values map[string]V) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	values, err := s.load()
+	if err != nil {
+		return err
+	}
+	if err := fn(values); err != nil {
+		return err
+	}
+	return s.save(values)
+}
+
+func (s *Store[V]) load() (map[string]V, error) {
+	if s.path == "" {
+		return s.values, nil
+	}
+
+	values := map[string]V{}
+	b, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return values, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("jsonstore: %w", err)
+	}
+	if len(b) == 0 {
+		return values, nil
+	}
+	if err := json.Unmarshal(b, &values); err != nil {
+		return nil, fmt.Errorf("jsonstore: corrupt store file %s: %w", s.path, err)
+	}
+	return values, nil
+}
+
+func (s *Store[V]) save(values map[string]V) error {
+	if s.path == "" {
+		return nil
+	}
+
+	b, err := json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return fmt.Errorf("jsonstore: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return fmt.Errorf("jsonstore: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("jsonstore: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("jsonstore: %w", err)
+	}
+	return nil
+}
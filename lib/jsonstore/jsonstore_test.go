@@ -0,0 +1,97 @@
+package jsonstore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	tests := []struct {
+		name string
+		open func(t *testing.T) *Store[int]
+	}{
+		{"memory", func(t *testing.T) *Store[int] { return NewMemory[int]() }},
+		{"file", func(t *testing.T) *Store[int] {
+			s, err := NewFile[int](filepath.Join(t.TempDir(), "nested", "store.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return s
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tt.open(t)
+
+			var wg sync.WaitGroup
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					s.Update(func(values map[string]int) error {
+						values["n"]++
+						return nil
+					})
+				}()
+			}
+			wg.Wait()
+
+			errRefused := errors.New("refused")
+			if err := s.Update(func(values map[string]int) error { return errRefused }); err != errRefused {
+				t.Errorf("Update returned %v, want the error of fn", err)
+			}
+
+			var got int
+			s.View(func(values map[string]int) error {
+				got = values["n"]
+				values["n"] = 0 // discarded by file stores only
+				return nil
+			})
+			if got != 20 {
+				t.Errorf("got %d, want 20", got)
+			}
+		})
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "store.json")
+
+	s, err := NewFile[string](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Update(func(values map[string]string) error {
+		values["a"] = "1"
+		return nil
+	})
+
+	// a second store of the file sees the values, without temp files left
+	reopened, err := NewFile[string](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reopened.View(func(values map[string]string) error {
+		if values["a"] != "1" {
+			t.Errorf("reopened store holds %v", values)
+		}
+		return nil
+	})
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("%d files in the store directory, want 1", len(entries))
+	}
+
+	if _, err := NewFile[string](""); !errors.Is(err, ErrNoPath) {
+		t.Errorf("without a path: got %v, want ErrNoPath", err)
+	}
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFile[string](path); err == nil {
+		t.Error("opened a corrupt store file")
+	}
+}
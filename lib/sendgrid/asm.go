@@ -0,0 +1,146 @@
+package sendgrid
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// AsmGroupService manages unsubscribe groups and their suppressions
+type AsmGroupService service
+
+// Documentation: https://docs.sendgrid.com/api-reference/suppressions-unsubscribe-groups
+type AsmGroup struct {
+	ID           int64  `json:"id,omitempty"`
+	Name         string `json:"name,omitempty"`
+	Description  string `json:"description,omitempty"`
+	IsDefault    bool   `json:"is_default"`
+	Unsubscribes int    `json:"unsubscribes,omitempty"`
+}
+
+type recipientEmails struct {
+	RecipientEmails []string `json:"recipient_emails"`
+}
+
+// List fetches every unsubscribe group
+func (s *AsmGroupService) List(ctx context.Context) ([]*AsmGroup, *http.Response, error) {
+	req, err := s.client.NewRequest("GET", "asm/groups", nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var groups []*AsmGroup
+	resp, err := s.client.Do(ctx, req, &groups)
+	if err != nil {
+		return nil, resp, err
+	}
+	return groups, resp, nil
+}
+
+// Get fetches an unsubscribe group
+func (s *AsmGroupService) Get(ctx context.Context, groupID int64) (*AsmGroup, *http.Response, error) {
+	req, err := s.client.NewRequest("GET", fmt.Sprintf("asm/groups/%d", groupID), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	group := &AsmGroup{}
+	resp, err := s.client.Do(ctx, req, group)
+	if err != nil {
+		return nil, resp, err
+	}
+	return group, resp, nil
+}
+
+// Create creates an unsubscribe group
+func (s *AsmGroupService) Create(ctx context.Context, g *AsmGroup) (*AsmGroup, *http.Response, error) {
+	req, err := s.client.NewRequest("POST", "asm/groups", g)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	group := &AsmGroup{}
+	resp, err := s.client.Do(ctx, req, group)
+	if err != nil {
+		return nil, resp, err
+	}
+	return group, resp, nil
+}
+
+// Update edits the name, description or default flag of an unsubscribe group
+func (s *AsmGroupService) Update(ctx context.Context, groupID int64, g *AsmGroup) (*AsmGroup, *http.Response, error) {
+	req, err := s.client.NewRequest("PATCH", fmt.Sprintf("asm/groups/%d", groupID), g)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	group := &AsmGroup{}
+	resp, err := s.client.Do(ctx, req, group)
+	if err != nil {
+		return nil, resp, err
+	}
+	return group, resp, nil
+}
+
+// Delete deletes an unsubscribe group, its suppressed recipients become
+// subscribed to the emails of the group again
+func (s *AsmGroupService) Delete(ctx context.Context, groupID int64) (*http.Response, error) {
+	req, err := s.client.NewRequest("DELETE", fmt.Sprintf("asm/groups/%d", groupID), nil)
+	if err != nil {
+		return nil, err
+	}
+	return s.client.Do(ctx, req, nil)
+}
+
+// ListSuppressions fetches the emails unsubscribed from the group
+func (s *AsmGroupService) ListSuppressions(ctx context.Context, groupID int64) ([]string, *http.Response, error) {
+	req, err := s.client.NewRequest("GET", fmt.Sprintf("asm/groups/%d/suppressions", groupID), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var emails []string
+	resp, err := s.client.Do(ctx, req, &emails)
+	if err != nil {
+		return nil, resp, err
+	}
+	return emails, resp, nil
+}
+
+// AddSuppressions unsubscribes the emails from the group
+func (s *AsmGroupService) AddSuppressions(ctx context.Context, groupID int64, emails ...string) (*http.Response, error) {
+	u := fmt.Sprintf("asm/groups/%d/suppressions", groupID)
+	req, err := s.client.NewRequest("POST", u, recipientEmails{RecipientEmails: emails})
+	if err != nil {
+		return nil, err
+	}
+	return s.client.Do(ctx, req, nil)
+}
+
+// SearchSuppressions returns which of the emails are unsubscribed from the
+// group
+func (s *AsmGroupService) SearchSuppressions(ctx context.Context, groupID int64, emails ...string) ([]string, *http.Response, error) {
+	u := fmt.Sprintf("asm/groups/%d/suppressions/search", groupID)
+	req, err := s.client.NewRequest("POST", u, recipientEmails{RecipientEmails: emails})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var suppressed []string
+	resp, err := s.client.Do(ctx, req, &suppressed)
+	if err != nil {
+		return nil, resp, err
+	}
+	return suppressed, resp, nil
+}
+
+// DeleteSuppression resubscribes the email to the group
+func (s *AsmGroupService) DeleteSuppression(ctx context.Context, groupID int64, email string) (*http.Response, error) {
+	u := fmt.Sprintf("asm/groups/%d/suppressions/%s", groupID, url.PathEscape(email))
+	req, err := s.client.NewRequest("DELETE", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	return s.client.Do(ctx, req, nil)
+}
@@ -1,3 +1,130 @@
 package sendgrid
 
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
 type JobID string
+
+type JobService service
+
+const (
+	JobStatusPending   = "pending"
+	JobStatusCompleted = "completed"
+	JobStatusErrored   = "errored"
+	JobStatusFailed    = "failed"
+)
+
+// Job is an asynchronous contact import, update or deletion
+//
+// Documentation: https://docs.sendgrid.com/api-reference/contacts/import-contacts-status
+type Job struct {
+	ID         string      `json:"id"`
+	Status     string      `json:"status"`
+	JobType    string      `json:"job_type"`
+	Results    *JobResults `json:"results,omitempty"`
+	StartedAt  *time.Time  `json:"started_at,omitempty"`
+	FinishedAt *time.Time  `json:"finished_at,omitempty"`
+}
+
+type JobResults struct {
+	RequestedCount int `json:"requested_count"`
+	CreatedCount   int `json:"created_count"`
+	UpdatedCount   int `json:"updated_count"`
+	DeletedCount   int `json:"deleted_count"`
+	ErroredCount   int `json:"errored_count"`
+	// url of a csv with the rows that failed, if any
+	ErrorsURL string `json:"errors_url,omitempty"`
+}
+
+// Done reports whether the job stopped running
+func (j *Job) Done() bool {
+	return j.Status != JobStatusPending
+}
+
+// Err returns a *JobError if the job failed or some of its rows errored
+func (j *Job) Err() error {
+	if j.Status == JobStatusErrored || j.Status == JobStatusFailed {
+		return &JobError{Job: j}
+	}
+	if j.Results != nil && j.Results.ErroredCount > 0 {
+		return &JobError{Job: j}
+	}
+	return nil
+}
+
+// JobError reports a failed or partially failed job
+type JobError struct {
+	Job *Job
+}
+
+func (e *JobError) Error() string {
+	msg := fmt.Sprintf("job %s %s", e.Job.ID, e.Job.Status)
+	if r := e.Job.Results; r != nil && r.ErroredCount > 0 {
+		msg += fmt.Sprintf(": %d of %d rows errored", r.ErroredCount, r.RequestedCount)
+		if r.ErrorsURL != "" {
+			msg += ", see " + r.ErrorsURL
+		}
+	}
+	return msg
+}
+
+// WaitOptions configures the polling backoff of WaitForJob
+type WaitOptions struct {
+	// first delay between polls, doubled after every poll. defaults to 1s
+	InitialInterval time.Duration
+	// upper bound of the delay between polls. defaults to 30s
+	MaxInterval time.Duration
+}
+
+// Get fetches the status of a job
+func (s *JobService) Get(ctx context.Context, jobID JobID) (*Job, *http.Response, error) {
+	req, err := s.client.NewRequest("GET", "marketing/contacts/imports/"+url.PathEscape(string(jobID)), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	job := &Job{}
+	resp, err := s.client.Do(ctx, req, job)
+	if err != nil {
+		return nil, resp, err
+	}
+	return job, resp, nil
+}
+
+// WaitForJob polls the job with exponential backoff until it is done or ctx
+// is canceled. The finished job is returned along with job.Err().
+func (s *JobService) WaitForJob(ctx context.Context, jobID JobID, opts *WaitOptions) (*Job, error) {
+	interval, maxInterval := time.Second, 30*time.Second
+	if opts != nil && opts.InitialInterval > 0 {
+		interval = opts.InitialInterval
+	}
+	if opts != nil && opts.MaxInterval > 0 {
+		maxInterval = opts.MaxInterval
+	}
+
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+
+		job, _, err := s.Get(ctx, jobID)
+		if err != nil {
+			return nil, err
+		}
+		if job.Done() {
+			return job, job.Err()
+		}
+
+		interval = min(interval*2, maxInterval)
+		timer.Reset(interval)
+	}
+}
@@ -2,7 +2,11 @@ package sendgrid
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 )
 
 type ContactService service
@@ -21,6 +25,41 @@ type Contact struct {
 	CustomFields        map[string]interface{} `json:"custom_fields,omitempty"`
 }
 
+// ContactDetails is a contact as returned by SendGrid. CustomFields are
+// keyed by field name.
+type ContactDetails struct {
+	Contact
+	ID          string     `json:"id"`
+	ListIDs     []string   `json:"list_ids,omitempty"`
+	SegmentIDs  []string   `json:"segment_ids,omitempty"`
+	PhoneNumber string     `json:"phone_number,omitempty"`
+	Whatsapp    string     `json:"whatsapp,omitempty"`
+	Line        string     `json:"line,omitempty"`
+	Facebook    string     `json:"facebook,omitempty"`
+	UniqueName  string     `json:"unique_name,omitempty"`
+	CreatedAt   *time.Time `json:"created_at,omitempty"`
+	UpdatedAt   *time.Time `json:"updated_at,omitempty"`
+}
+
+// InList reports whether the contact is on the list
+func (c *ContactDetails) InList(listID string) bool {
+	for _, id := range c.ListIDs {
+		if id == listID {
+			return true
+		}
+	}
+	return false
+}
+
+// ContactSearchResult holds the contacts matching a search query
+type ContactSearchResult struct {
+	Result       []*ContactDetails `json:"result"`
+	ContactCount int               `json:"contact_count"`
+	Metadata     PageMetadata      `json:"_metadata"`
+}
+
+var ErrNoContactIDs = errors.New("no contact ids to delete")
+
 type ContactRequest struct {
 	ListIDs  []string   `json:"list_ids"`
 	Contacts []*Contact `json:"contacts"`
@@ -39,3 +78,97 @@ func (s *ContactService) Upsert(ctx context.Context, contactReq *ContactRequest)
 	}
 	return jobResponse["job_id"], resp, nil
 }
+
+type contactSearchEmailsResponse struct {
+	Result map[string]struct {
+		Contact *ContactDetails `json:"contact"`
+		Error   string          `json:"error"`
+	} `json:"result"`
+}
+
+// GetByEmails looks up contacts by email address. Emails that do not match a
+// contact are left out of the returned map.
+func (s *ContactService) GetByEmails(ctx context.Context, emails ...string) (map[string]*ContactDetails, *http.Response, error) {
+	req, err := s.client.NewRequest("POST", "marketing/contacts/search/emails", map[string][]string{"emails": emails})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var searchResponse contactSearchEmailsResponse
+	resp, err := s.client.Do(ctx, req, &searchResponse)
+	if errors.Is(err, ErrNotFound) {
+		// none of the emails matched a contact
+		return map[string]*ContactDetails{}, resp, nil
+	}
+	if err != nil {
+		return nil, resp, err
+	}
+
+	contacts := map[string]*ContactDetails{}
+	for email, r := range searchResponse.Result {
+		if r.Contact != nil {
+			contacts[email] = r.Contact
+		}
+	}
+	return contacts, resp, nil
+}
+
+// Get fetches a contact by id
+func (s *ContactService) Get(ctx context.Context, contactID string) (*ContactDetails, *http.Response, error) {
+	req, err := s.client.NewRequest("GET", "marketing/contacts/"+url.PathEscape(contactID), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	contact := &ContactDetails{}
+	resp, err := s.client.Do(ctx, req, contact)
+	if err != nil {
+		return nil, resp, err
+	}
+	return contact, resp, nil
+}
+
+// Search finds contacts with a SGQL query, ie. email LIKE 'ann%' AND
+// CONTAINS(list_ids, '<list id>'). SendGrid returns up to 50 contacts.
+//
+// Documentation: https://docs.sendgrid.com/for-developers/sending-email/marketing-campaigns-v2-segmentation-query-reference
+func (s *ContactService) Search(ctx context.Context, query string) (*ContactSearchResult, *http.Response, error) {
+	req, err := s.client.NewRequest("POST", "marketing/contacts/search", map[string]string{"query": query})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result := &ContactSearchResult{}
+	resp, err := s.client.Do(ctx, req, result)
+	if err != nil {
+		return nil, resp, err
+	}
+	return result, resp, nil
+}
+
+// Delete deletes contacts by id in an async job
+func (s *ContactService) Delete(ctx context.Context, contactIDs ...string) (JobID, *http.Response, error) {
+	if len(contactIDs) == 0 {
+		return "", nil, ErrNoContactIDs
+	}
+	return s.delete(ctx, url.Values{"ids": {strings.Join(contactIDs, ",")}})
+}
+
+// DeleteAll deletes every contact of the account in an async job
+func (s *ContactService) DeleteAll(ctx context.Context) (JobID, *http.Response, error) {
+	return s.delete(ctx, url.Values{"delete_all_contacts": {"true"}})
+}
+
+func (s *ContactService) delete(ctx context.Context, q url.Values) (JobID, *http.Response, error) {
+	req, err := s.client.NewRequest("DELETE", "marketing/contacts?"+q.Encode(), nil)
+	if err != nil {
+		return "", nil, err
+	}
+
+	jobResponse := map[string]JobID{}
+	resp, err := s.client.Do(ctx, req, &jobResponse)
+	if err != nil {
+		return "", resp, err
+	}
+	return jobResponse["job_id"], resp, nil
+}
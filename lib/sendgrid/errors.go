@@ -0,0 +1,143 @@
+package sendgrid
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Sentinel errors matched by errors.Is against any *ErrorResponse with the
+// corresponding status code
+var (
+	ErrBadRequest      = errors.New("sendgrid: bad request")
+	ErrUnauthorized    = errors.New("sendgrid: unauthorized")
+	ErrForbidden       = errors.New("sendgrid: forbidden")
+	ErrNotFound        = errors.New("sendgrid: not found")
+	ErrPayloadTooLarge = errors.New("sendgrid: payload too large")
+	ErrTooManyRequests = errors.New("sendgrid: too many requests")
+	ErrServerError     = errors.New("sendgrid: server error")
+)
+
+// maxErrorBodyBytes caps the raw body kept on errors
+const maxErrorBodyBytes = 64 << 10
+
+type ErrorResponse struct {
+	Response *http.Response // HTTP response that caused this error
+	Errors   []*Error       `json:"errors,omitempty"`
+
+	// Body is the raw response body, kept for bodies that are not the
+	// documented json error shape
+	Body []byte `json:"-"`
+}
+
+type Error struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+	ErrorID string `json:"error_id"`
+}
+
+// StatusCode returns the http status code of the response
+func (r *ErrorResponse) StatusCode() int {
+	if r.Response == nil {
+		return 0
+	}
+	return r.Response.StatusCode
+}
+
+// Retryable reports whether the request may succeed when sent again
+func (r *ErrorResponse) Retryable() bool {
+	c := r.StatusCode()
+	return c == http.StatusTooManyRequests || c >= 500
+}
+
+func (r *ErrorResponse) Error() string {
+	var b strings.Builder
+	if r.Response != nil && r.Response.Request != nil {
+		fmt.Fprintf(&b, "[%v] %v: ", r.Response.Request.Method, sanitizeURL(r.Response.Request.URL))
+	}
+	fmt.Fprintf(&b, "%d", r.StatusCode())
+
+	switch {
+	case len(r.Errors) > 0 && r.Errors[0] != nil:
+		fmt.Fprintf(&b, " | (1/%d) %s", len(r.Errors), r.Errors[0].Message)
+		if r.Errors[0].Field != "" {
+			fmt.Fprintf(&b, " (%s)", r.Errors[0].Field)
+		}
+	case len(r.Body) > 0:
+		body := strings.TrimSpace(string(r.Body))
+		if len(body) > 200 {
+			body = body[:200] + "..."
+		}
+		fmt.Fprintf(&b, " | %s", body)
+	default:
+		fmt.Fprintf(&b, " | %s", http.StatusText(r.StatusCode()))
+	}
+	return b.String()
+}
+
+// Is matches the sentinel error of the response status code
+func (r *ErrorResponse) Is(target error) bool {
+	switch c := r.StatusCode(); {
+	case c == http.StatusBadRequest:
+		return target == ErrBadRequest
+	case c == http.StatusUnauthorized:
+		return target == ErrUnauthorized
+	case c == http.StatusForbidden:
+		return target == ErrForbidden
+	case c == http.StatusNotFound:
+		return target == ErrNotFound
+	case c == http.StatusRequestEntityTooLarge:
+		return target == ErrPayloadTooLarge
+	case c == http.StatusTooManyRequests:
+		return target == ErrTooManyRequests
+	case c >= 500:
+		return target == ErrServerError
+	}
+	return false
+}
+
+// sanitizeURL redacts the client_secret parameter from the URL which may be
+// exposed to the user.
+func sanitizeURL(uri *url.URL) *url.URL {
+	if uri == nil {
+		return nil
+	}
+	params := uri.Query()
+	if len(params.Get("client_secret")) > 0 {
+		params.Set("client_secret", "REDACTED")
+		uri.RawQuery = params.Encode()
+	}
+	return uri
+}
+
+// CheckResponse checks the API response for errors, and returns them if
+// present. A response is considered an error if it has a status code outside
+// the 200 range.
+// API error responses are expected to have response
+// body, and a JSON response body that maps to ErrorResponse. Any other body
+// is kept as is in ErrorResponse.Body.
+//
+// The error type will be *RateLimitError for rate limit exceeded errors,
+// and *ErrorResponse otherwise. Use errors.Is with the sentinel errors, ie.
+// ErrUnauthorized, to check for a status.
+func CheckResponse(r *http.Response) error {
+	if c := r.StatusCode; 200 <= c && c <= 299 {
+		return nil
+	}
+	errorResponse := &ErrorResponse{Response: r}
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxErrorBodyBytes))
+	if err == nil && len(data) > 0 {
+		errorResponse.Body = data
+		if json.Unmarshal(data, errorResponse) != nil {
+			errorResponse.Errors = nil
+		}
+	}
+	if r.StatusCode == http.StatusTooManyRequests {
+		return newRateLimitError(r, errorResponse)
+	}
+	return errorResponse
+}
@@ -0,0 +1,111 @@
+package sendgrid
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func response(code int, body string, header http.Header) *http.Response {
+	u, _ := url.Parse("https://api.sendgrid.com/v3/marketing/lists?client_secret=shh")
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		StatusCode: code,
+		Header:     header,
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    &http.Request{Method: http.MethodPost, URL: u},
+	}
+}
+
+func TestCheckResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     int
+		body     string
+		sentinel error
+		message  string
+	}{
+		{"ok", 200, "", nil, ""},
+		{"accepted", 202, "", nil, ""},
+		{"bad request", 400, `{"errors":[{"field":"name","message":"too long"},{"message":"other"}]}`, ErrBadRequest, "400 | (1/2) too long (name)"},
+		{"unauthorized", 401, `{"errors":[{"message":"bad key"}]}`, ErrUnauthorized, "401 | (1/1) bad key"},
+		{"forbidden", 403, "", ErrForbidden, "403 | Forbidden"},
+		{"not found", 404, "not json", ErrNotFound, "404 | not json"},
+		{"too large", 413, "<html>too big</html>", ErrPayloadTooLarge, "413 | <html>too big</html>"},
+		{"server error", 502, `{"errors":"not a list"}`, ErrServerError, `502 | {"errors":"not a list"}`},
+		{"teapot", 418, "", nil, "418 | I'm a teapot"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := response(tt.code, tt.body, nil)
+			err := CheckResponse(r)
+			if tt.code < 300 {
+				if err != nil {
+					t.Errorf("got %v", err)
+				}
+				return
+			}
+			var errResp *ErrorResponse
+			if !errors.As(err, &errResp) {
+				t.Fatalf("got %T, want *ErrorResponse", err)
+			}
+			if tt.sentinel != nil && !errors.Is(err, tt.sentinel) {
+				t.Errorf("%v does not match %v", err, tt.sentinel)
+			}
+			if errors.Is(err, ErrTooManyRequests) {
+				t.Errorf("%v matches ErrTooManyRequests", err)
+			}
+			if !strings.HasSuffix(err.Error(), tt.message) {
+				t.Errorf("message %q, want suffix %q", err.Error(), tt.message)
+			}
+			if strings.Contains(err.Error(), "shh") {
+				t.Errorf("message %q leaks the client secret", err.Error())
+			}
+		})
+	}
+}
+
+func TestRateLimitError(t *testing.T) {
+	reset := time.Now().Add(30 * time.Second).Truncate(time.Second)
+	r := response(429, `{"errors":[{"message":"too many requests"}]}`, http.Header{
+		"X-Ratelimit-Limit":     {"600"},
+		"X-Ratelimit-Remaining": {"0"},
+		"X-Ratelimit-Reset":     {strconv.FormatInt(reset.Unix(), 10)},
+	})
+
+	err := CheckResponse(r)
+	var rlErr *RateLimitError
+	if !errors.As(err, &rlErr) {
+		t.Fatalf("got %T, want *RateLimitError", err)
+	}
+	if !errors.Is(err, ErrTooManyRequests) || !rlErr.Retryable() {
+		t.Errorf("%v is not a retryable ErrTooManyRequests", err)
+	}
+	if rlErr.Limit != 600 || rlErr.Remaining != 0 || !rlErr.Reset.Equal(reset) {
+		t.Errorf("got limit %d remaining %d reset %v", rlErr.Limit, rlErr.Remaining, rlErr.Reset)
+	}
+	if w := rlErr.wait(time.Now()); w <= 0 || w > 30*time.Second {
+		t.Errorf("wait %v", w)
+	}
+
+	rlErr.RetryAfter = 5 * time.Second
+	if w := rlErr.wait(time.Now()); w != 5*time.Second {
+		t.Errorf("Retry-After wins over the reset, got %v", w)
+	}
+}
+
+func TestErrorWithoutResponse(t *testing.T) {
+	// never panics on a zero error
+	err := &ErrorResponse{}
+	if err.StatusCode() != 0 || err.Retryable() || errors.Is(err, ErrServerError) {
+		t.Errorf("zero error: %d %v", err.StatusCode(), err.Retryable())
+	}
+	_ = err.Error()
+}
@@ -1,5 +1,11 @@
 package sendgrid
 
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
 // Documentation: https://sendgrid.com/docs/for-developers/tracking-events/event/
 type Event string
 
@@ -43,4 +49,64 @@ type WebhookEvent struct {
 	TemplateVersionID string      `json:"template_version_id"`
 	Timestamp         int64       `json:"timestamp"`
 	Useragent         string      `json:"useragent"`
+
+	// bounce, dropped and deferred events
+	Reason string `json:"reason"`
+	Status string `json:"status"`
+	// bounce or blocked for bounce events
+	Type                 string `json:"type"`
+	BounceClassification string `json:"bounce_classification"`
+
+	// unsubscribe group of group_unsubscribe and group_resubscribe events
+	AsmGroupID int64 `json:"asm_group_id"`
+
+	// custom_args of the message, sent as top level event fields
+	CustomArgs map[string]string `json:"-"`
+}
+
+// webhookEventFields holds the json names of the known event fields, every
+// other string field of an event is a custom arg
+var webhookEventFields = func() map[string]bool {
+	fields := map[string]bool{}
+	t := reflect.TypeOf(WebhookEvent{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		fields[name] = true
+	}
+	return fields
+}()
+
+func (e *WebhookEvent) UnmarshalJSON(b []byte) error {
+	type event WebhookEvent
+	if err := json.Unmarshal(b, (*event)(e)); err != nil {
+		return err
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	for k, v := range raw {
+		if webhookEventFields[k] {
+			continue
+		}
+		var s string
+		if err := json.Unmarshal(v, &s); err != nil {
+			continue
+		}
+		if e.CustomArgs == nil {
+			e.CustomArgs = map[string]string{}
+		}
+		e.CustomArgs[k] = s
+	}
+	return nil
+}
+
+// ParseWebhookEvents decodes a batch of events posted by the event webhook
+func ParseWebhookEvents(payload []byte) ([]*WebhookEvent, error) {
+	var events []*WebhookEvent
+	if err := json.Unmarshal(payload, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
 }
@@ -0,0 +1,74 @@
+package sendgrid
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// CustomFieldService manages the custom field definitions of contacts
+type CustomFieldService service
+
+// Custom field types
+const (
+	FieldTypeText   = "Text"
+	FieldTypeNumber = "Number"
+	FieldTypeDate   = "Date"
+)
+
+// DateFieldLayout is the layout of Date custom field values
+const DateFieldLayout = "01/02/2006"
+
+// Documentation: https://docs.sendgrid.com/api-reference/custom-fields
+type FieldDefinition struct {
+	ID        string `json:"id,omitempty"`
+	Name      string `json:"name"`
+	FieldType string `json:"field_type"`
+	ReadOnly  bool   `json:"read_only,omitempty"`
+}
+
+// FieldDefinitions holds the custom fields and the reserved contact fields,
+// ie. first_name or country
+type FieldDefinitions struct {
+	CustomFields   []*FieldDefinition `json:"custom_fields"`
+	ReservedFields []*FieldDefinition `json:"reserved_fields"`
+}
+
+// List fetches every field definition
+func (s *CustomFieldService) List(ctx context.Context) (*FieldDefinitions, *http.Response, error) {
+	req, err := s.client.NewRequest("GET", "marketing/field_definitions", nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fields := &FieldDefinitions{}
+	resp, err := s.client.Do(ctx, req, fields)
+	if err != nil {
+		return nil, resp, err
+	}
+	return fields, resp, nil
+}
+
+// Create creates a custom field of the Text, Number or Date type
+func (s *CustomFieldService) Create(ctx context.Context, name, fieldType string) (*FieldDefinition, *http.Response, error) {
+	req, err := s.client.NewRequest("POST", "marketing/field_definitions", FieldDefinition{Name: name, FieldType: fieldType})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	field := &FieldDefinition{}
+	resp, err := s.client.Do(ctx, req, field)
+	if err != nil {
+		return nil, resp, err
+	}
+	return field, resp, nil
+}
+
+// Delete deletes a custom field and its value on every contact
+func (s *CustomFieldService) Delete(ctx context.Context, fieldID string) (*http.Response, error) {
+	req, err := s.client.NewRequest("DELETE", "marketing/field_definitions/"+url.PathEscape(fieldID), nil)
+	if err != nil {
+		return nil, err
+	}
+	return s.client.Do(ctx, req, nil)
+}
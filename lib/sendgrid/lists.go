@@ -2,21 +2,214 @@ package sendgrid
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 )
 
 type ListService service
 
+// Documentation: https://docs.sendgrid.com/api-reference/lists
 type List struct {
-	Name         string `json:"name,omitempty"`
-	ID           string `json:"id,omitempty"`
-	ContactCount int    `json:"contact_count,omitempty"`
+	Name          string     `json:"name,omitempty"`
+	ID            string     `json:"id,omitempty"`
+	ContactCount  int        `json:"contact_count,omitempty"`
+	ContactSample []*Contact `json:"contact_sample,omitempty"`
 }
 
-func (s *ListService) Create(ctx context.Context, name string) (*http.Response, error) {
+// ListContactCount holds the number of contacts on a list
+type ListContactCount struct {
+	ContactCount  int `json:"contact_count"`
+	BillableCount int `json:"billable_count"`
+}
+
+// ListOptions paginates list endpoints. The page token of the following
+// page is returned by PageMetadata.NextPageToken.
+type ListOptions struct {
+	PageSize  int
+	PageToken string
+}
+
+// PageMetadata holds the pagination links of a list endpoint
+type PageMetadata struct {
+	Self  string `json:"self,omitempty"`
+	Next  string `json:"next,omitempty"`
+	Prev  string `json:"prev,omitempty"`
+	Count int    `json:"count,omitempty"`
+}
+
+// ListPage is a page of contact lists
+type ListPage struct {
+	Result   []*List      `json:"result"`
+	Metadata PageMetadata `json:"_metadata"`
+}
+
+func (o *ListOptions) values() url.Values {
+	q := url.Values{}
+	if o == nil {
+		return q
+	}
+	if o.PageSize > 0 {
+		q.Set("page_size", strconv.Itoa(o.PageSize))
+	}
+	if o.PageToken != "" {
+		q.Set("page_token", o.PageToken)
+	}
+	return q
+}
+
+// NextPageToken returns the token of the next page, or an empty string on
+// the last page
+func (m PageMetadata) NextPageToken() string {
+	if m.Next == "" {
+		return ""
+	}
+	u, err := url.Parse(m.Next)
+	if err != nil {
+		return ""
+	}
+	return u.Query().Get("page_token")
+}
+
+// Create creates a new contact list
+func (s *ListService) Create(ctx context.Context, name string) (*List, *http.Response, error) {
 	req, err := s.client.NewRequest("POST", "marketing/lists", List{Name: name})
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	list := &List{}
+	resp, err := s.client.Do(ctx, req, list)
+	if err != nil {
+		return nil, resp, err
+	}
+	return list, resp, nil
+}
+
+// Get fetches a list, with a sample of its contacts if contactSample is set
+func (s *ListService) Get(ctx context.Context, listID string, contactSample bool) (*List, *http.Response, error) {
+	u := "marketing/lists/" + url.PathEscape(listID)
+	if contactSample {
+		u += "?contact_sample=true"
+	}
+	req, err := s.client.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	list := &List{}
+	resp, err := s.client.Do(ctx, req, list)
+	if err != nil {
+		return nil, resp, err
+	}
+	return list, resp, nil
+}
+
+// List fetches a page of lists
+func (s *ListService) List(ctx context.Context, opts *ListOptions) (*ListPage, *http.Response, error) {
+	u := "marketing/lists"
+	if q := opts.values(); len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	req, err := s.client.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	page := &ListPage{}
+	resp, err := s.client.Do(ctx, req, page)
+	if err != nil {
+		return nil, resp, err
+	}
+	return page, resp, nil
+}
+
+// ListAll fetches every list, following the page tokens
+func (s *ListService) ListAll(ctx context.Context) ([]*List, error) {
+	var (
+		lists []*List
+		opts  = &ListOptions{PageSize: 1000}
+	)
+	for {
+		page, _, err := s.List(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, page.Result...)
+
+		opts.PageToken = page.Metadata.NextPageToken()
+		if opts.PageToken == "" {
+			return lists, nil
+		}
+	}
+}
+
+// Update renames a list
+func (s *ListService) Update(ctx context.Context, listID, name string) (*List, *http.Response, error) {
+	req, err := s.client.NewRequest("PATCH", "marketing/lists/"+url.PathEscape(listID), List{Name: name})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	list := &List{}
+	resp, err := s.client.Do(ctx, req, list)
+	if err != nil {
+		return nil, resp, err
+	}
+	return list, resp, nil
+}
+
+// Delete deletes a list. With deleteContacts the contacts on the list are
+// deleted as well, in an async job whose id is returned.
+func (s *ListService) Delete(ctx context.Context, listID string, deleteContacts bool) (JobID, *http.Response, error) {
+	u := "marketing/lists/" + url.PathEscape(listID)
+	if deleteContacts {
+		u += "?delete_contacts=true"
+	}
+	req, err := s.client.NewRequest("DELETE", u, nil)
+	if err != nil {
+		return "", nil, err
+	}
+
+	jobResponse := map[string]JobID{}
+	resp, err := s.client.Do(ctx, req, &jobResponse)
+	if err != nil {
+		return "", resp, err
+	}
+	return jobResponse["job_id"], resp, nil
+}
+
+// ContactCount fetches the number of contacts on a list
+func (s *ListService) ContactCount(ctx context.Context, listID string) (*ListContactCount, *http.Response, error) {
+	u := fmt.Sprintf("marketing/lists/%s/contacts/count", url.PathEscape(listID))
+	req, err := s.client.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	count := &ListContactCount{}
+	resp, err := s.client.Do(ctx, req, count)
+	if err != nil {
+		return nil, resp, err
+	}
+	return count, resp, nil
+}
+
+// RemoveContacts removes contacts from a list without deleting them
+func (s *ListService) RemoveContacts(ctx context.Context, listID string, contactIDs ...string) (JobID, *http.Response, error) {
+	q := url.Values{"contact_ids": {strings.Join(contactIDs, ",")}}
+	u := fmt.Sprintf("marketing/lists/%s/contacts?%s", url.PathEscape(listID), q.Encode())
+	req, err := s.client.NewRequest("DELETE", u, nil)
+	if err != nil {
+		return "", nil, err
+	}
+
+	jobResponse := map[string]JobID{}
+	resp, err := s.client.Do(ctx, req, &jobResponse)
+	if err != nil {
+		return "", resp, err
 	}
-	return s.client.Do(ctx, req, nil)
+	return jobResponse["job_id"], resp, nil
 }
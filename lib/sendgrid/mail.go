@@ -2,6 +2,7 @@ package sendgrid
 
 import (
 	"context"
+	"encoding/base64"
 	"net/http"
 )
 
@@ -9,36 +10,90 @@ type MailService service
 
 type MailAddress struct {
 	Email string `json:"email"`
-	Name  string `json:"name"`
+	Name  string `json:"name,omitempty"`
 }
 
 // Documentation: https://sendgrid.com/docs/api-reference/
 type MailPerson struct {
-	To                  []*MailAddress         `json:"to"`
-	DynamicTemplateData map[string]interface{} `json:"dynamic_template_data"`
+	To  []*MailAddress `json:"to"`
+	Cc  []*MailAddress `json:"cc,omitempty"`
+	Bcc []*MailAddress `json:"bcc,omitempty"`
+
+	// overrides the sender of the request for this personalization
+	From *MailAddress `json:"from,omitempty"`
+
 	Subject             string                 `json:"subject,omitempty"`
+	Headers             map[string]string      `json:"headers,omitempty"`
+	Substitutions       map[string]string      `json:"substitutions,omitempty"`
+	DynamicTemplateData map[string]interface{} `json:"dynamic_template_data,omitempty"`
 
 	// Values that are specific to this personalization that will be carried
 	// along with the email and its activity data.
 	// Substitutions will not be made on custom arguments, so any string that
 	// is entered into this parameter will be assumed to be the custom argument
 	// that you would like to be used. This field may not exceed 10,000 bytes.
-	CustomArgs map[string]string `json:"custom_args"`
+	CustomArgs map[string]string `json:"custom_args,omitempty"`
+
+	// unix timestamp to deliver this personalization at, up to 72 hours ahead
+	SendAt int64 `json:"send_at,omitempty"`
 }
 
 type MailRequest struct {
 	Personalizations []*MailPerson     `json:"personalizations"`
 	From             MailAddress       `json:"from"`
-	ReplyTo          MailAddress       `json:"reply_to"`
-	TemplateID       string            `json:"template_id"`
+	ReplyTo          *MailAddress      `json:"reply_to,omitempty"`
+	ReplyToList      []*MailAddress    `json:"reply_to_list,omitempty"`
+	Subject          string            `json:"subject,omitempty"`
+	Content          []*MailContent    `json:"content,omitempty"`
+	Attachments      []*MailAttachment `json:"attachments,omitempty"`
+	TemplateID       string            `json:"template_id,omitempty"`
+	Headers          map[string]string `json:"headers,omitempty"`
+	Categories       []string          `json:"categories,omitempty"`
+	CustomArgs       map[string]string `json:"custom_args,omitempty"`
+
+	// unix timestamp to deliver the email at, up to 72 hours ahead. Emails
+	// scheduled with a batch id can be paused or cancelled as a batch.
+	SendAt  int64  `json:"send_at,omitempty"`
+	BatchID string `json:"batch_id,omitempty"`
+
 	Asm              *Asm              `json:"asm,omitempty"`
+	IPPoolName       string            `json:"ip_pool_name,omitempty"`
 	MailSettings     *MailSettings     `json:"mail_settings,omitempty"`
 	TrackingSettings *TrackingSettings `json:"tracking_settings,omitempty"`
 }
 
+// MailContent is a body of the email, text/plain must come first
+type MailContent struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// MailAttachment is a file attached to the email
+type MailAttachment struct {
+	// base64 encoded file content
+	Content  string `json:"content"`
+	Type     string `json:"type,omitempty"`
+	Filename string `json:"filename"`
+	// attachment (default) or inline
+	Disposition string `json:"disposition,omitempty"`
+	// referenced by inline images as cid:<content_id>
+	ContentID string `json:"content_id,omitempty"`
+}
+
+// NewAttachment base64 encodes the file as an attachment
+func NewAttachment(filename, contentType string, b []byte) *MailAttachment {
+	return &MailAttachment{
+		Content:     base64.StdEncoding.EncodeToString(b),
+		Type:        contentType,
+		Filename:    filename,
+		Disposition: "attachment",
+	}
+}
+
 // MailSettings defines mail and spamCheck settings
 type MailSettings struct {
-	SandboxMode *Setting `json:"sandbox_mode,omitempty"`
+	BypassListManagement *Setting `json:"bypass_list_management,omitempty"`
+	SandboxMode          *Setting `json:"sandbox_mode,omitempty"`
 }
 
 type Asm struct {
@@ -54,8 +109,22 @@ type SubscriptionTrackingSetting struct {
 	SubstitutionTag string `json:"substitution_tag,omitempty"`
 }
 
+// ClickTrackingSetting ...
+type ClickTrackingSetting struct {
+	Enable     *bool `json:"enable,omitempty"`
+	EnableText *bool `json:"enable_text,omitempty"`
+}
+
+// OpenTrackingSetting ...
+type OpenTrackingSetting struct {
+	Enable          *bool  `json:"enable,omitempty"`
+	SubstitutionTag string `json:"substitution_tag,omitempty"`
+}
+
 // TrackingSettings are used to determine how you would like to track the metrics of how your recipients interact with your email.
 type TrackingSettings struct {
+	ClickTracking        *ClickTrackingSetting        `json:"click_tracking,omitempty"`
+	OpenTracking         *OpenTrackingSetting         `json:"open_tracking,omitempty"`
 	SubscriptionTracking *SubscriptionTrackingSetting `json:"subscription_tracking,omitempty"`
 }
 
@@ -70,7 +139,12 @@ func NewSetting(enable bool) *Setting {
 	return &Setting{Enable: &setEnable}
 }
 
+// Send validates and sends the email. Invalid requests are rejected with
+// ErrInvalidMail before reaching the api.
 func (s *MailService) Send(ctx context.Context, mailReq *MailRequest) (*http.Response, error) {
+	if err := mailReq.Validate(); err != nil {
+		return nil, err
+	}
 	req, err := s.client.NewRequest("POST", "mail/send", mailReq)
 	if err != nil {
 		return nil, err
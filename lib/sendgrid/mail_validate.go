@@ -0,0 +1,163 @@
+package sendgrid
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Mail send limits
+//
+// Documentation: https://docs.sendgrid.com/api-reference/mail-send/limitations
+const (
+	MaxPersonalizations = 1000
+	MaxRecipients       = 1000
+	MaxCategories       = 10
+	MaxCategoryLength   = 255
+	MaxCustomArgsBytes  = 10000
+	MaxMailBytes        = 30 << 20
+	MaxSendAtAhead      = 72 * time.Hour
+)
+
+var ErrInvalidMail = errors.New("invalid mail request")
+
+// headers set by SendGrid that may not be overridden
+var reservedHeaders = map[string]bool{
+	"x-sg-id": true, "x-sg-eid": true, "received": true, "dkim-signature": true,
+	"content-type": true, "content-transfer-encoding": true, "to": true,
+	"from": true, "subject": true, "reply-to": true, "cc": true, "bcc": true,
+}
+
+// Validate checks the request against the mail send limits, returning an
+// error wrapping ErrInvalidMail
+func (m *MailRequest) Validate() error {
+	if err := m.validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidMail, err)
+	}
+	return nil
+}
+
+func (m *MailRequest) validate() error {
+	if m.From.Email == "" {
+		return errors.New("from email is required")
+	}
+
+	switch n := len(m.Personalizations); {
+	case n == 0:
+		return errors.New("at least one personalization is required")
+	case n > MaxPersonalizations:
+		return fmt.Errorf("at most %d personalizations are allowed, got %d", MaxPersonalizations, n)
+	}
+
+	var recipients int
+	argsBytes := customArgsBytes(m.CustomArgs)
+	for i, p := range m.Personalizations {
+		if p == nil || len(p.To) == 0 {
+			return fmt.Errorf("personalization %d: at least one to address is required", i)
+		}
+		// an address may only appear once across to, cc and bcc
+		seen := map[string]bool{}
+		for _, addrs := range [][]*MailAddress{p.To, p.Cc, p.Bcc} {
+			for _, a := range addrs {
+				if a == nil || a.Email == "" {
+					return fmt.Errorf("personalization %d: empty recipient", i)
+				}
+				email := strings.ToLower(a.Email)
+				if seen[email] {
+					return fmt.Errorf("personalization %d: duplicate recipient %q", i, a.Email)
+				}
+				seen[email] = true
+			}
+		}
+		recipients += len(seen)
+
+		if err := validateHeaders(p.Headers); err != nil {
+			return fmt.Errorf("personalization %d: %w", i, err)
+		}
+		if err := validateSendAt(p.SendAt); err != nil {
+			return fmt.Errorf("personalization %d: %w", i, err)
+		}
+		if b := argsBytes + customArgsBytes(p.CustomArgs); b > MaxCustomArgsBytes {
+			return fmt.Errorf("personalization %d: custom_args exceed %d bytes", i, MaxCustomArgsBytes)
+		}
+	}
+	if recipients > MaxRecipients {
+		return fmt.Errorf("at most %d recipients are allowed, got %d", MaxRecipients, recipients)
+	}
+
+	if m.TemplateID == "" && len(m.Content) == 0 {
+		return errors.New("content or template_id is required")
+	}
+	for i, c := range m.Content {
+		if c.Type == "" || c.Value == "" {
+			return fmt.Errorf("content %d: type and value are required", i)
+		}
+		if c.Type == "text/plain" && i > 0 {
+			return errors.New("text/plain content must come first")
+		}
+	}
+	for i, a := range m.Attachments {
+		if a.Content == "" || a.Filename == "" {
+			return fmt.Errorf("attachment %d: content and filename are required", i)
+		}
+		if a.Disposition == "inline" && a.ContentID == "" {
+			return fmt.Errorf("attachment %q: inline attachments require a content_id", a.Filename)
+		}
+	}
+
+	if err := validateHeaders(m.Headers); err != nil {
+		return err
+	}
+	if len(m.Categories) > MaxCategories {
+		return fmt.Errorf("at most %d categories are allowed, got %d", MaxCategories, len(m.Categories))
+	}
+	for _, c := range m.Categories {
+		if len(c) > MaxCategoryLength {
+			return fmt.Errorf("category %q exceeds %d characters", c, MaxCategoryLength)
+		}
+	}
+	if argsBytes > MaxCustomArgsBytes {
+		return fmt.Errorf("custom_args exceed %d bytes", MaxCustomArgsBytes)
+	}
+	if err := validateSendAt(m.SendAt); err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if len(b) > MaxMailBytes {
+		return fmt.Errorf("request of %d bytes exceeds %d bytes", len(b), MaxMailBytes)
+	}
+	return nil
+}
+
+func validateHeaders(headers map[string]string) error {
+	for k := range headers {
+		if reservedHeaders[strings.ToLower(k)] {
+			return fmt.Errorf("header %q is reserved", k)
+		}
+	}
+	return nil
+}
+
+func validateSendAt(sendAt int64) error {
+	if sendAt == 0 {
+		return nil
+	}
+	if time.Until(time.Unix(sendAt, 0)) > MaxSendAtAhead {
+		return fmt.Errorf("send_at is more than %s ahead", MaxSendAtAhead)
+	}
+	return nil
+}
+
+func customArgsBytes(args map[string]string) int {
+	var n int
+	for k, v := range args {
+		n += len(k) + len(v)
+	}
+	return n
+}
@@ -0,0 +1,207 @@
+package sendgrid
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RetryPolicy configures how Do retries rate limited requests, server
+// errors and network failures
+type RetryPolicy struct {
+	// total attempts per request, 1 disables retries
+	MaxAttempts int
+	// backoff before the first retry, doubled for every following retry
+	InitialBackoff time.Duration
+	// upper bound of the exponential backoff
+	MaxBackoff time.Duration
+	// give up instead of waiting longer than this for a rate limit reset
+	MaxRateLimitWait time.Duration
+}
+
+// DefaultRetryPolicy is used by clients created without WithRetryPolicy
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:      3,
+	InitialBackoff:   500 * time.Millisecond,
+	MaxBackoff:       10 * time.Second,
+	MaxRateLimitWait: time.Minute,
+}
+
+// RateLimitError occurs when SendGrid returns 429 Too Many Requests
+type RateLimitError struct {
+	*ErrorResponse
+
+	Limit     int       // X-RateLimit-Limit
+	Remaining int       // X-RateLimit-Remaining
+	Reset     time.Time // X-RateLimit-Reset
+	// Retry-After, if sent
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s | rate limit %d, resets at %s", e.ErrorResponse.Error(), e.Limit, e.Reset.Format(time.RFC3339))
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return e.ErrorResponse
+}
+
+// wait returns how long to wait for the rate limit to clear
+func (e *RateLimitError) wait(now time.Time) time.Duration {
+	if e.RetryAfter > 0 {
+		return e.RetryAfter
+	}
+	if !e.Reset.IsZero() {
+		return e.Reset.Sub(now)
+	}
+	return 0
+}
+
+func newRateLimitError(r *http.Response, errorResponse *ErrorResponse) *RateLimitError {
+	e := &RateLimitError{ErrorResponse: errorResponse}
+	e.Limit, _ = strconv.Atoi(r.Header.Get("X-RateLimit-Limit"))
+	e.Remaining, _ = strconv.Atoi(r.Header.Get("X-RateLimit-Remaining"))
+	if reset, err := strconv.ParseInt(r.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		e.Reset = time.Unix(reset, 0)
+	}
+	e.RetryAfter = parseRetryAfter(r.Header.Get("Retry-After"))
+	return e
+}
+
+// parseRetryAfter parses a Retry-After header in seconds or as a http date
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+func (p RetryPolicy) maxAttempts() int {
+	return max(p.MaxAttempts, 1)
+}
+
+// idempotent reports whether sending the request twice has the same effect
+// as sending it once
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// retryDelay returns how long to wait before retrying a failed attempt,
+// and false if the request should not be retried. Non idempotent requests,
+// ie. POST mail/send, are only retried when rate limited: after a network
+// failure or server error SendGrid may have acted on them already.
+func (p RetryPolicy) retryDelay(attempt int, method string, resp *http.Response, err error) (time.Duration, bool) {
+	if attempt >= p.maxAttempts() || err == nil {
+		return 0, false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return 0, false
+	}
+
+	switch {
+	case resp != nil && resp.StatusCode == http.StatusTooManyRequests:
+	case !idempotent(method):
+		return 0, false
+	case resp == nil:
+		// network failure
+	case resp.StatusCode >= 500:
+	default:
+		return 0, false
+	}
+
+	delay := p.backoff(attempt)
+
+	var rateLimitErr *RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		wait := rateLimitErr.wait(time.Now())
+		if p.MaxRateLimitWait > 0 && wait > p.MaxRateLimitWait {
+			return 0, false
+		}
+		delay = max(delay, wait)
+	} else if resp != nil {
+		delay = max(delay, parseRetryAfter(resp.Header.Get("Retry-After")))
+	}
+	return delay, true
+}
+
+// backoff is the exponential backoff with jitter for the given attempt
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	if p.InitialBackoff <= 0 {
+		return 0
+	}
+	d := p.InitialBackoff << (attempt - 1)
+	if p.MaxBackoff > 0 && (d > p.MaxBackoff || d <= 0) {
+		d = p.MaxBackoff
+	}
+	// equal jitter, keeps at least half of the backoff
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// rateLimiter is a token bucket throttling requests client side
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(perSecond float64, burst int) *rateLimiter {
+	b := float64(max(burst, 1))
+	return &rateLimiter{rate: perSecond, burst: b, tokens: b, last: time.Now()}
+}
+
+// wait blocks until a token is available or ctx is done
+func (l *rateLimiter) wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+		l.last = now
+		if l.tokens >= 1 {
+			l.tokens--
+			l.mu.Unlock()
+			return nil
+		}
+		need := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+		l.mu.Unlock()
+
+		if err := sleep(ctx, need); err != nil {
+			return err
+		}
+	}
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
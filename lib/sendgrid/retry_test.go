@@ -0,0 +1,205 @@
+package sendgrid
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fastRetries retries without waiting, so tests run quickly
+var fastRetries = RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond, MaxRateLimitWait: time.Second}
+
+// newTestClient returns a client of the stand-in server
+func newTestClient(t *testing.T, h http.Handler, opts ...Option) *Client {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	c, err := NewClient(srv.Client(), append([]Option{WithApp("key", "secret"), WithRetryPolicy(fastRetries)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.baseURL, _ = url.Parse(srv.URL + "/v3/")
+	return c
+}
+
+func TestRetryDelay(t *testing.T) {
+	netErr := errors.New("connection reset")
+	resp := func(code int) *http.Response { return &http.Response{StatusCode: code, Header: http.Header{}} }
+	rateLimited := &RateLimitError{ErrorResponse: &ErrorResponse{Response: resp(429)}, RetryAfter: 500 * time.Millisecond}
+	tooLong := &RateLimitError{ErrorResponse: &ErrorResponse{Response: resp(429)}, RetryAfter: time.Hour}
+
+	tests := []struct {
+		name      string
+		attempt   int
+		method    string
+		resp      *http.Response
+		err       error
+		wantRetry bool
+		minDelay  time.Duration
+	}{
+		{"success", 1, http.MethodGet, resp(200), nil, false, 0},
+		{"server error", 1, http.MethodGet, resp(503), &ErrorResponse{Response: resp(503)}, true, 0},
+		{"network error", 1, http.MethodDelete, nil, netErr, true, 0},
+		{"last attempt", 3, http.MethodGet, resp(503), &ErrorResponse{Response: resp(503)}, false, 0},
+		{"client error", 1, http.MethodGet, resp(400), &ErrorResponse{Response: resp(400)}, false, 0},
+		{"canceled", 1, http.MethodGet, nil, context.Canceled, false, 0},
+		{"post server error", 1, http.MethodPost, resp(500), &ErrorResponse{Response: resp(500)}, false, 0},
+		{"post network error", 1, http.MethodPost, nil, netErr, false, 0},
+		{"post rate limited", 1, http.MethodPost, resp(429), rateLimited, true, 500 * time.Millisecond},
+		{"rate limit resets too late", 1, http.MethodGet, resp(429), tooLong, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delay, retry := fastRetries.retryDelay(tt.attempt, tt.method, tt.resp, tt.err)
+			if retry != tt.wantRetry {
+				t.Fatalf("retry %v, want %v", retry, tt.wantRetry)
+			}
+			if delay < tt.minDelay {
+				t.Errorf("delay %v, want at least %v", delay, tt.minDelay)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	tests := []struct {
+		attempt  int
+		min, max time.Duration
+	}{
+		{1, 50 * time.Millisecond, 100 * time.Millisecond},
+		{2, 100 * time.Millisecond, 200 * time.Millisecond},
+		{3, 200 * time.Millisecond, 400 * time.Millisecond},
+		{10, 500 * time.Millisecond, time.Second},
+		{80, 500 * time.Millisecond, time.Second}, // overflowed shift
+	}
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			if d := p.backoff(tt.attempt); d < tt.min || d > tt.max {
+				t.Errorf("attempt %d: backoff %v outside [%v, %v]", tt.attempt, d, tt.min, tt.max)
+			}
+		}
+	}
+	if d := (RetryPolicy{}).backoff(1); d != 0 {
+		t.Errorf("without a backoff: %v", d)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if d := parseRetryAfter("3"); d != 3*time.Second {
+		t.Errorf("seconds: %v", d)
+	}
+	if d := parseRetryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)); d < 58*time.Second || d > time.Minute {
+		t.Errorf("http date: %v", d)
+	}
+	if d := parseRetryAfter("soon"); d != 0 {
+		t.Errorf("garbage: %v", d)
+	}
+}
+
+func TestDoRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		statuses     []int
+		wantAttempts int
+		wantErr      error
+	}{
+		{"get recovers", http.MethodGet, []int{503, 502, 200}, 3, nil},
+		{"get gives up", http.MethodGet, []int{500, 500, 500, 500}, 3, ErrServerError},
+		{"put body is replayed", http.MethodPut, []int{503, 200}, 2, nil},
+		{"post is not resent after a server error", http.MethodPost, []int{500, 200}, 1, ErrServerError},
+		{"post is resent when rate limited", http.MethodPost, []int{429, 200}, 2, nil},
+		{"bad request", http.MethodGet, []int{400, 200}, 1, ErrBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts int32
+			c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := atomic.AddInt32(&attempts, 1)
+				if r.Header.Get("Authorization") != "BEARER secret" {
+					t.Errorf("authorization %q", r.Header.Get("Authorization"))
+				}
+				if r.Body != nil {
+					if b, _ := io.ReadAll(r.Body); r.Method != http.MethodGet && string(b) != "{\"name\":\"a\"}\n" {
+						t.Errorf("attempt %d body %q", n, b)
+					}
+				}
+				status := tt.statuses[n-1]
+				if status == http.StatusTooManyRequests {
+					w.Header().Set("Retry-After", "0")
+				}
+				w.WriteHeader(status)
+				w.Write([]byte(`{"id":"` + strconv.Itoa(int(n)) + `"}`))
+			}))
+
+			var body interface{}
+			if tt.method != http.MethodGet {
+				body = map[string]string{"name": "a"}
+			}
+			req, err := c.NewRequest(tt.method, "marketing/lists", body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var v struct{ ID string }
+			_, err = c.Do(context.Background(), req, &v)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			if int(attempts) != tt.wantAttempts {
+				t.Errorf("%d attempts, want %d", attempts, tt.wantAttempts)
+			}
+			if err == nil && v.ID != strconv.Itoa(tt.wantAttempts) {
+				t.Errorf("decoded %+v", v)
+			}
+		})
+	}
+}
+
+func TestDoCanceled(t *testing.T) {
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}), WithRetryPolicy(RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Hour}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, _ := c.NewRequest(http.MethodGet, "marketing/lists", nil)
+	if _, err := c.Do(ctx, req, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want the context's error while backing off", err)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	l := newRateLimiter(10, 2)
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := l.wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// two requests of the burst, the third waits for a token
+	if d := time.Since(start); d < 80*time.Millisecond {
+		t.Errorf("three requests took %v, want about 100ms", d)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := l.wait(canceled); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+	if err := (*rateLimiter)(nil).wait(ctx); err != nil {
+		t.Errorf("clients without a rate limit: %v", err)
+	}
+	if _, err := NewClient(nil, WithRateLimit(0, 1)); err == nil {
+		t.Error("accepted a zero rate limit")
+	}
+}
@@ -21,9 +21,14 @@ type Client struct {
 
 	common service
 
-	Contact *ContactService
-	List    *ListService
-	Mail    *MailService
+	AsmGroup    *AsmGroupService
+	Contact     *ContactService
+	CustomField *CustomFieldService
+	Job         *JobService
+	List        *ListService
+	Mail        *MailService
+	Suppression *SuppressionService
+	Template    *TemplateService
 }
 
 // Options can be used to create a customized client
@@ -32,6 +37,9 @@ type Options struct {
 	apiSecret string
 
 	debug bool
+
+	retry   RetryPolicy
+	limiter *rateLimiter
 }
 
 type service struct {
@@ -60,12 +68,33 @@ func WithDebug(v bool) Option {
 	}
 }
 
+// WithRetryPolicy configures how failed requests are retried
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(o *Options) error {
+		o.retry = p
+		return nil
+	}
+}
+
+// WithRateLimit throttles requests client side to perSecond requests, with
+// bursts of up to burst requests
+func WithRateLimit(perSecond float64, burst int) Option {
+	return func(o *Options) error {
+		if perSecond <= 0 {
+			return fmt.Errorf("rate limit must be positive, got %v", perSecond)
+		}
+		o.limiter = newRateLimiter(perSecond, burst)
+		return nil
+	}
+}
+
 func NewClient(httpClient *http.Client, options ...Option) (*Client, error) {
 	if httpClient == nil {
 		httpClient = http.DefaultClient
 	}
 
 	c := &Client{client: httpClient}
+	c.opts.retry = DefaultRetryPolicy
 	for _, opt := range options {
 		if err := opt(&c.opts); err != nil {
 			return nil, err
@@ -76,9 +105,14 @@ func NewClient(httpClient *http.Client, options ...Option) (*Client, error) {
 	c.common.client = c
 	c.common.opts = c.opts
 
+	c.AsmGroup = (*AsmGroupService)(&c.common)
 	c.Contact = (*ContactService)(&c.common)
+	c.CustomField = (*CustomFieldService)(&c.common)
+	c.Job = (*JobService)(&c.common)
 	c.List = (*ListService)(&c.common)
 	c.Mail = (*MailService)(&c.common)
+	c.Suppression = (*SuppressionService)(&c.common)
+	c.Template = (*TemplateService)(&c.common)
 
 	return c, nil
 }
@@ -106,8 +140,12 @@ func (c *Client) NewRequest(method, urlStr string, body interface{}) (*http.Requ
 
 	req, err := http.NewRequest(method, u.String(), buf)
 	defer func() {
-		if c.opts.debug {
+		if c.opts.debug && req != nil {
+			// keep the api key out of the logs
+			auth := req.Header.Get("Authorization")
+			req.Header.Set("Authorization", "BEARER <redacted>")
 			b, _ := httputil.DumpRequest(req, true)
+			req.Header.Set("Authorization", auth)
 			fmt.Printf("[sendgrid] %s", string(b))
 		}
 	}()
@@ -134,10 +172,42 @@ func (c *Client) NewRequest(method, urlStr string, body interface{}) (*http.Requ
 //
 // The provided ctx must be non-nil. If it is canceled or times out,
 // ctx.Err() will be returned.
-// TODO: Rate limiting
+//
+// Rate limited requests, and server errors and network failures of
+// idempotent requests, are retried according to the client's RetryPolicy,
+// and requests are throttled client side when the client is created
+// WithRateLimit.
 func (c *Client) Do(ctx context.Context, req *http.Request, v interface{}) (*http.Response, error) {
 	req = req.WithContext(ctx)
 
+	for attempt := 1; ; attempt++ {
+		if err := c.opts.limiter.wait(ctx); err != nil {
+			return nil, err
+		}
+
+		resp, err := c.do(ctx, req, v)
+		delay, retry := c.opts.retry.retryDelay(attempt, req.Method, resp, err)
+		if !retry || req.Body != nil && req.GetBody == nil {
+			return resp, err
+		}
+		if c.opts.debug {
+			fmt.Printf("[sendgrid] retrying in %s after attempt %d: %v\n", delay, attempt, err)
+		}
+		if err := sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+
+		// rewind the body for the next attempt
+		if req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// do sends a single attempt of the request
+func (c *Client) do(ctx context.Context, req *http.Request, v interface{}) (*http.Response, error) {
 	resp, err := c.client.Do(req)
 	if err != nil {
 		// If we got an error, and the context has been canceled,
@@ -179,59 +249,3 @@ func (c *Client) Do(ctx context.Context, req *http.Request, v interface{}) (*htt
 
 	return resp, err
 }
-
-type ErrorResponse struct {
-	Response *http.Response // HTTP response that caused this error
-	Errors   []*Error       `json:"errors,omitempty"`
-}
-
-type Error struct {
-	Field   string `json:"field"`
-	Message string `json:"message"`
-	ErrorID string `json:"error_id"`
-}
-
-func (r *ErrorResponse) Error() string {
-	return fmt.Sprintf("[%v] %v: %d | (1/%d) %s",
-		r.Response.Request.Method,
-		sanitizeURL(r.Response.Request.URL),
-		r.Response.StatusCode,
-		len(r.Errors),
-		r.Errors[0].Message,
-	)
-}
-
-// sanitizeURL redacts the client_secret parameter from the URL which may be
-// exposed to the user.
-func sanitizeURL(uri *url.URL) *url.URL {
-	if uri == nil {
-		return nil
-	}
-	params := uri.Query()
-	if len(params.Get("client_secret")) > 0 {
-		params.Set("client_secret", "REDACTED")
-		uri.RawQuery = params.Encode()
-	}
-	return uri
-}
-
-// CheckResponse checks the API response for errors, and returns them if
-// present. A response is considered an error if it has a status code outside
-// the 200 range or equal to 202 Accepted.
-// API error responses are expected to have response
-// body, and a JSON response body that maps to ErrorResponse.
-//
-// The error type will be *RateLimitError for rate limit exceeded errors,
-// *AcceptedError for 202 Accepted status codes,
-// and *TwoFactorAuthError for two-factor authentication errors.
-func CheckResponse(r *http.Response) error {
-	if c := r.StatusCode; 200 <= c && c <= 299 {
-		return nil
-	}
-	errorResponse := &ErrorResponse{Response: r}
-	data, err := io.ReadAll(r.Body)
-	if err == nil && data != nil {
-		json.Unmarshal(data, errorResponse)
-	}
-	return errorResponse
-}
@@ -0,0 +1,145 @@
+package sendgrid
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// SuppressionService manages global unsubscribes, bounces, blocks and spam
+// reports. Bounces, blocks and spam reports are recorded by SendGrid and can
+// only be listed and deleted.
+type SuppressionService service
+
+// Suppression lists
+const (
+	SuppressionUnsubscribes = "unsubscribes"
+	SuppressionBounces      = "bounces"
+	SuppressionBlocks       = "blocks"
+	SuppressionSpamReports  = "spam_reports"
+)
+
+// Documentation: https://docs.sendgrid.com/api-reference/suppressions-global-suppressions
+type Suppression struct {
+	Email   string `json:"email"`
+	Created int64  `json:"created"`
+	Reason  string `json:"reason,omitempty"`
+	Status  string `json:"status,omitempty"`
+	IP      string `json:"ip,omitempty"`
+}
+
+// SuppressionListOptions filters and paginates a suppression list
+type SuppressionListOptions struct {
+	StartTime time.Time
+	EndTime   time.Time
+	Limit     int
+	Offset    int
+}
+
+func (o *SuppressionListOptions) values() url.Values {
+	q := url.Values{}
+	if o == nil {
+		return q
+	}
+	if !o.StartTime.IsZero() {
+		q.Set("start_time", strconv.FormatInt(o.StartTime.Unix(), 10))
+	}
+	if !o.EndTime.IsZero() {
+		q.Set("end_time", strconv.FormatInt(o.EndTime.Unix(), 10))
+	}
+	if o.Limit > 0 {
+		q.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.Offset > 0 {
+		q.Set("offset", strconv.Itoa(o.Offset))
+	}
+	return q
+}
+
+// List fetches a page of the unsubscribes, bounces, blocks or spam_reports
+// suppression list
+func (s *SuppressionService) List(ctx context.Context, list string, opts *SuppressionListOptions) ([]*Suppression, *http.Response, error) {
+	u := "suppression/" + url.PathEscape(list)
+	if q := opts.values(); len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	req, err := s.client.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var suppressions []*Suppression
+	resp, err := s.client.Do(ctx, req, &suppressions)
+	if err != nil {
+		return nil, resp, err
+	}
+	return suppressions, resp, nil
+}
+
+// Get returns the entries of the email on the bounces, blocks or
+// spam_reports list, empty when it is not suppressed
+func (s *SuppressionService) Get(ctx context.Context, list, email string) ([]*Suppression, *http.Response, error) {
+	u := "suppression/" + url.PathEscape(list) + "/" + url.PathEscape(email)
+	req, err := s.client.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var suppressions []*Suppression
+	resp, err := s.client.Do(ctx, req, &suppressions)
+	if err != nil {
+		return nil, resp, err
+	}
+	return suppressions, resp, nil
+}
+
+// Delete removes the emails from the bounces, blocks or spam_reports list
+func (s *SuppressionService) Delete(ctx context.Context, list string, emails ...string) (*http.Response, error) {
+	body := struct {
+		Emails []string `json:"emails"`
+	}{emails}
+	req, err := s.client.NewRequest("DELETE", "suppression/"+url.PathEscape(list), body)
+	if err != nil {
+		return nil, err
+	}
+	return s.client.Do(ctx, req, nil)
+}
+
+// AddGlobalUnsubscribes unsubscribes the emails from every email sent with
+// an unsubscribe group or subscription tracking
+func (s *SuppressionService) AddGlobalUnsubscribes(ctx context.Context, emails ...string) (*http.Response, error) {
+	req, err := s.client.NewRequest("POST", "asm/suppressions/global", recipientEmails{RecipientEmails: emails})
+	if err != nil {
+		return nil, err
+	}
+	return s.client.Do(ctx, req, nil)
+}
+
+// IsGloballyUnsubscribed reports whether the email is globally unsubscribed
+func (s *SuppressionService) IsGloballyUnsubscribed(ctx context.Context, email string) (bool, *http.Response, error) {
+	req, err := s.client.NewRequest("GET", "asm/suppressions/global/"+url.PathEscape(email), nil)
+	if err != nil {
+		return false, nil, err
+	}
+
+	// an empty object when the email is not unsubscribed
+	result := struct {
+		RecipientEmail string `json:"recipient_email"`
+	}{}
+	resp, err := s.client.Do(ctx, req, &result)
+	if err != nil {
+		return false, resp, err
+	}
+	return result.RecipientEmail != "", resp, nil
+}
+
+// DeleteGlobalUnsubscribe resubscribes the email globally
+func (s *SuppressionService) DeleteGlobalUnsubscribe(ctx context.Context, email string) (*http.Response, error) {
+	req, err := s.client.NewRequest("DELETE", "asm/suppressions/global/"+url.PathEscape(email), nil)
+	if err != nil {
+		return nil, err
+	}
+	return s.client.Do(ctx, req, nil)
+}
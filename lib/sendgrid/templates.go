@@ -0,0 +1,247 @@
+package sendgrid
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+type TemplateService service
+
+const (
+	TemplateGenerationLegacy  = "legacy"
+	TemplateGenerationDynamic = "dynamic"
+
+	// the templates endpoint requires a page size, up to 200
+	maxTemplatePageSize = 200
+)
+
+// Documentation: https://docs.sendgrid.com/api-reference/transactional-templates
+type Template struct {
+	ID         string             `json:"id,omitempty"`
+	Name       string             `json:"name"`
+	Generation string             `json:"generation,omitempty"`
+	UpdatedAt  string             `json:"updated_at,omitempty"`
+	Versions   []*TemplateVersion `json:"versions,omitempty"`
+}
+
+type TemplateVersion struct {
+	ID                   string `json:"id,omitempty"`
+	TemplateID           string `json:"template_id,omitempty"`
+	Active               int    `json:"active"`
+	Name                 string `json:"name"`
+	Subject              string `json:"subject"`
+	HTMLContent          string `json:"html_content,omitempty"`
+	PlainContent         string `json:"plain_content,omitempty"`
+	GeneratePlainContent bool   `json:"generate_plain_content"`
+	Editor               string `json:"editor,omitempty"`
+	// json encoded sample data used to preview the template in the UI
+	TestData  string `json:"test_data,omitempty"`
+	UpdatedAt string `json:"updated_at,omitempty"`
+}
+
+// TemplateListOptions filters and paginates the template list
+type TemplateListOptions struct {
+	// legacy, dynamic or both comma separated, defaults to legacy
+	Generations string
+	ListOptions
+}
+
+// TemplatePage is a page of templates
+type TemplatePage struct {
+	Result   []*Template  `json:"result"`
+	Metadata PageMetadata `json:"_metadata"`
+}
+
+// ActiveVersion returns the live version of the template, or nil
+func (t *Template) ActiveVersion() *TemplateVersion {
+	for _, v := range t.Versions {
+		if v.Active == 1 {
+			return v
+		}
+	}
+	return nil
+}
+
+func (o *TemplateListOptions) values() url.Values {
+	if o == nil {
+		o = &TemplateListOptions{}
+	}
+	q := o.ListOptions.values()
+	if o.PageSize == 0 {
+		q.Set("page_size", strconv.Itoa(maxTemplatePageSize))
+	}
+	if o.Generations != "" {
+		q.Set("generations", o.Generations)
+	}
+	return q
+}
+
+// Create creates a new dynamic template
+func (s *TemplateService) Create(ctx context.Context, name string) (*Template, *http.Response, error) {
+	req, err := s.client.NewRequest("POST", "templates", Template{
+		Name:       name,
+		Generation: TemplateGenerationDynamic,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := &Template{}
+	resp, err := s.client.Do(ctx, req, template)
+	if err != nil {
+		return nil, resp, err
+	}
+	return template, resp, nil
+}
+
+// List fetches a page of templates
+func (s *TemplateService) List(ctx context.Context, opts *TemplateListOptions) (*TemplatePage, *http.Response, error) {
+	req, err := s.client.NewRequest("GET", "templates?"+opts.values().Encode(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	page := &TemplatePage{}
+	resp, err := s.client.Do(ctx, req, page)
+	if err != nil {
+		return nil, resp, err
+	}
+	return page, resp, nil
+}
+
+// ListAll fetches every dynamic template, following the page tokens
+func (s *TemplateService) ListAll(ctx context.Context) ([]*Template, error) {
+	var (
+		templates []*Template
+		opts      = &TemplateListOptions{Generations: TemplateGenerationDynamic}
+	)
+	for {
+		page, _, err := s.List(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, page.Result...)
+
+		opts.PageToken = page.Metadata.NextPageToken()
+		if opts.PageToken == "" {
+			return templates, nil
+		}
+	}
+}
+
+// Get fetches a template with all its versions
+func (s *TemplateService) Get(ctx context.Context, templateID string) (*Template, *http.Response, error) {
+	req, err := s.client.NewRequest("GET", "templates/"+url.PathEscape(templateID), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := &Template{}
+	resp, err := s.client.Do(ctx, req, template)
+	if err != nil {
+		return nil, resp, err
+	}
+	return template, resp, nil
+}
+
+// Update renames a template
+func (s *TemplateService) Update(ctx context.Context, templateID, name string) (*Template, *http.Response, error) {
+	req, err := s.client.NewRequest("PATCH", "templates/"+url.PathEscape(templateID), Template{Name: name})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := &Template{}
+	resp, err := s.client.Do(ctx, req, template)
+	if err != nil {
+		return nil, resp, err
+	}
+	return template, resp, nil
+}
+
+// Delete deletes a template and all its versions
+func (s *TemplateService) Delete(ctx context.Context, templateID string) (*http.Response, error) {
+	req, err := s.client.NewRequest("DELETE", "templates/"+url.PathEscape(templateID), nil)
+	if err != nil {
+		return nil, err
+	}
+	return s.client.Do(ctx, req, nil)
+}
+
+// CreateVersion adds a version to the template, it becomes the live
+// version when v.Active is 1
+func (s *TemplateService) CreateVersion(ctx context.Context, templateID string, v *TemplateVersion) (*TemplateVersion, *http.Response, error) {
+	u := fmt.Sprintf("templates/%s/versions", url.PathEscape(templateID))
+	req, err := s.client.NewRequest("POST", u, v)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	version := &TemplateVersion{}
+	resp, err := s.client.Do(ctx, req, version)
+	if err != nil {
+		return nil, resp, err
+	}
+	return version, resp, nil
+}
+
+// GetVersion fetches a version of the template
+func (s *TemplateService) GetVersion(ctx context.Context, templateID, versionID string) (*TemplateVersion, *http.Response, error) {
+	u := fmt.Sprintf("templates/%s/versions/%s", url.PathEscape(templateID), url.PathEscape(versionID))
+	req, err := s.client.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	version := &TemplateVersion{}
+	resp, err := s.client.Do(ctx, req, version)
+	if err != nil {
+		return nil, resp, err
+	}
+	return version, resp, nil
+}
+
+// UpdateVersion edits a version of the template in place
+func (s *TemplateService) UpdateVersion(ctx context.Context, templateID, versionID string, v *TemplateVersion) (*TemplateVersion, *http.Response, error) {
+	u := fmt.Sprintf("templates/%s/versions/%s", url.PathEscape(templateID), url.PathEscape(versionID))
+	req, err := s.client.NewRequest("PATCH", u, v)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	version := &TemplateVersion{}
+	resp, err := s.client.Do(ctx, req, version)
+	if err != nil {
+		return nil, resp, err
+	}
+	return version, resp, nil
+}
+
+// ActivateVersion makes the version the live version of the template
+func (s *TemplateService) ActivateVersion(ctx context.Context, templateID, versionID string) (*TemplateVersion, *http.Response, error) {
+	u := fmt.Sprintf("templates/%s/versions/%s/activate", url.PathEscape(templateID), url.PathEscape(versionID))
+	req, err := s.client.NewRequest("POST", u, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	version := &TemplateVersion{}
+	resp, err := s.client.Do(ctx, req, version)
+	if err != nil {
+		return nil, resp, err
+	}
+	return version, resp, nil
+}
+
+// DeleteVersion deletes a version of the template
+func (s *TemplateService) DeleteVersion(ctx context.Context, templateID, versionID string) (*http.Response, error) {
+	u := fmt.Sprintf("templates/%s/versions/%s", url.PathEscape(templateID), url.PathEscape(versionID))
+	req, err := s.client.NewRequest("DELETE", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	return s.client.Do(ctx, req, nil)
+}
@@ -0,0 +1,128 @@
+package token
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type claims struct {
+	Email  string `json:"email"`
+	Expiry int64  `json:"exp,omitempty"`
+}
+
+func (c *claims) ExpiresAt() time.Time {
+	if c.Expiry == 0 {
+		return time.Time{}
+	}
+	return time.Unix(c.Expiry, 0)
+}
+
+// codec is Sign and Verify or Seal and Open
+type codec struct {
+	name   string
+	encode func(claims interface{}, secret string) (string, error)
+	decode func(token, secret string, v interface{}) error
+}
+
+var codecs = []codec{
+	{"signed", Sign, Verify},
+	{"sealed", Seal, Open},
+}
+
+// flip changes one character of the token
+func flip(tok string, i int) string {
+	b := []byte(tok)
+	if b[i] == 'A' {
+		b[i] = 'B'
+	} else {
+		b[i] = 'A'
+	}
+	return string(b)
+}
+
+func TestRoundTrip(t *testing.T) {
+	valid := &claims{Email: "ada@example.com", Expiry: time.Now().Add(time.Hour).Unix()}
+	expired := &claims{Email: "ada@example.com", Expiry: time.Now().Add(-time.Minute).Unix()}
+
+	for _, c := range codecs {
+		t.Run(c.name, func(t *testing.T) {
+			tok, err := c.encode(valid, "s3cret")
+			if err != nil {
+				t.Fatal(err)
+			}
+			old, _ := c.encode(expired, "s3cret")
+			forever, _ := c.encode(&claims{Email: "ada@example.com"}, "s3cret")
+
+			tests := []struct {
+				name   string
+				token  string
+				secret string
+				want   error
+			}{
+				{"valid", tok, "s3cret", nil},
+				{"no expiry", forever, "s3cret", nil},
+				{"expired", old, "s3cret", ErrExpired},
+				{"other secret", tok, "other", ErrInvalidSignature},
+				{"tampered", flip(tok, 5), "s3cret", ErrInvalidSignature},
+				{"truncated", tok[:10], "s3cret", ErrMalformed},
+				{"not base64", "!!!", "s3cret", ErrMalformed},
+				{"empty", "", "s3cret", ErrMalformed},
+				{"no secret", tok, "", ErrNoSecret},
+			}
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					var got claims
+					err := c.decode(tt.token, tt.secret, &got)
+					if !errors.Is(err, tt.want) {
+						t.Fatalf("got %v, want %v", err, tt.want)
+					}
+					if err == nil && got.Email != "ada@example.com" {
+						t.Errorf("decoded %+v", got)
+					}
+				})
+			}
+
+			if _, err := c.encode(valid, ""); !errors.Is(err, ErrNoSecret) {
+				t.Errorf("encoding without a secret: got %v, want ErrNoSecret", err)
+			}
+		})
+	}
+}
+
+func TestSealHidesClaims(t *testing.T) {
+	c := &claims{Email: "ada@example.com"}
+	a, _ := Seal(c, "s3cret")
+	b, _ := Seal(c, "s3cret")
+	if a == b {
+		t.Error("sealing twice gave the same token, nonces are reused")
+	}
+	raw, _ := base64.RawURLEncoding.DecodeString(a)
+	if strings.Contains(string(raw), "ada@example.com") {
+		t.Error("the sealed token carries the claims in plaintext")
+	}
+	if strings.Contains(a, ".") {
+		t.Error("sealed tokens must not look like signed ones")
+	}
+
+	signed, _ := Sign(c, "s3cret")
+	payload, _, _ := strings.Cut(signed, ".")
+	raw, _ = base64.RawURLEncoding.DecodeString(payload)
+	if !strings.Contains(string(raw), "ada@example.com") {
+		t.Error("signed token payload is not the claims")
+	}
+}
+
+func TestID(t *testing.T) {
+	if ID("a") != ID("a") {
+		t.Error("ID is not stable")
+	}
+	if ID("a") == ID("b") {
+		t.Error("ID collides")
+	}
+	if strings.ContainsAny(ID("a"), "/+=") {
+		t.Errorf("ID %q is not url and document id safe", ID("a"))
+	}
+}
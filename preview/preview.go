@@ -0,0 +1,116 @@
+package preview
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/500k-agency/function/lib/handlebars"
+	"github.com/500k-agency/function/product"
+	"github.com/stripe/stripe-go/v76"
+)
+
+const (
+	DefaultTemplate = "purchase_thankyou"
+	DefaultFixture  = "checkout_session.json"
+
+	templateExt = ".handlebars"
+)
+
+// Email is a rendered thank you email
+type Email struct {
+	ProductName string
+	HTML        string
+}
+
+// ReadSession reads a fixture checkout session, either the session object
+// itself or a checkout.session.completed event wrapping it. line_items must
+// be expanded.
+func ReadSession(file string) (stripe.CheckoutSession, error) {
+	var session stripe.CheckoutSession
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return session, err
+	}
+
+	var event struct {
+		Object string `json:"object"`
+		Data   struct {
+			Object json.RawMessage `json:"object"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(b, &event); err != nil {
+		return session, fmt.Errorf("%s: %w", file, err)
+	}
+	if event.Object == "event" {
+		b = event.Data.Object
+	}
+	if err := json.Unmarshal(b, &session); err != nil {
+		return session, fmt.Errorf("%s: %w", file, err)
+	}
+	return session, nil
+}
+
+// PurchaseThankyou renders templates/<name>.handlebars with the template data
+// HandlePaymentCheckoutSession sends for every product of the session
+func PurchaseThankyou(templatesDir, name string, session stripe.CheckoutSession) ([]Email, error) {
+	src, err := os.ReadFile(filepath.Join(templatesDir, name+templateExt))
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := handlebars.Parse(string(src))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	purchases, err := product.PreviewPurchase(session)
+	if err != nil {
+		return nil, err
+	}
+	emails := make([]Email, 0, len(purchases))
+	for _, p := range purchases {
+		html, err := tmpl.Render(p.TemplateData)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		emails = append(emails, Email{ProductName: p.Product.Name, HTML: html})
+	}
+	return emails, nil
+}
+
+// Handler serves the rendered emails of a fixture session, for local runs
+// only. ?session= picks the fixture file and ?template= the template.
+func Handler(templatesDir, fixturesDir string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		fixture := filepath.Base(q.Get("session"))
+		if fixture == "." {
+			fixture = DefaultFixture
+		}
+		name := filepath.Base(q.Get("template"))
+		if name == "." {
+			name = DefaultTemplate
+		}
+
+		session, err := ReadSession(filepath.Join(fixturesDir, fixture))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		emails, err := PurchaseThankyou(templatesDir, name, session)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+
+		parts := make([]string, len(emails))
+		for i, e := range emails {
+			parts[i] = e.HTML
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, strings.Join(parts, "\n<hr>\n"))
+	}
+}
@@ -0,0 +1,114 @@
+package preview
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/500k-agency/function/product"
+)
+
+const (
+	templatesDir = "../templates"
+	fixturesDir  = "../fixtures"
+)
+
+func setupProducts(t *testing.T) {
+	t.Helper()
+	confs := []product.Config{{Name: "The Guide", StripeID: "prod_replace_me", URL: "https://example.com/guide.pdf"}}
+	if err := product.Setup(confs, product.SenderConfig{FromEmail: "hi@example.com", FromName: "Hi"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { product.Setup(nil, product.SenderConfig{FromEmail: "hi@example.com"}, nil) })
+}
+
+// writeFixture writes the file into a temporary fixtures directory
+func writeFixture(t *testing.T, name, content string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestReadSession(t *testing.T) {
+	session, err := ReadSession(filepath.Join(fixturesDir, DefaultFixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.ID != "cs_test_preview" || session.CustomerDetails.Email != "jane@example.com" || len(session.LineItems.Data) != 1 {
+		t.Errorf("read %+v", session)
+	}
+
+	event := writeFixture(t, "event.json", `{"object":"event","type":"checkout.session.completed","data":{"object":{"id":"cs_1","object":"checkout.session"}}}`)
+	if session, err := ReadSession(filepath.Join(event, "event.json")); err != nil || session.ID != "cs_1" {
+		t.Errorf("event fixture: %v %q", err, session.ID)
+	}
+
+	broken := writeFixture(t, "broken.json", `{"id":`)
+	if _, err := ReadSession(filepath.Join(broken, "broken.json")); err == nil {
+		t.Error("read a broken fixture")
+	}
+}
+
+func TestPurchaseThankyou(t *testing.T) {
+	setupProducts(t)
+	session, err := ReadSession(filepath.Join(fixturesDir, DefaultFixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	emails, err := PurchaseThankyou(templatesDir, DefaultTemplate, session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(emails) != 1 || emails[0].ProductName != "The Guide" {
+		t.Fatalf("rendered %+v", emails)
+	}
+	for _, want := range []string{"Hi Jane!", "Thank you for purchasing The Guide!", "https://example.com/guide.pdf"} {
+		if !strings.Contains(emails[0].HTML, want) {
+			t.Errorf("email is missing %q", want)
+		}
+	}
+
+	if _, err := PurchaseThankyou(templatesDir, "missing", session); err == nil {
+		t.Error("rendered a missing template")
+	}
+	product.Setup(nil, product.SenderConfig{FromEmail: "hi@example.com"}, nil)
+	if _, err := PurchaseThankyou(templatesDir, DefaultTemplate, session); err == nil {
+		t.Error("rendered an unknown product")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	setupProducts(t)
+	h := Handler(templatesDir, fixturesDir)
+
+	tests := []struct {
+		name  string
+		query string
+		code  int
+	}{
+		{"defaults", "", http.StatusOK},
+		{"named", "?session=checkout_session.json&template=purchase_thankyou", http.StatusOK},
+		{"fixture outside the directory", "?session=../go.mod", http.StatusBadRequest},
+		{"missing fixture", "?session=nope.json", http.StatusBadRequest},
+		{"missing template", "?template=nope", http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h(rec, httptest.NewRequest(http.MethodGet, "/"+tt.query, nil))
+			if rec.Code != tt.code {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.code, rec.Body.String())
+			}
+			if tt.code == http.StatusOK && !strings.Contains(rec.Body.String(), "The Guide") {
+				t.Errorf("body %s", rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package product
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/stripe/stripe-go/v76"
+)
+
+// currencies whose stripe amounts are not in hundredths of the major unit,
+// see https://docs.stripe.com/currencies#zero-decimal
+var currencyDecimals = map[stripe.Currency]int{
+	"bif": 0, "clp": 0, "djf": 0, "gnf": 0, "jpy": 0, "kmf": 0, "krw": 0, "mga": 0,
+	"pyg": 0, "rwf": 0, "ugx": 0, "vnd": 0, "vuv": 0, "xaf": 0, "xof": 0, "xpf": 0,
+	"bhd": 3, "jod": 3, "kwd": 3, "omr": 3, "tnd": 3,
+}
+
+// decimals returns the number of decimals of the currency's stripe amounts
+func decimals(currency stripe.Currency) int {
+	if d, ok := currencyDecimals[stripe.Currency(strings.ToLower(string(currency)))]; ok {
+		return d
+	}
+	return 2
+}
+
+// majorAmount converts an amount in the currency's minor unit to the major
+// unit, ie. 1250 usd is 12.50 and 1250 jpy is 1250
+func majorAmount(amount int64, currency stripe.Currency) float64 {
+	return float64(amount) / math.Pow10(decimals(currency))
+}
+
+// formatAmount formats an amount in the currency's minor unit, ie. 1250 usd
+// is "12.50 USD" and 1250 jpy is "1250 JPY"
+func formatAmount(amount int64, currency stripe.Currency) string {
+	return fmt.Sprintf("%.*f %s", decimals(currency), majorAmount(amount, currency), strings.ToUpper(string(currency)))
+}
@@ -0,0 +1,37 @@
+package product
+
+import (
+	"testing"
+
+	"github.com/stripe/stripe-go/v76"
+)
+
+func TestAmounts(t *testing.T) {
+	tests := []struct {
+		amount    int64
+		currency  stripe.Currency
+		wantMajor float64
+		wantText  string
+	}{
+		{1250, "usd", 12.5, "12.50 USD"},
+		{5, "eur", 0.05, "0.05 EUR"},
+		{0, "gbp", 0, "0.00 GBP"},
+		{-1250, "usd", -12.5, "-12.50 USD"},
+		{1250, "jpy", 1250, "1250 JPY"},
+		{1250, "JPY", 1250, "1250 JPY"},
+		{50000, "krw", 50000, "50000 KRW"},
+		{1250, "kwd", 1.25, "1.250 KWD"},
+		{5, "bhd", 0.005, "0.005 BHD"},
+		{1250, "", 12.5, "12.50 "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.wantText, func(t *testing.T) {
+			if got := majorAmount(tt.amount, tt.currency); got != tt.wantMajor {
+				t.Errorf("majorAmount(%d, %s) = %v, want %v", tt.amount, tt.currency, got, tt.wantMajor)
+			}
+			if got := formatAmount(tt.amount, tt.currency); got != tt.wantText {
+				t.Errorf("formatAmount(%d, %s) = %q, want %q", tt.amount, tt.currency, got, tt.wantText)
+			}
+		})
+	}
+}
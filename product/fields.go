@@ -0,0 +1,99 @@
+package product
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/500k-agency/function/lib/connect"
+	"github.com/500k-agency/function/lib/sendgrid"
+	"github.com/stripe/stripe-go/v76"
+)
+
+// ContactFieldsConfig maps the purchase data onto sendgrid custom fields of
+// the purchaser. Values are custom field names, leave one empty to skip it.
+type ContactFieldsConfig struct {
+	// Text, comma separated stripe ids of every product the contact bought
+	ProductIDs string `toml:"product_ids"`
+	// Number, amount_total of the latest purchase in the currency's major unit
+	AmountTotal string `toml:"amount_total"`
+	// Text, currency of the latest purchase, ie. usd
+	Currency string `toml:"currency"`
+	// Text, billing country code of the latest purchase
+	Country string `toml:"country"`
+	// Date, of the latest purchase
+	PurchasedAt string `toml:"purchased_at"`
+}
+
+var contactFields ContactFieldsConfig
+
+func SetupContactFields(conf ContactFieldsConfig) {
+	contactFields = conf
+}
+
+// Definitions lists the configured custom fields and their types
+func (c ContactFieldsConfig) Definitions() []sendgrid.FieldDefinition {
+	var defs []sendgrid.FieldDefinition
+	for _, f := range []sendgrid.FieldDefinition{
+		{Name: c.ProductIDs, FieldType: sendgrid.FieldTypeText},
+		{Name: c.AmountTotal, FieldType: sendgrid.FieldTypeNumber},
+		{Name: c.Currency, FieldType: sendgrid.FieldTypeText},
+		{Name: c.Country, FieldType: sendgrid.FieldTypeText},
+		{Name: c.PurchasedAt, FieldType: sendgrid.FieldTypeDate},
+	} {
+		if f.Name != "" {
+			defs = append(defs, f)
+		}
+	}
+	return defs
+}
+
+// purchaseCustomFields maps the session onto the configured custom fields,
+// keyed by field name. The products bought are added to the ones already on
+// the contact, so earlier purchases are kept.
+func purchaseCustomFields(ctx context.Context, session stripe.CheckoutSession, productIDs []string) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+	if f := contactFields.ProductIDs; f != "" {
+		contact, err := connect.Contacts.GetContact(ctx, session.CustomerDetails.Email)
+		if err != nil {
+			return nil, err
+		}
+		if contact != nil {
+			if v, ok := contact.CustomFields[f].(string); ok && v != "" {
+				productIDs = append(productIDs, strings.Split(v, ",")...)
+			}
+		}
+		fields[f] = joinUnique(productIDs)
+	}
+	if f := contactFields.AmountTotal; f != "" {
+		fields[f] = majorAmount(session.AmountTotal, session.Currency)
+	}
+	if f := contactFields.Currency; f != "" && session.Currency != "" {
+		fields[f] = string(session.Currency)
+	}
+	if f := contactFields.Country; f != "" && session.CustomerDetails.Address != nil && session.CustomerDetails.Address.Country != "" {
+		fields[f] = session.CustomerDetails.Address.Country
+	}
+	if f := contactFields.PurchasedAt; f != "" && session.Created != 0 {
+		fields[f] = time.Unix(session.Created, 0).UTC().Format(sendgrid.DateFieldLayout)
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	return fields, nil
+}
+
+// joinUnique joins the sorted, deduplicated values with commas
+func joinUnique(values []string) string {
+	seen := make(map[string]bool, len(values))
+	unique := make([]string, 0, len(values))
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" && !seen[v] {
+			seen[v] = true
+			unique = append(unique, v)
+		}
+	}
+	sort.Strings(unique)
+	return strings.Join(unique, ",")
+}
@@ -0,0 +1,58 @@
+package product
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/stripe/stripe-go/v76"
+)
+
+func TestPurchaseCustomFields(t *testing.T) {
+	SetupContactFields(ContactFieldsConfig{AmountTotal: "amount", Currency: "currency", Country: "country", PurchasedAt: "purchased_at"})
+	t.Cleanup(func() { SetupContactFields(ContactFieldsConfig{}) })
+
+	tests := []struct {
+		name    string
+		session stripe.CheckoutSession
+		want    map[string]interface{}
+	}{
+		{
+			name: "usd",
+			session: stripe.CheckoutSession{
+				AmountTotal:     1250,
+				Currency:        "usd",
+				Created:         1709647629,
+				CustomerDetails: &stripe.CheckoutSessionCustomerDetails{Address: &stripe.Address{Country: "NL"}},
+			},
+			want: map[string]interface{}{"amount": 12.5, "currency": "usd", "country": "NL", "purchased_at": "03/05/2024"},
+		},
+		{
+			name:    "zero decimal",
+			session: stripe.CheckoutSession{AmountTotal: 1250, Currency: "jpy", CustomerDetails: &stripe.CheckoutSessionCustomerDetails{}},
+			want:    map[string]interface{}{"amount": 1250.0, "currency": "jpy"},
+		},
+		{
+			name:    "three decimal",
+			session: stripe.CheckoutSession{AmountTotal: 1250, Currency: "kwd", CustomerDetails: &stripe.CheckoutSessionCustomerDetails{}},
+			want:    map[string]interface{}{"amount": 1.25, "currency": "kwd"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := purchaseCustomFields(context.Background(), tt.session, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJoinUnique(t *testing.T) {
+	if got := joinUnique([]string{"prod_2", " prod_1", "", "prod_2"}); got != "prod_1,prod_2" {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,38 @@
+package product
+
+import (
+	"github.com/500k-agency/function/lib/connect"
+)
+
+// newMessage builds a dynamic template email to a single recipient,
+// checking the template data against the schema of the template
+func newMessage(sender SenderConfig, to connect.Address, template, templateID string, templateData map[string]interface{}) (*connect.Message, error) {
+	if err := checkTemplateData(template, templateID, templateData); err != nil {
+		return nil, err
+	}
+
+	customArgs := make(map[string]string, len(sender.CustomArgs))
+	for k, v := range sender.CustomArgs {
+		customArgs[k] = v
+	}
+	m := &connect.Message{
+		From: connect.Address{
+			Email: sender.FromEmail,
+			Name:  sender.FromName,
+		},
+		To:                 []connect.Address{to},
+		TemplateID:         templateID,
+		TemplateData:       templateData,
+		Categories:         sender.Categories,
+		CustomArgs:         customArgs,
+		UnsubscribeGroupID: sender.AsmGroupID,
+		UnsubscribeGroups:  sender.AsmGroupsToDisplay,
+	}
+	if sender.ReplyToEmail != "" {
+		m.ReplyTo = &connect.Address{
+			Email: sender.ReplyToEmail,
+			Name:  sender.ReplyToName,
+		}
+	}
+	return m, nil
+}
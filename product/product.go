@@ -1,15 +1,43 @@
 package product
 
+import (
+	"fmt"
+
+	"github.com/500k-agency/function/data"
+	"github.com/500k-agency/function/delivery"
+)
+
 type Product struct {
 	Config
+
+	// sender resolved from the global, brand and product config
+	sender SenderConfig
 }
 
 // Config holds all the configuration fields needed within the application
 type Config struct {
-	Name             string      `toml:"name"`
-	StripeID         string      `toml:"stripe_id"`
-	URL              string      `toml:"url"`
+	Name     string `toml:"name"`
+	StripeID string `toml:"stripe_id"`
+	URL      string `toml:"url"`
+
+	// asset served through signed download links, defaults to url
+	AssetURL string `toml:"asset_url"`
+	// downloads allowed per signed link, overrides [delivery] max_downloads
+	MaxDownloads int `toml:"max_downloads"`
+	// attach the asset to the thank you email, ie. an epub or pdf
+	AttachAsset bool `toml:"attach_asset"`
+
+	// sender identity, inherits from the brand and global [sender]
+	Brand  string       `toml:"brand"`
+	Sender SenderConfig `toml:"sender"`
+
 	PurchaseThankyou EmailConfig `toml:"purchase_thankyou"`
+
+	// optional refund confirmation, leave template_id empty to skip
+	Refund EmailConfig `toml:"refund"`
+
+	// recurring products only
+	Subscription SubscriptionConfig `toml:"subscription"`
 }
 
 type EmailConfig struct {
@@ -17,16 +45,84 @@ type EmailConfig struct {
 	TemplateID string   `toml:"template_id"`
 }
 
+// SubscriptionConfig holds the lists and lifecycle emails of a recurring product
+type SubscriptionConfig struct {
+	// lists the subscriber belongs to while the subscription is in good standing
+	ListIDs []string `toml:"list_ids"`
+
+	Welcome      EmailConfig `toml:"welcome"`
+	Dunning      EmailConfig `toml:"dunning"`
+	Cancellation EmailConfig `toml:"cancellation"`
+
+	// billing portal return url linked from dunning emails, defaults to
+	// the stripe connect return_url
+	ReturnURL string `toml:"return_url"`
+}
+
+// OperatorConfig holds the internal address notified about disputes
+type OperatorConfig struct {
+	Email             string `toml:"email"`
+	Name              string `toml:"name"`
+	DisputeTemplateID string `toml:"dispute_template_id"`
+}
+
 var (
 	productCatalogue = map[string]Product{}
+
+	operator OperatorConfig
+
+	// global sender, used for emails not tied to a product
+	defaultSender SenderConfig
 )
 
-func Setup(confs []Config) {
+// Setup loads the product catalogue, resolving and validating the sender
+// identity of every product
+func Setup(confs []Config, sender SenderConfig, brands []BrandConfig) error {
+	if sender.FromEmail == "" {
+		sender = legacySender.Merge(sender)
+	}
+
+	brandsByID := make(map[string]BrandConfig, len(brands))
+	for _, b := range brands {
+		if _, ok := brandsByID[b.ID]; ok {
+			return fmt.Errorf("brands: %w %q", ErrDuplicateBrand, b.ID)
+		}
+		brandsByID[b.ID] = b
+	}
+
+	catalogue := make(map[string]Product, len(confs))
 	for _, v := range confs {
-		productCatalogue[v.StripeID] = Product{
+		resolved, err := resolveSender(sender, brandsByID, v)
+		if err != nil {
+			return fmt.Errorf("product %q sender: %w", v.Name, err)
+		}
+		catalogue[v.StripeID] = Product{
 			Config: v,
+			sender: resolved,
 		}
 	}
+
+	productCatalogue = catalogue
+	defaultSender = sender
+	return nil
+}
+
+func SetupOperator(conf OperatorConfig) {
+	operator = conf
+}
+
+// DownloadURL returns the url the purchaser receives for the product, a
+// signed per customer link when delivery is configured
+func (p Product) DownloadURL(sessionID, email string) (string, error) {
+	if !delivery.Enabled() {
+		return p.URL, nil
+	}
+	return delivery.IssueURL(sessionID, email, p.StripeID, p.MaxDownloads)
+}
+
+// Asset returns the url of the file served by signed download links
+func (p Product) Asset() string {
+	return data.Coalesce(p.AssetURL, p.URL)
 }
 
 func GetProductByID(productId string) Product {
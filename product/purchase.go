@@ -4,10 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
 
 	"github.com/500k-agency/function/data"
+	"github.com/500k-agency/function/delivery"
 	"github.com/500k-agency/function/lib/connect"
-	"github.com/500k-agency/function/lib/sendgrid"
+	"github.com/500k-agency/function/lib/eventstore"
 	"github.com/stripe/stripe-go/v76"
 )
 
@@ -15,6 +17,16 @@ var (
 	ErrSessionUnpaid = errors.New("session unpaid")
 )
 
+// attachments are base64 encoded, which grows them by a third, and have to
+// fit sendgrid's 30MB message limit
+const maxAttachmentBytes = 20 << 20
+
+// custom args of purchase emails, echoed back by the SendGrid event webhook
+const (
+	CustomArgSessionID = "session_id"
+	CustomArgProductID = "product_id"
+)
+
 func HandlePaymentCheckoutSession(ctx context.Context, session stripe.CheckoutSession) error {
 	// if checkout is successful, send payment confirmation
 	if session.PaymentStatus != stripe.CheckoutSessionPaymentStatusPaid {
@@ -25,57 +37,179 @@ func HandlePaymentCheckoutSession(ctx context.Context, session stripe.CheckoutSe
 	var errs []error
 
 	// fetch the checkout item list
-	items := connect.StripeClient.GetSessionItems(session.ID)
+	items, err := connect.StripeClient.GetSessionItems(session.ID)
+	if err != nil {
+		return fmt.Errorf("CheckoutSession %s line items: %w", session.ID, err)
+	}
+
+	productIDs := make([]string, 0, len(items))
 	for _, it := range items {
-		product := GetProductByID(it.Price.Product.ID)
-
-		contact := &sendgrid.ContactRequest{
-			ListIDs: product.PurchaseThankyou.ListIDs,
-			Contacts: []*sendgrid.Contact{
-				{
-					Email:     session.CustomerDetails.Email,
-					FirstName: name.FirstName,
-					LastName:  name.LastName,
-				},
-			},
-		}
+		productIDs = append(productIDs, it.Price.Product.ID)
+	}
+	customFields, err := purchaseCustomFields(ctx, session, productIDs)
+	if err != nil {
+		// still add the contact, without the purchase fields
+		log.Printf("CheckoutSession %s custom fields: %v\n", session.ID, err)
+	}
 
-		if err := connect.SendgridClient.AddContact(ctx, contact); err != nil {
+	for _, it := range items {
+		product, err := LookupProduct(it.Price.Product.ID)
+		if err != nil {
 			errs = append(errs, err)
+			continue
 		}
 
-		err := connect.SendgridClient.Send(ctx, &sendgrid.MailRequest{
-			Personalizations: []*sendgrid.MailPerson{
-				{
-					To: []*sendgrid.MailAddress{
-						{Email: session.CustomerDetails.Email},
-					},
-					DynamicTemplateData: map[string]interface{}{
-						"firstName":   name.FirstName,
-						"productName": product.Name,
-						"productUrl":  product.URL,
+		// each step is recorded once done, so a retry of the event after a
+		// partial failure only redoes the steps that failed and never emails
+		// a product twice
+		key := eventstore.Key("purchase", session.ID+":"+product.StripeID)
+		err = once(ctx, key+":contact", func() error {
+			return connect.Contacts.AddContact(ctx, &connect.ContactRequest{
+				ListIDs: product.PurchaseThankyou.ListIDs,
+				Contacts: []*connect.Contact{
+					{
+						Email:        session.CustomerDetails.Email,
+						FirstName:    name.FirstName,
+						LastName:     name.LastName,
+						CustomFields: customFields,
 					},
 				},
-			},
-			From: sendgrid.MailAddress{
-				Email: "noreply@spacestationlabs.ltd",
-				Name:  "Paul at Spacestation Labs",
-			},
-			ReplyTo: sendgrid.MailAddress{
-				Email: "paul@spacestationlabs.ltd",
-			},
-			TemplateID:   product.PurchaseThankyou.TemplateID,
-			MailSettings: &sendgrid.MailSettings{},
+			})
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		err = once(ctx, key+":email", func() error {
+			return sendPurchaseEmail(ctx, session, name, product)
 		})
 		if err != nil {
 			errs = append(errs, err)
 		}
 	}
 
-	var err error
-	for _, v := range errs {
-		err = fmt.Errorf("CheckoutSession: %+w", v)
-		break
+	return joinErrors("CheckoutSession", errs)
+}
+
+// sendPurchaseEmail sends the thank you email of the product
+func sendPurchaseEmail(ctx context.Context, session stripe.CheckoutSession, name data.Name, product Product) error {
+	productURL, err := product.DownloadURL(session.ID, session.CustomerDetails.Email)
+	if err != nil {
+		return err
+	}
+
+	req, err := newMessage(
+		product.sender,
+		connect.Address{Email: session.CustomerDetails.Email},
+		TemplatePurchaseThankyou,
+		product.PurchaseThankyou.TemplateID,
+		purchaseTemplateData(name, product, productURL),
+	)
+	if err != nil {
+		return err
+	}
+	req.CustomArgs[CustomArgSessionID] = session.ID
+	req.CustomArgs[CustomArgProductID] = product.StripeID
+	if product.AttachAsset {
+		attachment, err := attachAsset(ctx, product)
+		if err != nil {
+			return err
+		}
+		req.Attachments = append(req.Attachments, attachment)
+	}
+	return connect.Mail.Send(ctx, req)
+}
+
+// once runs fn unless it completed for an earlier delivery, recording the
+// outcome in the event store
+func once(ctx context.Context, key string, fn func() error) error {
+	store := eventstore.DefaultStore
+	if store == nil {
+		return fn()
+	}
+
+	err := store.Begin(ctx, key)
+	if errors.Is(err, eventstore.ErrAlreadyProcessed) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+
+	if err := fn(); err != nil {
+		if ferr := store.Fail(ctx, key, err); ferr != nil {
+			log.Printf("eventstore.Fail %s: %v\n", key, ferr)
+		}
+		return err
+	}
+	if err := store.Complete(ctx, key); err != nil {
+		log.Printf("eventstore.Complete %s: %v\n", key, err)
+	}
+	return nil
+}
+
+// purchaseTemplateData is the dynamic template data of the thank you email
+func purchaseTemplateData(name data.Name, product Product, productURL string) map[string]interface{} {
+	return map[string]interface{}{
+		"firstName":   name.FirstName,
+		"productName": product.Name,
+		"productUrl":  productURL,
+	}
+}
+
+// PurchaseEmail is the thank you email of a product bought in a checkout
+// session
+type PurchaseEmail struct {
+	Product      Product
+	TemplateData map[string]interface{}
+}
+
+// PreviewPurchase returns the thank you emails HandlePaymentCheckoutSession
+// would send for the session, without sending anything. The line items are
+// read from the session's expanded line_items instead of fetched from Stripe.
+func PreviewPurchase(session stripe.CheckoutSession) ([]PurchaseEmail, error) {
+	if session.CustomerDetails == nil {
+		return nil, errors.New("session has no customer_details")
+	}
+	if session.LineItems == nil || len(session.LineItems.Data) == 0 {
+		return nil, errors.New("session has no line_items")
+	}
+
+	name := data.SplitName(session.CustomerDetails.Name)
+	var emails []PurchaseEmail
+	for _, it := range session.LineItems.Data {
+		if it.Price == nil || it.Price.Product == nil {
+			return nil, errors.New("line item has no price.product")
+		}
+		product, err := LookupProduct(it.Price.Product.ID)
+		if err != nil {
+			return nil, err
+		}
+		productURL, err := product.DownloadURL(session.ID, session.CustomerDetails.Email)
+		if err != nil {
+			return nil, err
+		}
+		templateData := purchaseTemplateData(name, product, productURL)
+		if err := templateSchemas[TemplatePurchaseThankyou].Check(templateData); err != nil {
+			return nil, fmt.Errorf("%s: %w: %w", TemplatePurchaseThankyou, ErrTemplateData, err)
+		}
+		emails = append(emails, PurchaseEmail{
+			Product:      product,
+			TemplateData: templateData,
+		})
+	}
+	return emails, nil
+}
+
+// attachAsset fetches the product's asset as an email attachment
+func attachAsset(ctx context.Context, product Product) (connect.Attachment, error) {
+	asset, err := delivery.Fetch(ctx, product.Asset(), maxAttachmentBytes)
+	if err != nil {
+		return connect.Attachment{}, fmt.Errorf("attaching %q: %w", product.Name, err)
 	}
-	return err
+	return connect.Attachment{
+		Filename:    data.Coalesce(asset.Name, product.Name),
+		ContentType: asset.ContentType,
+		Content:     asset.Body,
+	}, nil
 }
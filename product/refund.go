@@ -0,0 +1,154 @@
+package product
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/500k-agency/function/data"
+	"github.com/500k-agency/function/lib/connect"
+	"github.com/stripe/stripe-go/v76"
+)
+
+// HandleChargeRefunded revokes access to the purchased products once the
+// charge is fully refunded and sends the optional refund confirmation
+func HandleChargeRefunded(ctx context.Context, charge stripe.Charge) error {
+	if charge.PaymentIntent == nil {
+		return nil
+	}
+	session, err := getPaymentSession(charge.PaymentIntent.ID)
+	if err != nil || session == nil {
+		return err
+	}
+
+	name := data.SplitName(session.CustomerDetails.Name)
+	products, err := sessionProducts(session.ID)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, product := range products {
+		// partial refunds keep access
+		if charge.Refunded {
+			if err := connect.Contacts.RemoveContact(ctx, session.CustomerDetails.Email, product.PurchaseThankyou.ListIDs); err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		if product.Refund.TemplateID == "" {
+			continue
+		}
+		req, err := newMessage(
+			product.sender,
+			connect.Address{Email: session.CustomerDetails.Email},
+			TemplateRefund,
+			product.Refund.TemplateID,
+			map[string]interface{}{
+				"firstName":      name.FirstName,
+				"productName":    product.Name,
+				"amountRefunded": formatAmount(charge.AmountRefunded, charge.Currency),
+				"fullRefund":     charge.Refunded,
+			},
+		)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := connect.Mail.Send(ctx, req); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return joinErrors("ChargeRefunded", errs)
+}
+
+// HandleDisputeCreated revokes access to the disputed products and notifies
+// the operator
+func HandleDisputeCreated(ctx context.Context, dispute stripe.Dispute) error {
+	if dispute.PaymentIntent == nil {
+		return nil
+	}
+	session, err := getPaymentSession(dispute.PaymentIntent.ID)
+	if err != nil || session == nil {
+		return err
+	}
+
+	products, err := sessionProducts(session.ID)
+	if err != nil {
+		return err
+	}
+
+	var (
+		errs         []error
+		productNames []string
+	)
+	for _, product := range products {
+		productNames = append(productNames, product.Name)
+		if err := connect.Contacts.RemoveContact(ctx, session.CustomerDetails.Email, product.PurchaseThankyou.ListIDs); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if operator.Email != "" && operator.DisputeTemplateID != "" {
+		req, err := newMessage(
+			defaultSender,
+			connect.Address{Email: operator.Email, Name: operator.Name},
+			TemplateOperatorDispute,
+			operator.DisputeTemplateID,
+			map[string]interface{}{
+				"disputeId":     dispute.ID,
+				"reason":        string(dispute.Reason),
+				"status":        string(dispute.Status),
+				"amount":        formatAmount(dispute.Amount, dispute.Currency),
+				"customerEmail": session.CustomerDetails.Email,
+				"customerName":  session.CustomerDetails.Name,
+				"productNames":  strings.Join(productNames, ", "),
+				"sessionId":     session.ID,
+				"dashboardUrl":  fmt.Sprintf("https://dashboard.stripe.com/disputes/%s", dispute.ID),
+			},
+		)
+		if err == nil {
+			err = connect.Mail.Send(ctx, req)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return joinErrors("DisputeCreated", errs)
+}
+
+// getPaymentSession returns the checkout session that created the payment
+// intent, or nil for payments made outside of checkout
+func getPaymentSession(paymentIntentID string) (*stripe.CheckoutSession, error) {
+	session, err := connect.StripeClient.GetSessionByPaymentIntent(paymentIntentID)
+	if errors.Is(err, connect.ErrSessionNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if session.CustomerDetails == nil {
+		return nil, nil
+	}
+	return session, nil
+}
+
+// sessionProducts returns the configured products purchased in the session
+func sessionProducts(sessionID string) ([]Product, error) {
+	items, err := connect.StripeClient.GetSessionItems(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("CheckoutSession %s line items: %w", sessionID, err)
+	}
+
+	var products []Product
+	for _, it := range items {
+		if it.Price == nil || it.Price.Product == nil {
+			continue
+		}
+		if product, ok := productCatalogue[it.Price.Product.ID]; ok {
+			products = append(products, product)
+		}
+	}
+	return products, nil
+}
@@ -0,0 +1,198 @@
+package product
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/500k-agency/function/lib/handlebars"
+)
+
+// Template files the emails are uploaded from, see cmd/toolkit
+const (
+	TemplatePurchaseThankyou         = "purchase_thankyou"
+	TemplateRefund                   = "refund"
+	TemplateSubscriptionWelcome      = "subscription_welcome"
+	TemplateSubscriptionDunning      = "subscription_dunning"
+	TemplateSubscriptionCancellation = "subscription_cancellation"
+	TemplateOperatorDispute          = "operator_dispute"
+	TemplateWaitlistConfirmation     = "waitlist_confirmation"
+
+	templateExt = ".handlebars"
+)
+
+var (
+	ErrUnknownProduct  = errors.New("unknown product")
+	ErrNoTemplate      = errors.New("email has no template_id")
+	ErrTemplateData    = errors.New("invalid template data")
+	ErrTemplateSchema  = errors.New("template variables do not match the email")
+	errUnknownTemplate = errors.New("no schema for template")
+)
+
+// PermanentError is a failure retrying the event cannot fix, ie. a product
+// missing from the catalogue or an email whose template data fails its
+// schema. It needs fixing in the config or the templates instead.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// IsPermanent reports whether err, and every error joined into it, is a
+// PermanentError
+func IsPermanent(err error) bool {
+	switch e := err.(type) {
+	case nil:
+		return false
+	case *PermanentError:
+		return true
+	case interface{ Unwrap() []error }:
+		errs := e.Unwrap()
+		for _, v := range errs {
+			if !IsPermanent(v) {
+				return false
+			}
+		}
+		return len(errs) > 0
+	case interface{ Unwrap() error }:
+		return IsPermanent(e.Unwrap())
+	}
+	return false
+}
+
+// templateSchemas declares the dynamic template data every email sends.
+// Required variables are never empty, optional ones may be.
+var templateSchemas = map[string]handlebars.Schema{
+	TemplatePurchaseThankyou: {
+		Required: []string{"productName", "productUrl"},
+		Optional: []string{"firstName"},
+	},
+	TemplateRefund: {
+		Required: []string{"productName", "amountRefunded", "fullRefund"},
+		Optional: []string{"firstName"},
+	},
+	TemplateSubscriptionWelcome: {
+		Required: []string{"productName"},
+		Optional: []string{"firstName", "productUrl"},
+	},
+	TemplateSubscriptionDunning: {
+		Required: []string{"productName", "billingPortalUrl", "amountDue"},
+		Optional: []string{"firstName", "productUrl", "invoiceUrl"},
+	},
+	TemplateSubscriptionCancellation: {
+		Required: []string{"productName"},
+		Optional: []string{"firstName", "productUrl"},
+	},
+	TemplateOperatorDispute: {
+		Required: []string{"disputeId", "amount", "customerEmail", "sessionId", "dashboardUrl"},
+		Optional: []string{"reason", "status", "customerName", "productNames"},
+	},
+	TemplateWaitlistConfirmation: {
+		Required: []string{"confirmUrl"},
+		Optional: []string{"firstName", "waitlistName"},
+	},
+}
+
+// LookupProduct returns the configured product with the stripe id, or
+// ErrUnknownProduct
+func LookupProduct(productID string) (Product, error) {
+	p, ok := productCatalogue[productID]
+	if !ok {
+		return p, &PermanentError{fmt.Errorf("%w %q", ErrUnknownProduct, productID)}
+	}
+	return p, nil
+}
+
+// checkTemplateData checks the email has a template and its data holds
+// every variable its schema requires
+func checkTemplateData(template, templateID string, data map[string]interface{}) error {
+	if templateID == "" {
+		return &PermanentError{fmt.Errorf("%s: %w", template, ErrNoTemplate)}
+	}
+	schema, ok := templateSchemas[template]
+	if !ok {
+		return &PermanentError{fmt.Errorf("%s: %w", template, errUnknownTemplate)}
+	}
+	if err := schema.Check(data); err != nil {
+		return &PermanentError{fmt.Errorf("%s: %w: %w", template, ErrTemplateData, err)}
+	}
+	return nil
+}
+
+// CheckTemplates checks the variables declared by the template files in dir
+// against the data their emails send. A template may only require variables
+// that are never empty, and may only read declared variables. Missing files
+// and templates without a declaration are skipped.
+func CheckTemplates(dir string) error {
+	names := make([]string, 0, len(templateSchemas))
+	for name := range templateSchemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		file := filepath.Join(dir, name+templateExt)
+		src, err := os.ReadFile(file)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := checkTemplate(name, string(src)); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", file, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func checkTemplate(name, src string) error {
+	declared, ok, err := handlebars.ParseSchema(src)
+	if err != nil || !ok {
+		return err
+	}
+	tmpl, err := handlebars.Parse(src)
+	if err != nil {
+		return err
+	}
+
+	sent := templateSchemas[name]
+	var errs []error
+	for _, v := range declared.Required {
+		switch {
+		case !sent.Declares(v):
+			errs = append(errs, fmt.Errorf("%w: requires %q, which is never sent", ErrTemplateSchema, v))
+		case !contains(sent.Required, v):
+			errs = append(errs, fmt.Errorf("%w: requires %q, which may be empty", ErrTemplateSchema, v))
+		}
+	}
+	for _, v := range declared.Optional {
+		if !sent.Declares(v) {
+			errs = append(errs, fmt.Errorf("%w: declares %q, which is never sent", ErrTemplateSchema, v))
+		}
+	}
+	for _, v := range tmpl.Variables() {
+		if !declared.Declares(v) {
+			errs = append(errs, fmt.Errorf("%w: reads undeclared %q", ErrTemplateSchema, v))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,130 @@
+package product
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/500k-agency/function/lib/emailx"
+	"github.com/500k-agency/function/lib/sendgrid"
+)
+
+var (
+	ErrNoSender       = errors.New("sender from_email is required")
+	ErrUnknownBrand   = errors.New("unknown brand")
+	ErrDuplicateBrand = errors.New("duplicate brand")
+)
+
+// legacySender is the identity emails were sent with before the sender
+// became configurable, used when the config has no [sender] from_email
+var legacySender = SenderConfig{
+	FromEmail:    "noreply@spacestationlabs.ltd",
+	FromName:     "Paul at Spacestation Labs",
+	ReplyToEmail: "paul@spacestationlabs.ltd",
+}
+
+// SenderConfig holds the sender identity and metadata of outgoing emails.
+// It can be set globally, per brand and per product, the most specific
+// non-empty value wins. Custom args are merged key by key.
+type SenderConfig struct {
+	FromEmail    string `toml:"from_email"`
+	FromName     string `toml:"from_name"`
+	ReplyToEmail string `toml:"reply_to_email"`
+	ReplyToName  string `toml:"reply_to_name"`
+
+	// unsubscribe group of the emails
+	AsmGroupID         int64   `toml:"asm_group_id"`
+	AsmGroupsToDisplay []int64 `toml:"asm_groups_to_display"`
+
+	Categories []string          `toml:"categories"`
+	CustomArgs map[string]string `toml:"custom_args"`
+}
+
+// BrandConfig groups the sender identity shared by a brand's products
+type BrandConfig struct {
+	ID     string       `toml:"id"`
+	Sender SenderConfig `toml:"sender"`
+}
+
+// Merge returns s with the non-empty fields of override applied on top
+func (s SenderConfig) Merge(override SenderConfig) SenderConfig {
+	if override.FromEmail != "" {
+		s.FromEmail = override.FromEmail
+		// a name belongs to its address
+		s.FromName = override.FromName
+	}
+	if override.FromName != "" {
+		s.FromName = override.FromName
+	}
+	if override.ReplyToEmail != "" {
+		s.ReplyToEmail = override.ReplyToEmail
+		s.ReplyToName = override.ReplyToName
+	}
+	if override.ReplyToName != "" {
+		s.ReplyToName = override.ReplyToName
+	}
+	if override.AsmGroupID != 0 {
+		s.AsmGroupID = override.AsmGroupID
+	}
+	if len(override.AsmGroupsToDisplay) > 0 {
+		s.AsmGroupsToDisplay = override.AsmGroupsToDisplay
+	}
+	if len(override.Categories) > 0 {
+		s.Categories = override.Categories
+	}
+	if len(override.CustomArgs) > 0 {
+		args := make(map[string]string, len(s.CustomArgs)+len(override.CustomArgs))
+		for k, v := range s.CustomArgs {
+			args[k] = v
+		}
+		for k, v := range override.CustomArgs {
+			args[k] = v
+		}
+		s.CustomArgs = args
+	}
+	return s
+}
+
+// Validate checks the sender can be used to send emails
+func (s SenderConfig) Validate() error {
+	if s.FromEmail == "" {
+		return ErrNoSender
+	}
+	if err := emailx.ValidateFast(s.FromEmail); err != nil {
+		return fmt.Errorf("from_email %q: %w", s.FromEmail, err)
+	}
+	if s.ReplyToEmail != "" {
+		if err := emailx.ValidateFast(s.ReplyToEmail); err != nil {
+			return fmt.Errorf("reply_to_email %q: %w", s.ReplyToEmail, err)
+		}
+	}
+	if len(s.Categories) > sendgrid.MaxCategories {
+		return fmt.Errorf("at most %d categories are allowed, got %d", sendgrid.MaxCategories, len(s.Categories))
+	}
+	for _, c := range s.Categories {
+		if len(c) > sendgrid.MaxCategoryLength {
+			return fmt.Errorf("category %q exceeds %d characters", c, sendgrid.MaxCategoryLength)
+		}
+	}
+	var argsBytes int
+	for k, v := range s.CustomArgs {
+		argsBytes += len(k) + len(v)
+	}
+	if argsBytes > sendgrid.MaxCustomArgsBytes {
+		return fmt.Errorf("custom_args exceed %d bytes", sendgrid.MaxCustomArgsBytes)
+	}
+	return nil
+}
+
+// resolveSender applies the brand and product sender on top of the global one
+func resolveSender(global SenderConfig, brands map[string]BrandConfig, conf Config) (SenderConfig, error) {
+	sender := global
+	if conf.Brand != "" {
+		brand, ok := brands[conf.Brand]
+		if !ok {
+			return sender, fmt.Errorf("%w %q", ErrUnknownBrand, conf.Brand)
+		}
+		sender = sender.Merge(brand.Sender)
+	}
+	sender = sender.Merge(conf.Sender)
+	return sender, sender.Validate()
+}
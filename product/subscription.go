@@ -0,0 +1,268 @@
+package product
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/500k-agency/function/data"
+	"github.com/500k-agency/function/lib/connect"
+	"github.com/stripe/stripe-go/v76"
+)
+
+var (
+	ErrNoCustomer = errors.New("subscription has no customer")
+)
+
+// HandleSubscriptionCreated provisions a new subscription. Subscriptions
+// still waiting on their first payment are provisioned once they turn active.
+func HandleSubscriptionCreated(ctx context.Context, sub stripe.Subscription) error {
+	if !isSubscriptionActive(sub.Status) {
+		return nil
+	}
+	return provisionSubscription(ctx, sub, true)
+}
+
+// HandleSubscriptionUpdated keeps list membership in sync with the
+// subscription status. previous holds the attributes stripe reports as
+// changed by the update.
+func HandleSubscriptionUpdated(ctx context.Context, sub stripe.Subscription, previous map[string]interface{}) error {
+	prevStatus, statusChanged := previous["status"].(string)
+
+	switch {
+	case isSubscriptionActive(sub.Status):
+		// welcome subscribers whose first payment just went through
+		welcome := statusChanged &&
+			stripe.SubscriptionStatus(prevStatus) == stripe.SubscriptionStatusIncomplete
+		return provisionSubscription(ctx, sub, welcome)
+	case isSubscriptionRevoked(sub.Status):
+		return revokeSubscription(ctx, sub, false)
+	}
+	return nil
+}
+
+// HandleSubscriptionDeleted removes the subscriber from the product lists
+// and sends the cancellation email
+func HandleSubscriptionDeleted(ctx context.Context, sub stripe.Subscription) error {
+	return revokeSubscription(ctx, sub, true)
+}
+
+// HandleInvoicePaid keeps renewing subscribers on the product lists, this
+// also restores access after a failed payment is recovered
+func HandleInvoicePaid(ctx context.Context, invoice stripe.Invoice) error {
+	if invoice.Subscription == nil {
+		return nil
+	}
+
+	name := data.SplitName(invoice.CustomerName)
+	var errs []error
+	for _, product := range invoiceProducts(invoice) {
+		if err := addSubscriber(ctx, product, invoice.CustomerEmail, name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return joinErrors("InvoicePaid", errs)
+}
+
+// HandleInvoicePaymentFailed sends the dunning email with a link to the
+// billing portal so the customer can update their payment method
+func HandleInvoicePaymentFailed(ctx context.Context, invoice stripe.Invoice) error {
+	if invoice.Subscription == nil || invoice.Customer == nil {
+		return nil
+	}
+
+	name := data.SplitName(invoice.CustomerName)
+	var errs []error
+	for _, product := range invoiceProducts(invoice) {
+		if product.Subscription.Dunning.TemplateID == "" {
+			continue
+		}
+
+		portal, err := connect.StripeClient.CreateCustomerBillingPortal(invoice.Customer.ID, product.Subscription.ReturnURL)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		req, err := newMessage(
+			product.sender,
+			connect.Address{Email: invoice.CustomerEmail},
+			TemplateSubscriptionDunning,
+			product.Subscription.Dunning.TemplateID,
+			map[string]interface{}{
+				"firstName":        name.FirstName,
+				"productName":      product.Name,
+				"productUrl":       product.URL,
+				"billingPortalUrl": portal.URL,
+				"invoiceUrl":       invoice.HostedInvoiceURL,
+				"amountDue":        formatAmount(invoice.AmountDue, invoice.Currency),
+			},
+		)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := connect.Mail.Send(ctx, req); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return joinErrors("InvoicePaymentFailed", errs)
+}
+
+func provisionSubscription(ctx context.Context, sub stripe.Subscription, welcome bool) error {
+	customer, err := getCustomer(sub.Customer)
+	if err != nil {
+		return fmt.Errorf("Subscription: %w", err)
+	}
+
+	name := data.SplitName(customer.Name)
+	var errs []error
+	for _, product := range subscriptionProducts(sub) {
+		if err := addSubscriber(ctx, product, customer.Email, name); err != nil {
+			errs = append(errs, err)
+		}
+
+		if !welcome || product.Subscription.Welcome.TemplateID == "" {
+			continue
+		}
+		req, err := newMessage(
+			product.sender,
+			connect.Address{Email: customer.Email},
+			TemplateSubscriptionWelcome,
+			product.Subscription.Welcome.TemplateID,
+			map[string]interface{}{
+				"firstName":   name.FirstName,
+				"productName": product.Name,
+				"productUrl":  product.URL,
+			},
+		)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := connect.Mail.Send(ctx, req); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return joinErrors("Subscription", errs)
+}
+
+func revokeSubscription(ctx context.Context, sub stripe.Subscription, notify bool) error {
+	customer, err := getCustomer(sub.Customer)
+	if err != nil {
+		return fmt.Errorf("Subscription: %w", err)
+	}
+
+	name := data.SplitName(customer.Name)
+	var errs []error
+	for _, product := range subscriptionProducts(sub) {
+		if err := connect.Contacts.RemoveContact(ctx, customer.Email, product.Subscription.ListIDs); err != nil {
+			errs = append(errs, err)
+		}
+
+		if !notify || product.Subscription.Cancellation.TemplateID == "" {
+			continue
+		}
+		req, err := newMessage(
+			product.sender,
+			connect.Address{Email: customer.Email},
+			TemplateSubscriptionCancellation,
+			product.Subscription.Cancellation.TemplateID,
+			map[string]interface{}{
+				"firstName":   name.FirstName,
+				"productName": product.Name,
+				"productUrl":  product.URL,
+			},
+		)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := connect.Mail.Send(ctx, req); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return joinErrors("Subscription", errs)
+}
+
+func addSubscriber(ctx context.Context, product Product, email string, name data.Name) error {
+	if len(product.Subscription.ListIDs) == 0 {
+		return nil
+	}
+	return connect.Contacts.AddContact(ctx, &connect.ContactRequest{
+		ListIDs: product.Subscription.ListIDs,
+		Contacts: []*connect.Contact{
+			{
+				Email:     email,
+				FirstName: name.FirstName,
+				LastName:  name.LastName,
+			},
+		},
+	})
+}
+
+// getCustomer fetches the customer unless the event already carries it expanded
+func getCustomer(customer *stripe.Customer) (*stripe.Customer, error) {
+	if customer == nil || customer.ID == "" {
+		return nil, ErrNoCustomer
+	}
+	if customer.Email != "" {
+		return customer, nil
+	}
+	return connect.StripeClient.GetCustomer(customer.ID)
+}
+
+// subscriptionProducts returns the configured products of the subscription items
+func subscriptionProducts(sub stripe.Subscription) []Product {
+	var products []Product
+	if sub.Items == nil {
+		return products
+	}
+	for _, it := range sub.Items.Data {
+		if it.Price == nil || it.Price.Product == nil {
+			continue
+		}
+		if product, ok := productCatalogue[it.Price.Product.ID]; ok {
+			products = append(products, product)
+		}
+	}
+	return products
+}
+
+// invoiceProducts returns the configured products of the invoice lines
+func invoiceProducts(invoice stripe.Invoice) []Product {
+	var products []Product
+	if invoice.Lines == nil {
+		return products
+	}
+	for _, it := range invoice.Lines.Data {
+		if it.Price == nil || it.Price.Product == nil {
+			continue
+		}
+		if product, ok := productCatalogue[it.Price.Product.ID]; ok {
+			products = append(products, product)
+		}
+	}
+	return products
+}
+
+func isSubscriptionActive(status stripe.SubscriptionStatus) bool {
+	return status == stripe.SubscriptionStatusActive || status == stripe.SubscriptionStatusTrialing
+}
+
+func isSubscriptionRevoked(status stripe.SubscriptionStatus) bool {
+	switch status {
+	case stripe.SubscriptionStatusCanceled,
+		stripe.SubscriptionStatusUnpaid,
+		stripe.SubscriptionStatusIncompleteExpired:
+		return true
+	}
+	return false
+}
+
+func joinErrors(prefix string, errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s: %w", prefix, errors.Join(errs...))
+}
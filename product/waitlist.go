@@ -0,0 +1,30 @@
+package product
+
+import (
+	"context"
+
+	"github.com/500k-agency/function/lib/connect"
+)
+
+// SendWaitlistConfirmation sends the double opt-in email of a waitlist
+// signup from the global sender. It is transactional, so it is sent without
+// an unsubscribe group.
+func SendWaitlistConfirmation(ctx context.Context, templateID, email, firstName, waitlistName, confirmURL string) error {
+	m, err := newMessage(
+		defaultSender,
+		connect.Address{Email: email},
+		TemplateWaitlistConfirmation,
+		templateID,
+		map[string]interface{}{
+			"firstName":    firstName,
+			"waitlistName": waitlistName,
+			"confirmUrl":   confirmURL,
+		},
+	)
+	if err != nil {
+		return err
+	}
+	m.UnsubscribeGroupID = 0
+	m.UnsubscribeGroups = nil
+	return connect.Mail.Send(ctx, m)
+}
@@ -0,0 +1,202 @@
+package waitlist
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Tally field types, https://tally.so/help/webhooks
+const (
+	FieldInputText      = "INPUT_TEXT"
+	FieldInputEmail     = "INPUT_EMAIL"
+	FieldInputNumber    = "INPUT_NUMBER"
+	FieldTextarea       = "TEXTAREA"
+	FieldMultipleChoice = "MULTIPLE_CHOICE"
+	FieldCheckboxes     = "CHECKBOXES"
+	FieldDropdown       = "DROPDOWN"
+	FieldHiddenFields   = "HIDDEN_FIELDS"
+)
+
+var (
+	ErrNoEmail             = errors.New("form response has no email")
+	ErrInvalidFieldConfig  = errors.New("invalid waitlist field mapping")
+	ErrUnknownContactField = errors.New("unknown contact field")
+)
+
+// FieldConfig maps a form field, matched by key or else by label, onto a
+// contact field or a custom field
+type FieldConfig struct {
+	Key   string `toml:"key"`
+	Label string `toml:"label"`
+
+	// email, first_name, last_name, address_line_1, address_line_2, city,
+	// state_province_region, postal_code or country
+	Contact string `toml:"contact"`
+	// custom field name
+	CustomField string `toml:"custom_field"`
+}
+
+// Contact is a signup mapped from a form response, signed into confirmation
+// tokens. It mirrors connect.Contact, which imports this package, and
+// converts to it.
+type Contact struct {
+	Email               string                 `json:"email"`
+	FirstName           string                 `json:"first_name,omitempty"`
+	LastName            string                 `json:"last_name,omitempty"`
+	AddressLine1        string                 `json:"address_line_1,omitempty"`
+	AddressLine2        string                 `json:"address_line_2,omitempty"`
+	City                string                 `json:"city,omitempty"`
+	StateProvinceRegion string                 `json:"state_province_region,omitempty"`
+	PostalCode          string                 `json:"postal_code,omitempty"`
+	Country             string                 `json:"country,omitempty"`
+	CustomFields        map[string]interface{} `json:"custom_fields,omitempty"`
+}
+
+// contactSetters set the contact fields a form field can be mapped onto
+var contactSetters = map[string]func(c *Contact, v string){
+	"email":                 func(c *Contact, v string) { c.Email = v },
+	"first_name":            func(c *Contact, v string) { c.FirstName = v },
+	"last_name":             func(c *Contact, v string) { c.LastName = v },
+	"address_line_1":        func(c *Contact, v string) { c.AddressLine1 = v },
+	"address_line_2":        func(c *Contact, v string) { c.AddressLine2 = v },
+	"city":                  func(c *Contact, v string) { c.City = v },
+	"state_province_region": func(c *Contact, v string) { c.StateProvinceRegion = v },
+	"postal_code":           func(c *Contact, v string) { c.PostalCode = v },
+	"country":               func(c *Contact, v string) { c.Country = v },
+}
+
+func (f FieldConfig) validate() error {
+	switch {
+	case f.Key == "" && f.Label == "":
+		return fmt.Errorf("%w: key or label is required", ErrInvalidFieldConfig)
+	case (f.Contact == "") == (f.CustomField == ""):
+		return fmt.Errorf("%w: set one of contact or custom_field", ErrInvalidFieldConfig)
+	case f.Contact != "":
+		if _, ok := contactSetters[f.Contact]; !ok {
+			return fmt.Errorf("%w %q", ErrUnknownContactField, f.Contact)
+		}
+	}
+	return nil
+}
+
+func (f FieldConfig) matches(field *FormField) bool {
+	if f.Key != "" {
+		return f.Key == field.Key
+	}
+	return strings.EqualFold(strings.TrimSpace(f.Label), strings.TrimSpace(field.Label))
+}
+
+// Contact maps the answers of the form response onto a contact. Without a
+// mapping for the email, the first email field, or field labelled email, is
+// used. Unanswered fields are skipped.
+func (w *Waitlist) Contact(r *FormResponse) (*Contact, error) {
+	contact := &Contact{}
+	for _, m := range w.Fields {
+		for _, field := range r.Fields {
+			if !m.matches(field) {
+				continue
+			}
+			value, ok := field.Answer()
+			if !ok {
+				continue
+			}
+			if m.Contact != "" {
+				contactSetters[m.Contact](contact, toString(value))
+				continue
+			}
+			if contact.CustomFields == nil {
+				contact.CustomFields = map[string]interface{}{}
+			}
+			contact.CustomFields[m.CustomField] = value
+		}
+	}
+
+	if contact.Email == "" {
+		contact.Email = r.email()
+	}
+	if contact.Email == "" {
+		return nil, ErrNoEmail
+	}
+	return contact, nil
+}
+
+// email returns the answer of the first email field
+func (r *FormResponse) email() string {
+	for _, f := range r.Fields {
+		if f.Type != FieldInputEmail && !strings.Contains(strings.ToLower(f.Label), "email") {
+			continue
+		}
+		if v, ok := f.Answer(); ok {
+			return toString(v)
+		}
+	}
+	return ""
+}
+
+// Answer converts the value of the field by its type: choices become the
+// comma separated text of the selected options, the single option
+// checkboxes tally sends per option "true" or "false", numbers a float64 and
+// everything else a string. ok is false when the field is unanswered.
+func (f *FormField) Answer() (v interface{}, ok bool) {
+	switch f.Type {
+	case FieldCheckboxes:
+		if checked, isBool := f.Value.(bool); isBool {
+			return strconv.FormatBool(checked), true
+		}
+		v = f.choices()
+	case FieldMultipleChoice, FieldDropdown:
+		v = f.choices()
+	case FieldInputNumber:
+		if n, isNumber := f.Value.(float64); isNumber {
+			return n, true
+		}
+		v = toString(f.Value)
+	default:
+		v = toString(f.Value)
+	}
+	return v, v != ""
+}
+
+// choices returns the text of the selected options. Values hold option ids,
+// a single id for older multiple choice fields.
+func (f *FormField) choices() string {
+	var ids []string
+	switch v := f.Value.(type) {
+	case string:
+		ids = []string{v}
+	case []interface{}:
+		for _, id := range v {
+			ids = append(ids, toString(id))
+		}
+	}
+
+	texts := make([]string, 0, len(ids))
+	for _, id := range ids {
+		text := id
+		for _, o := range f.Options {
+			if o.ID == id {
+				text = o.Text
+				break
+			}
+		}
+		if text != "" {
+			texts = append(texts, text)
+		}
+	}
+	return strings.Join(texts, ", ")
+}
+
+// toString formats a scalar field value, nil and compound values are empty
+func toString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return ""
+}
@@ -0,0 +1,109 @@
+package waitlist
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestFormFieldAnswer(t *testing.T) {
+	options := []*FieldOption{{ID: "o1", Text: "Design"}, {ID: "o2", Text: "Code"}}
+	tests := []struct {
+		name   string
+		field  FormField
+		want   interface{}
+		wantOK bool
+	}{
+		{"text", FormField{Type: FieldInputText, Value: "  Ada "}, "Ada", true},
+		{"empty text", FormField{Type: FieldInputText, Value: ""}, "", false},
+		{"unanswered", FormField{Type: FieldInputText}, "", false},
+		{"number", FormField{Type: FieldInputNumber, Value: 42.5}, 42.5, true},
+		{"multiple choice", FormField{Type: FieldMultipleChoice, Value: []interface{}{"o2"}, Options: options}, "Code", true},
+		{"legacy multiple choice", FormField{Type: FieldMultipleChoice, Value: "o1", Options: options}, "Design", true},
+		{"checkboxes", FormField{Type: FieldCheckboxes, Value: []interface{}{"o1", "o2"}, Options: options}, "Design, Code", true},
+		{"unknown option", FormField{Type: FieldDropdown, Value: []interface{}{"o9"}, Options: options}, "o9", true},
+		{"no choice", FormField{Type: FieldDropdown, Value: nil, Options: options}, "", false},
+		{"checked option", FormField{Type: FieldCheckboxes, Value: true}, "true", true},
+		{"unchecked option", FormField{Type: FieldCheckboxes, Value: false}, "false", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.field.Answer()
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("Answer() = %#v, %v, want %#v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+// a tally response with a checkbox question, sent as the question and as one
+// boolean field per option
+const formResponse = `{
+	"formId": "f1",
+	"fields": [
+		{"key": "question_email", "label": "Your email", "type": "INPUT_EMAIL", "value": "ada@example.com"},
+		{"key": "question_name", "label": "First name", "type": "INPUT_TEXT", "value": "Ada"},
+		{"key": "question_team", "label": "Team size", "type": "INPUT_NUMBER", "value": 4},
+		{"key": "question_consent", "label": "Consent", "type": "CHECKBOXES", "value": ["c1"],
+			"options": [{"id": "c1", "text": "I agree"}]},
+		{"key": "question_consent_c1", "label": "Consent (I agree)", "type": "CHECKBOXES", "value": true},
+		{"key": "question_skip", "label": "Skipped", "type": "INPUT_TEXT", "value": null}
+	]
+}`
+
+func TestWaitlistContact(t *testing.T) {
+	var r FormResponse
+	if err := json.Unmarshal([]byte(formResponse), &r); err != nil {
+		t.Fatal(err)
+	}
+
+	w := &Waitlist{Config: Config{Fields: []FieldConfig{
+		{Label: "first NAME", Contact: "first_name"},
+		{Key: "question_team", CustomField: "team_size"},
+		{Key: "question_consent_c1", CustomField: "consent"},
+		{Key: "question_skip", CustomField: "skipped"},
+	}}}
+	got, err := w.Contact(&r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Contact{
+		Email:     "ada@example.com",
+		FirstName: "Ada",
+		CustomFields: map[string]interface{}{
+			"team_size": 4.0,
+			"consent":   "true",
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Contact() = %+v, want %+v", got, want)
+	}
+
+	r.Fields = r.Fields[1:]
+	if _, err := w.Contact(&r); !errors.Is(err, ErrNoEmail) {
+		t.Errorf("without email: got %v, want ErrNoEmail", err)
+	}
+}
+
+func TestFieldConfigValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		conf FieldConfig
+		want error
+	}{
+		{"contact", FieldConfig{Key: "k", Contact: "city"}, nil},
+		{"custom field", FieldConfig{Label: "l", CustomField: "c"}, nil},
+		{"no key or label", FieldConfig{Contact: "city"}, ErrInvalidFieldConfig},
+		{"no target", FieldConfig{Key: "k"}, ErrInvalidFieldConfig},
+		{"both targets", FieldConfig{Key: "k", Contact: "city", CustomField: "c"}, ErrInvalidFieldConfig},
+		{"unknown contact field", FieldConfig{Key: "k", Contact: "phone"}, ErrUnknownContactField},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.conf.validate(); !errors.Is(err, tt.want) {
+				t.Errorf("validate() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
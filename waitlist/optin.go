@@ -0,0 +1,110 @@
+package waitlist
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/500k-agency/function/lib/token"
+)
+
+const defaultOptInTTL = 7 * 24 * time.Hour
+
+var (
+	ErrOptInDisabled     = errors.New("double opt-in is not configured")
+	ErrNoConfirmTemplate = errors.New("double opt-in waitlist has no confirm_template_id")
+)
+
+// OptInConfig signs the confirmation links of double opt-in waitlists
+type OptInConfig struct {
+	// hmac secret used to sign confirmation tokens
+	Secret string `toml:"secret"`
+
+	// public url of the ConfirmHandler function
+	BaseURL string `toml:"base_url"`
+
+	// how long a confirmation link stays valid, defaults to 7 days
+	TTLHours int `toml:"ttl_hours"`
+}
+
+// ConfirmClaims are sealed into every confirmation token, the signup is
+// added to the waitlist once confirmed. Tokens are encrypted, so the contact
+// cannot be read from the link or the access logs it ends up in.
+type ConfirmClaims struct {
+	FormID     string  `json:"fid"`
+	Contact    Contact `json:"contact"`
+	ReferredBy string  `json:"ref,omitempty"`
+	Expiry     int64   `json:"exp"`
+}
+
+func (c *ConfirmClaims) ExpiresAt() time.Time {
+	return time.Unix(c.Expiry, 0)
+}
+
+var optIn OptInConfig
+
+func (c OptInConfig) validate() error {
+	if c.Secret == "" {
+		return fmt.Errorf("optin: %w", token.ErrNoSecret)
+	}
+	if c.BaseURL == "" {
+		return errors.New("optin: base_url is required")
+	}
+	if _, err := url.Parse(c.BaseURL); err != nil {
+		return fmt.Errorf("optin: invalid base_url: %w", err)
+	}
+	return nil
+}
+
+func (c OptInConfig) ttl() time.Duration {
+	if c.TTLHours > 0 {
+		return time.Duration(c.TTLHours) * time.Hour
+	}
+	return defaultOptInTTL
+}
+
+// IssueConfirmURL creates the signed link confirming the signup to the
+// waitlist, the referrer is credited once confirmed
+func (w *Waitlist) IssueConfirmURL(c *Contact, referredBy string) (string, error) {
+	if optIn.Secret == "" {
+		return "", ErrOptInDisabled
+	}
+	claims := &ConfirmClaims{
+		FormID:     w.FormID,
+		Contact:    *c,
+		ReferredBy: referredBy,
+		Expiry:     time.Now().Add(optIn.ttl()).Unix(),
+	}
+	tok, err := token.Seal(claims, optIn.Secret)
+	if err != nil {
+		return "", err
+	}
+
+	u, _ := url.Parse(optIn.BaseURL)
+	q := u.Query()
+	q.Set("token", tok)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// Confirm opens the confirmation token and returns the waitlist and the
+// claims of the signup it confirms. Tokens of waitlists that no longer run
+// double opt-in fail with ErrOptInDisabled.
+func Confirm(tok string) (*Waitlist, *ConfirmClaims, error) {
+	if optIn.Secret == "" {
+		return nil, nil, ErrOptInDisabled
+	}
+	claims := &ConfirmClaims{}
+	if err := token.Open(tok, optIn.Secret, claims); err != nil {
+		return nil, nil, err
+	}
+	w, err := GetListByID(claims.FormID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !w.DoubleOptIn {
+		return nil, nil, fmt.Errorf("%w for waitlist %q", ErrOptInDisabled, w.Name)
+	}
+	return w, claims, nil
+}
@@ -0,0 +1,141 @@
+package waitlist
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/500k-agency/function/lib/token"
+)
+
+// errAny expects an error without a sentinel to match
+var errAny = errors.New("any error")
+
+var testOptIn = OptInConfig{Secret: "s3cret", BaseURL: "https://example.com/confirm?x=1"}
+
+func setupOptIn(t *testing.T, confs []Config, conf OptInConfig) {
+	t.Helper()
+	if err := Setup(confs, conf, StoreConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { Setup(nil, OptInConfig{}, StoreConfig{}) })
+}
+
+func TestSetupOptIn(t *testing.T) {
+	t.Cleanup(func() { Setup(nil, OptInConfig{}, StoreConfig{}) })
+	optInList := Config{Name: "beta", FormID: "f1", DoubleOptIn: true, ConfirmTemplateID: "d-1"}
+
+	tests := []struct {
+		name string
+		conf Config
+		opt  OptInConfig
+		want error
+	}{
+		{"configured", optInList, testOptIn, nil},
+		{"single opt-in needs no secret", Config{Name: "beta", FormID: "f1"}, OptInConfig{}, nil},
+		{"no confirm template", Config{Name: "beta", FormID: "f1", DoubleOptIn: true}, testOptIn, ErrNoConfirmTemplate},
+		{"no secret", optInList, OptInConfig{BaseURL: "https://example.com"}, token.ErrNoSecret},
+		{"no base url", optInList, OptInConfig{Secret: "s3cret"}, errAny},
+		{"bad base url", optInList, OptInConfig{Secret: "s3cret", BaseURL: "://"}, errAny},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Setup([]Config{tt.conf}, tt.opt, StoreConfig{})
+			switch {
+			case tt.want == errAny:
+				if err == nil {
+					t.Error("accepted the config")
+				}
+			case !errors.Is(err, tt.want):
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfirm(t *testing.T) {
+	setupOptIn(t, []Config{
+		{Name: "beta", FormID: "f1", DoubleOptIn: true, ConfirmTemplateID: "d-1"},
+		{Name: "news", FormID: "f2"},
+	}, testOptIn)
+
+	w, _ := GetListByID("f1")
+	link, err := w.IssueConfirmURL(&Contact{Email: "ada@example.com", FirstName: "Ada"}, "REF1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(link)
+	if !strings.HasPrefix(link, "https://example.com/confirm?") || u.Query().Get("x") != "1" {
+		t.Errorf("link %s", link)
+	}
+	if strings.Contains(link, "ada@example.com") || strings.Contains(link, "ada%40example.com") {
+		t.Errorf("link %s reveals the email", link)
+	}
+	tok := u.Query().Get("token")
+
+	got, claims, err := Confirm(tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.FormID != "f1" || claims.Contact.Email != "ada@example.com" || claims.Contact.FirstName != "Ada" || claims.ReferredBy != "REF1" {
+		t.Errorf("confirmed %s with %+v", got.FormID, claims)
+	}
+	if ttl := time.Until(claims.ExpiresAt()); ttl < defaultOptInTTL-time.Minute || ttl > defaultOptInTTL {
+		t.Errorf("expires in %v, want %v", ttl, defaultOptInTTL)
+	}
+
+	seal := func(c *ConfirmClaims, secret string) string {
+		s, _ := token.Seal(c, secret)
+		return s
+	}
+	hour := time.Now().Add(time.Hour).Unix()
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"expired", seal(&ConfirmClaims{FormID: "f1", Expiry: time.Now().Add(-time.Hour).Unix()}, "s3cret"), token.ErrExpired},
+		{"other secret", seal(&ConfirmClaims{FormID: "f1", Expiry: hour}, "other"), token.ErrInvalidSignature},
+		{"garbage", "nope", token.ErrMalformed},
+		{"unknown form", seal(&ConfirmClaims{FormID: "gone", Expiry: hour}, "s3cret"), ErrUnknownForm},
+		{"waitlist no longer double opt-in", seal(&ConfirmClaims{FormID: "f2", Expiry: hour}, "s3cret"), ErrOptInDisabled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := Confirm(tt.token); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestOptInTTL(t *testing.T) {
+	conf := testOptIn
+	conf.TTLHours = 2
+	setupOptIn(t, []Config{{Name: "beta", FormID: "f1", DoubleOptIn: true, ConfirmTemplateID: "d-1"}}, conf)
+
+	w, _ := GetListByID("f1")
+	link, _ := w.IssueConfirmURL(&Contact{Email: "ada@example.com"}, "")
+	u, _ := url.Parse(link)
+	_, claims, err := Confirm(u.Query().Get("token"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ttl := time.Until(claims.ExpiresAt()); ttl < time.Hour || ttl > 2*time.Hour {
+		t.Errorf("expires in %v, want 2h", ttl)
+	}
+}
+
+func TestOptInDisabled(t *testing.T) {
+	setupOptIn(t, []Config{{Name: "news", FormID: "f2"}}, OptInConfig{})
+
+	w, _ := GetListByID("f2")
+	if _, err := w.IssueConfirmURL(&Contact{Email: "ada@example.com"}, ""); !errors.Is(err, ErrOptInDisabled) {
+		t.Errorf("IssueConfirmURL: got %v, want ErrOptInDisabled", err)
+	}
+	if _, _, err := Confirm("anything"); !errors.Is(err, ErrOptInDisabled) {
+		t.Errorf("Confirm: got %v, want ErrOptInDisabled", err)
+	}
+}
@@ -0,0 +1,468 @@
+package waitlist
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/500k-agency/function/data"
+	"github.com/500k-agency/function/lib/firestore"
+	"github.com/500k-agency/function/lib/jsonstore"
+)
+
+const (
+	referralCodeLength = 8
+
+	// attempts at registering a signup while the documents it writes keep
+	// changing
+	maxCommitAttempts = 5
+
+	defaultReferrerLabel = "ref"
+)
+
+var (
+	ErrReferralsDisabled   = errors.New("waitlist has no referral program")
+	ErrUnknownReferral     = errors.New("unknown referral code")
+	ErrReferralStoreMemory = errors.New("referrals need a persistent [referrals] store, file or firestore")
+)
+
+// ReferralConfig runs a referral program on the waitlist. Every signup gets
+// a unique code, written to the code_field custom field, and signups
+// carrying a code in the referrer hidden field are credited to its owner.
+type ReferralConfig struct {
+	// custom field the referral code is written to, enables referrals
+	CodeField string `toml:"code_field"`
+
+	// hidden field carrying the referrer's code, by key or else by label,
+	// defaults to the "ref" label
+	ReferrerKey   string `toml:"referrer_key"`
+	ReferrerLabel string `toml:"referrer_label"`
+}
+
+// Enabled reports whether the waitlist runs a referral program
+func (c ReferralConfig) Enabled() bool {
+	return c.CodeField != ""
+}
+
+// StoreConfig holds the referral store configuration. The file driver
+// suits a single long-lived instance, use firestore to share codes and
+// counts across cloud function instances.
+type StoreConfig struct {
+	Driver     string `toml:"driver"`      // memory (default), file or firestore
+	Path       string `toml:"path"`        // file driver: path to the store file
+	ProjectID  string `toml:"project_id"`  // firestore driver: gcp project
+	DatabaseID string `toml:"database_id"` // firestore driver: defaults to (default)
+	Collection string `toml:"collection"`  // firestore driver: defaults to referrals
+}
+
+// persistent reports whether the store keeps referrals across restarts
+func (c StoreConfig) persistent() bool {
+	return c.Driver != "" && c.Driver != "memory"
+}
+
+// Referral is a signup of a waitlist with a referral program
+type Referral struct {
+	Code       string    `json:"code"`
+	FormID     string    `json:"formId"`
+	Email      string    `json:"email"`
+	ReferredBy string    `json:"referredBy,omitempty"`
+	Referrals  int       `json:"referrals"`
+	SignedUpAt time.Time `json:"signedUpAt"`
+}
+
+// ReferralStatus is the public standing of a referral code. Signups are
+// queued by referrals, then by signup time.
+type ReferralStatus struct {
+	Code      string `json:"code"`
+	Waitlist  string `json:"waitlist"`
+	Referrals int    `json:"referrals"`
+	Position  int    `json:"position"`
+	Total     int    `json:"total"`
+}
+
+// ReferralStore keeps the referral codes and counts
+type ReferralStore interface {
+	// Register records the signup and credits the referrer's code, if it
+	// belongs to another signup of the same waitlist. Signing up again keeps
+	// the existing code and credits nobody.
+	Register(ctx context.Context, formID, email, referredBy string) (*Referral, error)
+
+	// Status returns the standing of the code or ErrUnknownReferral
+	Status(ctx context.Context, code string) (*ReferralStatus, error)
+}
+
+// NewReferralStore instantiates a referral store for the configured driver
+func NewReferralStore(conf StoreConfig) (ReferralStore, error) {
+	switch conf.Driver {
+	case "", "memory":
+		return &localReferralStore{book: jsonstore.NewMemory[*Referral]()}, nil
+	case "file":
+		book, err := jsonstore.NewFile[*Referral](conf.Path)
+		if err != nil {
+			return nil, fmt.Errorf("waitlist: %w", err)
+		}
+		return &localReferralStore{book: book}, nil
+	case "firestore":
+		client, err := firestore.New(conf.ProjectID, conf.DatabaseID)
+		if err != nil {
+			return nil, fmt.Errorf("waitlist: %w", err)
+		}
+		collection := conf.Collection
+		if collection == "" {
+			collection = "referrals"
+		}
+		return &firestoreReferralStore{client: client, collection: collection}, nil
+	}
+	return nil, fmt.Errorf("waitlist: unknown store driver %q", conf.Driver)
+}
+
+// referralBook holds the referrals by code
+type referralBook map[string]*Referral
+
+func (b referralBook) register(formID, email, referredBy string) *Referral {
+	email = strings.ToLower(email)
+	for _, r := range b {
+		if r.FormID == formID && r.Email == email {
+			return r
+		}
+	}
+
+	code := data.RandString(referralCodeLength)
+	for b[code] != nil {
+		code = data.RandString(referralCodeLength)
+	}
+	r := &Referral{
+		Code:       code,
+		FormID:     formID,
+		Email:      email,
+		SignedUpAt: time.Now().UTC(),
+	}
+	if referrer := b[referredBy]; referrer != nil && referrer.FormID == formID {
+		referrer.Referrals++
+		r.ReferredBy = referredBy
+	}
+	b[code] = r
+	return r
+}
+
+func (b referralBook) status(code string) (*ReferralStatus, error) {
+	r := b[code]
+	if r == nil {
+		return nil, fmt.Errorf("%w %q", ErrUnknownReferral, code)
+	}
+
+	var queue []*Referral
+	for _, v := range b {
+		if v.FormID == r.FormID {
+			queue = append(queue, v)
+		}
+	}
+	sort.Slice(queue, func(i, j int) bool {
+		if queue[i].Referrals != queue[j].Referrals {
+			return queue[i].Referrals > queue[j].Referrals
+		}
+		return queue[i].SignedUpAt.Before(queue[j].SignedUpAt)
+	})
+
+	status := &ReferralStatus{
+		Code:      r.Code,
+		Referrals: r.Referrals,
+		Total:     len(queue),
+	}
+	if w, err := GetListByID(r.FormID); err == nil {
+		status.Waitlist = w.Name
+	}
+	for i, v := range queue {
+		if v == r {
+			status.Position = i + 1
+			break
+		}
+	}
+	return status, nil
+}
+
+// localReferralStore keeps the referrals in memory or in a json file
+type localReferralStore struct {
+	book *jsonstore.Store[*Referral]
+}
+
+func (s *localReferralStore) Register(ctx context.Context, formID, email, referredBy string) (*Referral, error) {
+	var r Referral
+	err := s.book.Update(func(book map[string]*Referral) error {
+		r = *referralBook(book).register(formID, email, referredBy)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("waitlist: %w", err)
+	}
+	return &r, nil
+}
+
+func (s *localReferralStore) Status(ctx context.Context, code string) (status *ReferralStatus, err error) {
+	err = s.book.View(func(book map[string]*Referral) error {
+		status, err = referralBook(book).status(code)
+		return err
+	})
+	if err != nil && !errors.Is(err, ErrUnknownReferral) {
+		return nil, fmt.Errorf("waitlist: %w", err)
+	}
+	return status, err
+}
+
+// firestoreReferralStore keeps a Firestore document per referral code, so
+// every instance hands out codes from, and credits, the same book. Emails
+// are indexed in a second collection, <collection>_emails, written in the
+// same commit as the code and the referrer's credit, so a signup is either
+// registered and credited in full or not at all.
+//
+// Queue positions are counted on the rank field, which sorts by referrals
+// then signup time. Counting them needs a composite index on formId and
+// rank of the collection.
+type firestoreReferralStore struct {
+	client     *firestore.Client
+	collection string
+}
+
+func (s *firestoreReferralStore) Register(ctx context.Context, formID, email, referredBy string) (*Referral, error) {
+	email = strings.ToLower(email)
+	key := referralEmailKey(formID, email)
+
+	// the code, the email index and the referrer's credit are committed
+	// together, a precondition failing (the code taken, the email signed up
+	// or the referrer credited meanwhile) retries the whole signup
+	for i := 0; i < maxCommitAttempts; i++ {
+		if r, err := s.byEmail(ctx, key); !errors.Is(err, firestore.ErrNotFound) {
+			return r, err
+		}
+
+		r := &Referral{
+			Code:   data.RandString(referralCodeLength),
+			FormID: formID,
+			Email:  email,
+			// firestore keeps microseconds, the rank must survive a read back
+			SignedUpAt: time.Now().UTC().Truncate(time.Microsecond),
+		}
+		var credit *firestore.Write
+		referrer, doc, err := s.get(ctx, referredBy)
+		switch {
+		case err == nil && referrer.FormID == formID:
+			r.ReferredBy = referredBy
+			referrer.Referrals++
+			credit = &firestore.Write{
+				Collection: s.collection,
+				ID:         referredBy,
+				Doc:        referralDocument(referrer),
+				FieldPaths: []string{"referrals", "rank"},
+				UpdateTime: doc.UpdateTime,
+			}
+		case err != nil && !errors.Is(err, ErrUnknownReferral):
+			return nil, err
+		}
+
+		writes := []firestore.Write{
+			{Collection: s.collection, ID: r.Code, Doc: referralDocument(r), Create: true},
+			{Collection: s.collection + "_emails", ID: key, Create: true, Doc: &firestore.Document{
+				Fields: map[string]firestore.Value{"code": firestore.String(r.Code)},
+			}},
+		}
+		if credit != nil {
+			writes = append(writes, *credit)
+		}
+		err = s.client.Commit(ctx, writes...)
+		if errors.Is(err, firestore.ErrPrecondition) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("waitlist: %w", err)
+		}
+		return r, nil
+	}
+	return nil, fmt.Errorf("waitlist: registering %s: %w", email, firestore.ErrPrecondition)
+}
+
+func (s *firestoreReferralStore) Status(ctx context.Context, code string) (*ReferralStatus, error) {
+	r, _, err := s.get(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+
+	sameForm := firestore.Filter{Field: "formId", Op: "EQUAL", Value: firestore.String(r.FormID)}
+	total, err := s.client.Count(ctx, s.collection, sameForm)
+	if err != nil {
+		return nil, fmt.Errorf("waitlist: %w", err)
+	}
+	ahead, err := s.client.Count(ctx, s.collection, sameForm,
+		firestore.Filter{Field: "rank", Op: "LESS_THAN", Value: firestore.String(referralRank(r))})
+	if err != nil {
+		return nil, fmt.Errorf("waitlist: %w", err)
+	}
+
+	status := &ReferralStatus{
+		Code:      r.Code,
+		Referrals: r.Referrals,
+		Position:  ahead + 1,
+		Total:     total,
+	}
+	if w, err := GetListByID(r.FormID); err == nil {
+		status.Waitlist = w.Name
+	}
+	return status, nil
+}
+
+// get returns the referral of the code and its document, or
+// ErrUnknownReferral
+func (s *firestoreReferralStore) get(ctx context.Context, code string) (*Referral, *firestore.Document, error) {
+	if !validReferralCode(code) {
+		return nil, nil, fmt.Errorf("%w %q", ErrUnknownReferral, code)
+	}
+	doc, err := s.client.Get(ctx, s.collection, code)
+	if errors.Is(err, firestore.ErrNotFound) {
+		return nil, nil, fmt.Errorf("%w %q", ErrUnknownReferral, code)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("waitlist: %w", err)
+	}
+	return referral(code, doc), doc, nil
+}
+
+// byEmail returns the referral indexed under the key, firestore.ErrNotFound
+// when the email has not signed up
+func (s *firestoreReferralStore) byEmail(ctx context.Context, key string) (*Referral, error) {
+	index, err := s.client.Get(ctx, s.collection+"_emails", key)
+	if errors.Is(err, firestore.ErrNotFound) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("waitlist: %w", err)
+	}
+	r, _, err := s.get(ctx, index.Fields["code"].Str())
+	return r, err
+}
+
+// referralEmailKey is the document id of the email's signup of the form
+func referralEmailKey(formID, email string) string {
+	sum := sha256.Sum256([]byte(formID + "\x00" + email))
+	return hex.EncodeToString(sum[:])
+}
+
+// referralRank orders referrals as the queue does, ascending by rank is
+// descending by referrals then ascending by signup time
+func referralRank(r *Referral) string {
+	return fmt.Sprintf("%010d.%020d.%s", 1e9-r.Referrals, r.SignedUpAt.UnixNano(), r.Code)
+}
+
+// validReferralCode reports whether the code could have been handed out,
+// anything else never makes it into a document path
+func validReferralCode(code string) bool {
+	if len(code) != referralCodeLength {
+		return false
+	}
+	for _, c := range code {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+func referralDocument(r *Referral) *firestore.Document {
+	return &firestore.Document{
+		Fields: map[string]firestore.Value{
+			"formId":     firestore.String(r.FormID),
+			"email":      firestore.String(r.Email),
+			"referredBy": firestore.String(r.ReferredBy),
+			"referrals":  firestore.Integer(r.Referrals),
+			"signedUpAt": firestore.Timestamp(r.SignedUpAt),
+			"rank":       firestore.String(referralRank(r)),
+		},
+	}
+}
+
+func referral(code string, d *firestore.Document) *Referral {
+	return &Referral{
+		Code:       code,
+		FormID:     d.Fields["formId"].Str(),
+		Email:      d.Fields["email"].Str(),
+		ReferredBy: d.Fields["referredBy"].Str(),
+		Referrals:  d.Fields["referrals"].Int(),
+		SignedUpAt: d.Fields["signedUpAt"].Time(),
+	}
+}
+
+var (
+	referralsMu   sync.Mutex
+	referralConf  StoreConfig
+	referralStore ReferralStore
+)
+
+// setupReferrals opens the referral store, keeping the existing one when
+// the config is unchanged
+func setupReferrals(conf StoreConfig) error {
+	referralsMu.Lock()
+	defer referralsMu.Unlock()
+
+	if referralStore != nil && referralConf == conf {
+		return nil
+	}
+	store, err := NewReferralStore(conf)
+	if err != nil {
+		return err
+	}
+	referralStore, referralConf = store, conf
+	return nil
+}
+
+// Referrer returns the referral code the form response was referred by,
+// empty when there is none
+func (w *Waitlist) Referrer(r *FormResponse) string {
+	m := FieldConfig{Key: w.Referral.ReferrerKey, Label: w.Referral.ReferrerLabel}
+	if m.Key == "" && m.Label == "" {
+		m.Label = defaultReferrerLabel
+	}
+	for _, f := range r.Fields {
+		if m.matches(f) {
+			if v, ok := f.Answer(); ok {
+				return toString(v)
+			}
+		}
+	}
+	return ""
+}
+
+// Refer registers the signup with the referral program of the waitlist,
+// crediting the referrer, and writes its code to the contact
+func (w *Waitlist) Refer(ctx context.Context, c *Contact, referredBy string) (*Referral, error) {
+	if !w.Referral.Enabled() {
+		return nil, ErrReferralsDisabled
+	}
+	referralsMu.Lock()
+	store := referralStore
+	referralsMu.Unlock()
+
+	r, err := store.Register(ctx, w.FormID, c.Email, referredBy)
+	if err != nil {
+		return nil, err
+	}
+	if c.CustomFields == nil {
+		c.CustomFields = map[string]interface{}{}
+	}
+	c.CustomFields[w.Referral.CodeField] = r.Code
+	return r, nil
+}
+
+// GetReferralStatus returns the standing of the referral code
+func GetReferralStatus(ctx context.Context, code string) (*ReferralStatus, error) {
+	referralsMu.Lock()
+	store := referralStore
+	referralsMu.Unlock()
+	if store == nil {
+		return nil, ErrReferralsDisabled
+	}
+	return store.Status(ctx, code)
+}
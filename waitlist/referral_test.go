@@ -0,0 +1,145 @@
+package waitlist
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/500k-agency/function/lib/firestore/firestoretest"
+)
+
+func TestSetupRefusesMemoryReferralStore(t *testing.T) {
+	confs := []Config{{Name: "beta", FormID: "f1", Referral: ReferralConfig{CodeField: "code"}}}
+	for _, driver := range []string{"", "memory"} {
+		err := Setup(confs, OptInConfig{}, StoreConfig{Driver: driver})
+		if !errors.Is(err, ErrReferralStoreMemory) {
+			t.Errorf("driver %q: got %v, want ErrReferralStoreMemory", driver, err)
+		}
+	}
+	if err := Setup(confs, OptInConfig{}, StoreConfig{Driver: "file", Path: filepath.Join(t.TempDir(), "referrals.json")}); err != nil {
+		t.Errorf("file driver: %v", err)
+	}
+}
+
+func TestReferralStores(t *testing.T) {
+	tests := []struct {
+		name string
+		conf func(t *testing.T) StoreConfig
+	}{
+		{"memory", func(t *testing.T) StoreConfig { return StoreConfig{} }},
+		{"file", func(t *testing.T) StoreConfig {
+			return StoreConfig{Driver: "file", Path: filepath.Join(t.TempDir(), "referrals.json")}
+		}},
+		{"firestore", func(t *testing.T) StoreConfig {
+			firestoretest.NewServer(t)
+			return StoreConfig{Driver: "firestore", ProjectID: firestoretest.ProjectID}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			waitlists = map[string]*Waitlist{"f1": {Config: Config{Name: "beta", FormID: "f1"}}}
+			store, err := NewReferralStore(tt.conf(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := context.Background()
+
+			a, err := store.Register(ctx, "f1", "A@example.com", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			again, err := store.Register(ctx, "f1", "a@example.com", "")
+			if err != nil || again.Code != a.Code {
+				t.Fatalf("signing up again: got %v %v, want code %s", again, err, a.Code)
+			}
+			b, _ := store.Register(ctx, "f1", "b@example.com", "")
+			c, _ := store.Register(ctx, "f1", "c@example.com", b.Code)
+			if c.ReferredBy != b.Code {
+				t.Errorf("referred by %q, want %q", c.ReferredBy, b.Code)
+			}
+			other, _ := store.Register(ctx, "f2", "d@example.com", b.Code)
+			if other.ReferredBy != "" {
+				t.Errorf("credited a code of another waitlist")
+			}
+			if _, err := store.Register(ctx, "f1", "e@example.com", "../../x"); err != nil {
+				t.Errorf("unknown referrer: %v", err)
+			}
+
+			statuses := []struct {
+				code                       string
+				referrals, position, total int
+			}{
+				{b.Code, 1, 1, 4},
+				{a.Code, 0, 2, 4},
+				{c.Code, 0, 3, 4},
+				{other.Code, 0, 1, 1},
+			}
+			for _, want := range statuses {
+				got, err := store.Status(ctx, want.code)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got.Referrals != want.referrals || got.Position != want.position || got.Total != want.total {
+					t.Errorf("status of %s: got %+v, want %+v", want.code, got, want)
+				}
+			}
+			if _, err := store.Status(ctx, "nope"); !errors.Is(err, ErrUnknownReferral) {
+				t.Errorf("unknown code: got %v, want ErrUnknownReferral", err)
+			}
+		})
+	}
+}
+
+func TestFirestoreRegisterIsAtomic(t *testing.T) {
+	srv := firestoretest.NewServer(t)
+	store, err := NewReferralStore(StoreConfig{Driver: "firestore", ProjectID: firestoretest.ProjectID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	owner, _ := store.Register(ctx, "f1", "owner@example.com", "")
+
+	// concurrent deliveries of the same signup and referrals of one code,
+	// fewer than maxCommitAttempts so every signup gets through
+	var wg sync.WaitGroup
+	codes := make([]string, 4)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			email := "same@example.com"
+			if i%2 == 1 {
+				email = string(rune('a'+i)) + "@example.com"
+			}
+			r, err := store.Register(ctx, "f1", email, owner.Code)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			codes[i] = r.Code
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 2; i < len(codes); i += 2 {
+		if codes[i] != codes[0] {
+			t.Errorf("same signup got codes %s and %s", codes[0], codes[i])
+		}
+	}
+	// owner, one same@ and two distinct signups, without orphan codes
+	if n := srv.Len("referrals"); n != 4 {
+		t.Errorf("%d referral documents, want 4", n)
+	}
+	if n := srv.Len("referrals_emails"); n != 4 {
+		t.Errorf("%d email documents, want 4", n)
+	}
+	status, err := store.Status(ctx, owner.Code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Referrals != 3 {
+		t.Errorf("owner credited %d referrals, want 3", status.Referrals)
+	}
+}
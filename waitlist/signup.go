@@ -28,4 +28,12 @@ type FormField struct {
 	Type  string      `json:"type"`
 	Value interface{} `json:"value"`
 	// https://tally.so/help/webhooks
+
+	// choices of multiple choice, checkboxes and dropdown fields
+	Options []*FieldOption `json:"options,omitempty"`
+}
+
+type FieldOption struct {
+	ID   string `json:"id"`
+	Text string `json:"text"`
 }
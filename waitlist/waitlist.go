@@ -1,5 +1,19 @@
 package waitlist
 
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/BurntSushi/toml"
+)
+
+var (
+	ErrNoFormID      = errors.New("waitlist has no form_id")
+	ErrDuplicateForm = errors.New("duplicate waitlist form_id")
+	ErrUnknownForm   = errors.New("no waitlist for form")
+)
+
 type Waitlist struct {
 	Config
 }
@@ -9,18 +23,98 @@ type Config struct {
 	Name    string   `toml:"name"`
 	FormID  string   `toml:"form_id"` // tally form id
 	ListIDs []string `toml:"list_ids"`
+
+	// answers copied onto the contact, the email is found by default
+	Fields []FieldConfig `toml:"fields"`
+
+	// add signups once they confirm their email, see OptInConfig
+	DoubleOptIn       bool   `toml:"double_opt_in"`
+	ConfirmTemplateID string `toml:"confirm_template_id"`
+	// thank you page confirmed signups are redirected to, optional
+	RedirectURL string `toml:"redirect_url"`
+
+	// referral codes, optional
+	Referral ReferralConfig `toml:"referral"`
+}
+
+// Configs decodes [[waitlist]] tables, and the single [waitlist] table of
+// configs written before a waitlist was picked by form id
+type Configs []Config
+
+func (c *Configs) UnmarshalTOML(data interface{}) error {
+	var tables []map[string]interface{}
+	switch v := data.(type) {
+	case map[string]interface{}:
+		tables = []map[string]interface{}{v}
+	case []map[string]interface{}:
+		tables = v
+	default:
+		return fmt.Errorf("waitlist: expected a table or an array of tables, got %T", data)
+	}
+
+	confs := make(Configs, len(tables))
+	for i, t := range tables {
+		// round trip the table through toml to decode it with the struct tags
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(t); err != nil {
+			return fmt.Errorf("waitlist[%d]: %w", i, err)
+		}
+		if _, err := toml.Decode(buf.String(), &confs[i]); err != nil {
+			return fmt.Errorf("waitlist[%d]: %w", i, err)
+		}
+	}
+	*c = confs
+	return nil
 }
 
 var (
-	waitlist *Waitlist
+	// waitlists by tally form id
+	waitlists = map[string]*Waitlist{}
 )
 
-func Setup(conf Config) {
-	waitlist = &Waitlist{
-		Config: conf,
+// Setup loads the waitlists, every tally form may feed a single one, and
+// opens the referral store
+func Setup(confs []Config, optInConf OptInConfig, storeConf StoreConfig) error {
+	byForm := make(map[string]*Waitlist, len(confs))
+	for i, v := range confs {
+		if v.FormID == "" {
+			// configs written before waitlists were picked by form id
+			return fmt.Errorf("waitlist[%d] %q: %w, set it to the id of the tally form the waitlist takes signups from", i, v.Name, ErrNoFormID)
+		}
+		if _, ok := byForm[v.FormID]; ok {
+			return fmt.Errorf("%w %q", ErrDuplicateForm, v.FormID)
+		}
+		for j, f := range v.Fields {
+			if err := f.validate(); err != nil {
+				return fmt.Errorf("waitlist[%d].fields[%d]: %w", i, j, err)
+			}
+		}
+		if v.Referral.Enabled() && !storeConf.persistent() {
+			return fmt.Errorf("waitlist[%d] %q: %w", i, v.Name, ErrReferralStoreMemory)
+		}
+		if v.DoubleOptIn {
+			if v.ConfirmTemplateID == "" {
+				return fmt.Errorf("waitlist[%d] %q: %w", i, v.Name, ErrNoConfirmTemplate)
+			}
+			if err := optInConf.validate(); err != nil {
+				return err
+			}
+		}
+		byForm[v.FormID] = &Waitlist{Config: v}
 	}
+	if err := setupReferrals(storeConf); err != nil {
+		return err
+	}
+	waitlists = byForm
+	optIn = optInConf
+	return nil
 }
 
-func GetListByID(listId string) *Waitlist {
-	return waitlist
+// GetListByID returns the waitlist of the tally form, or ErrUnknownForm
+func GetListByID(formID string) (*Waitlist, error) {
+	w, ok := waitlists[formID]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownForm, formID)
+	}
+	return w, nil
 }